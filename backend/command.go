@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// A command line for the remote shell. Its only constructors quote every argument,
+// so request data can never be spliced into a command as shell syntax.
+type RemoteCommand struct {
+	line string
+}
+
+// Build a command from argv, quoting each argument for a POSIX shell
+func Command(name string, args ...string) RemoteCommand {
+	words := make([]string, 0, len(args)+1)
+	for _, word := range append([]string{name}, args...) {
+		words = append(words, shellQuote(word))
+	}
+	return RemoteCommand{line: strings.Join(words, " ")}
+}
+
+// Run commands one after the other, regardless of their exit status
+func Sequence(commands ...RemoteCommand) RemoteCommand {
+	lines := make([]string, 0, len(commands))
+	for _, command := range commands {
+		lines = append(lines, command.line)
+	}
+	return RemoteCommand{line: strings.Join(lines, "; ")}
+}
+
+// Command line as passed to the remote shell
+func (c RemoteCommand) String() string {
+	return c.line
+}
+
+// Runs commands on the host behind a target; the SSH tunnel manager, or a script in tests
+type commandRunner interface {
+	runCommand(ctx context.Context, target SSHTarget, command RemoteCommand, stdin []byte, stdout, stderr io.Writer) error
+	sudoPassword(target SSHTarget) []byte
+}
+
+// A command that ran and exited with a non-zero status, such as *ssh.ExitError
+type exitStatusError interface {
+	error
+	ExitStatus() int
+}
+
+// Words that mean the same quoted or not
+var shellSafeWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Quote a word so the shell passes it on as a single literal argument
+func shellQuote(word string) string {
+	if shellSafeWord.MatchString(word) {
+		return word
+	}
+	// Inside single quotes nothing is special; a quote itself is closed, escaped and reopened
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// Kinds of Docker objects a request can name
+const (
+	ContainerObject      = "container"
+	VolumeObject         = "volume"
+	NetworkObject        = "network"
+	ComposeProjectObject = "compose project"
+)
+
+var (
+	// Names and IDs of containers, volumes and networks, as the daemon accepts them
+	objectIdentifier = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+	// Project names as the Compose specification allows them
+	composeProjectName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// Longest identifier accepted; names the daemon generates are far shorter
+const maxIdentifierLength = 255
+
+// Returned for an identifier that cannot name a Docker object
+type InvalidIdentifierError struct {
+	Kind  string
+	Value string
+}
+
+func (e *InvalidIdentifierError) Error() string {
+	return fmt.Sprintf("invalid %s name or ID %q", e.Kind, e.Value)
+}
+
+// Check that a value taken from a request can only name a Docker object of the given kind
+func ValidateIdentifier(kind, value string) error {
+	pattern := objectIdentifier
+	if kind == ComposeProjectObject {
+		pattern = composeProjectName
+	}
+	if len(value) > maxIdentifierLength || !pattern.MatchString(value) {
+		return &InvalidIdentifierError{Kind: kind, Value: value}
+	}
+	return nil
+}
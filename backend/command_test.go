@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandQuoting(t *testing.T) {
+	tests := []struct {
+		command RemoteCommand
+		want    string
+	}{
+		{Command("docker", "ps", "--format", "{{json .}}"), `docker ps --format '{{json .}}'`},
+		{Command("docker", "logs", "web; rm -rf /"), `docker logs 'web; rm -rf /'`},
+		{Command("echo", "it's", ""), `echo 'it'\''s' ''`},
+		{Command("env", "DOCKER_HOST=unix:///run/user/1000/docker.sock", "docker"), `env DOCKER_HOST=unix:///run/user/1000/docker.sock docker`},
+		{Sequence(Command("head", "-n1", "/proc/stat"), Command("sleep", "1")), `head -n1 /proc/stat; sleep 1`},
+	}
+	for _, test := range tests {
+		if got := test.command.String(); got != test.want {
+			t.Errorf("command = %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestValidateIdentifier(t *testing.T) {
+	tests := []struct {
+		kind  string
+		value string
+		valid bool
+	}{
+		{ContainerObject, "web", true},
+		{ContainerObject, "0123456789ab", true},
+		{ContainerObject, "shop_web.1-a", true},
+		{ContainerObject, "", false},
+		{ContainerObject, "-rm", false},
+		{ContainerObject, "../info", false},
+		{ContainerObject, "web name", false},
+		{VolumeObject, "data$(id)", false},
+		{ComposeProjectObject, "shop-2", true},
+		{ComposeProjectObject, "Shop", false},
+	}
+	for _, test := range tests {
+		err := ValidateIdentifier(test.kind, test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("ValidateIdentifier(%s, %q) = %v, want valid %v", test.kind, test.value, err, test.valid)
+		}
+	}
+}
+
+func TestSudoPasswordCommand(t *testing.T) {
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		"sudo -k -n true":                 {stderr: "sudo: a password is required\n", status: 1},
+		`sudo -k -S -p '' podman version`: {echo: true},
+	})
+	executor.password = []byte("secret")
+	target := engineTarget(EnginePodman)
+	target.Privilege = PrivilegeSudoPassword
+
+	// The password is only ever written to sudo, which reads it even with credentials cached
+	output, err := engineCLI{runner: executor, target: target, kind: EnginePodman}.output(context.Background(), "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran := executor.commands(); !reflect.DeepEqual(ran, []string{"sudo -k -n true", `sudo -k -S -p '' podman version`}) {
+		t.Errorf("ran %q, want sudo checked to ask, then sudo -k to read the password", ran)
+	}
+	if string(output) != "secret\n" {
+		t.Errorf("stdin = %q, want the password", output)
+	}
+}
+
+func TestSudoPasswordNotAsked(t *testing.T) {
+	// NOPASSWD: sudo runs the command at once and leaves stdin to it
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		"sudo -k -n true": {},
+	})
+	executor.password = []byte("secret")
+	target := engineTarget(EnginePodman)
+	target.Privilege = PrivilegeSudoPassword
+
+	_, err := engineCLI{runner: executor, target: target, kind: EnginePodman}.output(context.Background(), "version")
+	var notAsked *SudoPasswordNotAskedError
+	if !errors.As(err, &notAsked) || errorStatus(err) != http.StatusBadRequest {
+		t.Errorf("error = %v, want sudo mode suggested with a 400", err)
+	}
+	if ran := executor.commands(); !reflect.DeepEqual(ran, []string{"sudo -k -n true"}) {
+		t.Errorf("ran %q, want podman never given the password", ran)
+	}
+
+	// Nor is the password accepted, which sudo would not have checked
+	server := startSSHServer(t, executor, nil)
+	manager := server.manager(t)
+	sshTarget := server.target()
+	sshTarget.Privilege = PrivilegeSudoPassword
+	err = manager.SetSudoPassword(context.Background(), sshTarget, []byte("anything"))
+	if !errors.As(err, &notAsked) {
+		t.Errorf("setting the password gave %v, want it refused", err)
+	}
+	if !manager.SudoPasswordRequired(sshTarget) {
+		t.Error("password stored although sudo does not ask for it")
+	}
+	for _, ran := range executor.commands() {
+		if strings.Contains(ran, "-S") {
+			t.Errorf("ran %q with the password", ran)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Largest page of the container list
+const maxContainerPageSize = 500
+
+// States a container can be in, as the Engine API names them
+var containerStates = map[string]bool{
+	"created":    true,
+	"restarting": true,
+	"running":    true,
+	"removing":   true,
+	"paused":     true,
+	"exited":     true,
+	"dead":       true,
+}
+
+// Keys the container list sorts by
+var containerSortKeys = map[string]func(a, b ContainerSummary) bool{
+	"name":    func(a, b ContainerSummary) bool { return a.Name() < b.Name() },
+	"image":   func(a, b ContainerSummary) bool { return a.Image < b.Image },
+	"state":   func(a, b ContainerSummary) bool { return a.State < b.State },
+	"created": func(a, b ContainerSummary) bool { return a.Created < b.Created },
+}
+
+// Which containers to list and in what order. Containers in every state are listed unless
+// the status filter says otherwise; every filter given has to match.
+type ContainerListOptions struct {
+	Status         []string `json:"status,omitempty"`         // States, any of them
+	Labels         []string `json:"labels,omitempty"`         // "key" or "key=value", all of them
+	Image          string   `json:"image,omitempty"`          // With or without a tag
+	ComposeProject string   `json:"composeProject,omitempty"` // Project label
+	Name           string   `json:"name,omitempty"`           // Part of the name, or a glob like "web-*"
+	Sort           string   `json:"sort,omitempty"`           // A sort key, "-" in front for descending; newest first when empty
+	Page           int      `json:"page,omitempty"`           // From 1
+	PageSize       int      `json:"pageSize,omitempty"`       // Every container on one page when zero
+}
+
+func (o ContainerListOptions) Validate() error {
+	for _, state := range o.Status {
+		if !containerStates[state] {
+			return fmt.Errorf("unknown container status %q", state)
+		}
+	}
+	for _, label := range o.Labels {
+		if label == "" || strings.HasPrefix(label, "=") {
+			return fmt.Errorf("invalid label filter %q", label)
+		}
+	}
+	if o.ComposeProject != "" {
+		if err := ValidateIdentifier(ComposeProjectObject, o.ComposeProject); err != nil {
+			return err
+		}
+	}
+	if _, err := path.Match(o.Name, ""); err != nil {
+		return fmt.Errorf("invalid name pattern %q", o.Name)
+	}
+	if _, exists := containerSortKeys[strings.TrimPrefix(o.Sort, "-")]; o.Sort != "" && !exists {
+		return fmt.Errorf("unknown sort key %q", o.Sort)
+	}
+	if o.Page < 0 {
+		return fmt.Errorf("page must be 1 or more")
+	}
+	if o.PageSize < 0 || o.PageSize > maxContainerPageSize {
+		return fmt.Errorf("page size must be between 1 and %d", maxContainerPageSize)
+	}
+	if o.PageSize > 0 && o.page()-1 > math.MaxInt/o.PageSize {
+		return fmt.Errorf("page %d is past any container", o.Page)
+	}
+	return nil
+}
+
+// Filters the engine can apply itself, so fewer containers come back over the connection
+func (o ContainerListOptions) engineFilters() map[string][]string {
+	filters := map[string][]string{}
+	if len(o.Status) > 0 {
+		filters["status"] = o.Status
+	}
+	labels := append([]string{}, o.Labels...)
+	if o.ComposeProject != "" {
+		labels = append(labels, composeProjectLabel+"="+o.ComposeProject)
+	}
+	if len(labels) > 0 {
+		filters["label"] = labels
+	}
+	return filters
+}
+
+// Whether a container passes every filter. The engine filters are checked again, since the
+// CLI engines apply theirs with small differences.
+func (o ContainerListOptions) match(c ContainerSummary) bool {
+	if len(o.Status) > 0 && !containsString(o.Status, c.State) {
+		return false
+	}
+	for _, label := range o.Labels {
+		key, value, hasValue := strings.Cut(label, "=")
+		actual, exists := c.Labels[key]
+		if !exists || hasValue && actual != value {
+			return false
+		}
+	}
+	if o.ComposeProject != "" && c.Labels[composeProjectLabel] != o.ComposeProject {
+		return false
+	}
+	if o.Image != "" && !matchImage(o.Image, c.Image) {
+		return false
+	}
+	return o.Name == "" || matchName(o.Name, c.Name())
+}
+
+// An image given without a tag matches every tag of it
+func matchImage(want, image string) bool {
+	if image == want {
+		return true
+	}
+	if strings.ContainsAny(want, ":@") && !strings.HasSuffix(want, ":latest") {
+		return false
+	}
+	return imageRepository(image) == imageRepository(want)
+}
+
+// An image reference without its tag or digest
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// A colon after the last slash separates the tag, one before it a registry port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// Globs match the whole name, anything else a part of it, regardless of case
+func matchName(pattern, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	if strings.ContainsAny(pattern, "*?[") {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}
+	return strings.Contains(name, pattern)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter, sort and cut out the requested page; the total counts every matching container
+func (o ContainerListOptions) apply(list []ContainerSummary) (page []ContainerSummary, total int) {
+	matching := make([]ContainerSummary, 0, len(list))
+	for _, c := range list {
+		if o.match(c) {
+			matching = append(matching, c)
+		}
+	}
+
+	key := o.Sort
+	if key == "" {
+		key = "-created"
+	}
+	less := containerSortKeys[strings.TrimPrefix(key, "-")]
+	descending := strings.HasPrefix(key, "-")
+	sort.SliceStable(matching, func(i, j int) bool {
+		if descending {
+			return less(matching[j], matching[i])
+		}
+		return less(matching[i], matching[j])
+	})
+
+	if o.PageSize == 0 {
+		return matching, len(matching)
+	}
+	// Compared in pages, as the offset of a huge page would overflow
+	pages := (len(matching) + o.PageSize - 1) / o.PageSize
+	if o.page() > pages {
+		return []ContainerSummary{}, len(matching)
+	}
+	start := (o.page() - 1) * o.PageSize
+	end := start + o.PageSize
+	if end > len(matching) {
+		end = len(matching)
+	}
+	return matching[start:end], len(matching)
+}
+
+func (o ContainerListOptions) page() int {
+	if o.Page == 0 {
+		return 1
+	}
+	return o.Page
+}
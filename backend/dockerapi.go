@@ -0,0 +1,983 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// Docker socket on the remote host, forwarded over the SSH connection
+	remoteDockerSocket = "/var/run/docker.sock"
+
+	// Newest Engine API version the handlers are written against; older daemons are talked to in their own version
+	maxDockerAPIVersion = "1.43"
+)
+
+// Error returned by the Docker Engine API
+type DockerAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerAPIError) Error() string {
+	return fmt.Sprintf("docker API error (%d): %s", e.StatusCode, e.Message)
+}
+
+// Docker Engine API client for one SSH connection
+type DockerClient struct {
+	http *http.Client
+	dial func(ctx context.Context) (net.Conn, error) // Raw streams, for clients that speak the API themselves
+
+	mutex   sync.Mutex
+	version string // Negotiated API version, empty until the first /_ping succeeds
+}
+
+func newDockerClient(dial func(ctx context.Context) (net.Conn, error)) *DockerClient {
+	return &DockerClient{
+		dial: dial,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dial(ctx)
+				},
+				MaxIdleConns:    4,
+				IdleConnTimeout: 30 * time.Second,
+			},
+		},
+	}
+}
+
+// Drop pooled connections, which die with the SSH connection they were forwarded over
+func (d *DockerClient) closeIdle() {
+	d.http.CloseIdleConnections()
+}
+
+// Docker API client for a target, reaching the daemon over its SSH connection as its privilege mode says
+func (m *SSHTunnelManager) Docker(target SSHTarget) (*DockerClient, error) {
+	if err := target.DockerAccess.Validate(); err != nil {
+		return nil, err
+	}
+
+	conn, _, err := m.usableConnection(target)
+	if err != nil {
+		return nil, err
+	}
+
+	// A TCP+TLS connection is made with its client, there is nothing to forward
+	if target.transport() == TransportTCPTLS {
+		return conn.docker, nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Environments sharing a connection may reach Docker differently, the last one used wins
+	if conn.docker == nil || conn.dockerAccess != target.DockerAccess {
+		if conn.docker != nil {
+			conn.docker.closeIdle()
+		}
+		dialer := &dockerDialer{manager: m, target: target, conn: conn}
+		conn.docker = newDockerClient(dialer.dial)
+		conn.dockerAccess = target.DockerAccess
+	}
+	return conn.docker, nil
+}
+
+// Open a stream to the Docker daemon, giving up once ctx is done
+func (d *dockerDialer) dial(ctx context.Context) (net.Conn, error) {
+	type result struct {
+		stream net.Conn
+		err    error
+	}
+
+	// SSH channels cannot be opened with a context, so an abandoned stream is closed once it arrives
+	dialed := make(chan result, 1)
+	go func() {
+		stream, err := d.open(ctx)
+		dialed <- result{stream, err}
+	}()
+
+	select {
+	case r := <-dialed:
+		return r.stream, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-dialed; r.stream != nil {
+				r.stream.Close()
+			}
+		}()
+		return nil, contextError(ctx, ctx.Err())
+	}
+}
+
+// A net.Conn over the stdin and stdout of a remote command
+type sessionConn struct {
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	stderr  *stderrTail
+}
+
+// The start of what a command wrote to stderr, to explain why its stream ended
+type stderrTail struct {
+	mutex sync.Mutex
+	data  []byte
+}
+
+const maxStderrTail = 1024
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if room := maxStderrTail - len(t.data); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		t.data = append(t.data, p[:room]...)
+	}
+	return len(p), nil
+}
+
+func (t *stderrTail) String() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return strings.TrimSpace(string(t.data))
+}
+
+// Start a command whose stdio carries the Docker API, like docker system dial-stdio.
+// Input, such as a sudo password, is written before the stream is handed out.
+func dialStdio(client *ssh.Client, command RemoteCommand, input []byte) (net.Conn, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSH session: %w", err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	stderr := &stderrTail{}
+	session.Stderr = stderr
+
+	if err := session.Start(command.String()); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start %q: %w", command, err)
+	}
+
+	if len(input) > 0 {
+		if _, err := stdin.Write(input); err != nil {
+			session.Close()
+			return nil, fmt.Errorf("failed to write to %q: %w", command, err)
+		}
+	}
+
+	return &sessionConn{session: session, stdin: stdin, stdout: stdout, stderr: stderr}, nil
+}
+
+func (c *sessionConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		if message := c.stderr.String(); message != "" {
+			// Typically sudo refusing to run docker
+			return n, fmt.Errorf("docker system dial-stdio ended: %s", message)
+		}
+	}
+	return n, err
+}
+
+func (c *sessionConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+// Stop writing while still reading, as a client does once the stdin of an attached container ends
+func (c *sessionConn) CloseWrite() error { return c.stdin.Close() }
+
+func (c *sessionConn) Close() error {
+	c.stdin.Close()
+	return c.session.Close()
+}
+
+func (c *sessionConn) LocalAddr() net.Addr  { return stdioAddr{} }
+func (c *sessionConn) RemoteAddr() net.Addr { return stdioAddr{} }
+
+// SSH channels have no deadlines; requests are bounded by their context instead
+func (c *sessionConn) SetDeadline(time.Time) error      { return nil }
+func (c *sessionConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *sessionConn) SetWriteDeadline(time.Time) error { return nil }
+
+type stdioAddr struct{}
+
+func (stdioAddr) Network() string { return "stdio" }
+func (stdioAddr) String() string  { return "docker system dial-stdio" }
+
+// Compare two API versions like "1.41"
+func compareAPIVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// API version to talk in, negotiated with /_ping the first time
+func (d *DockerClient) apiVersion(ctx context.Context) (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.version != "" {
+		return d.version, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/_ping", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return "", contextError(ctx, fmt.Errorf("failed to reach the Docker daemon: %w", err))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	version := resp.Header.Get("Api-Version")
+	if version == "" || compareAPIVersions(version, maxDockerAPIVersion) > 0 {
+		version = maxDockerAPIVersion
+	}
+	d.version = version
+	logger.Infof("Using Docker Engine API version %s", version)
+	return version, nil
+}
+
+// Check the daemon answers, on a fresh request every time
+func (d *DockerClient) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/_ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return contextError(ctx, fmt.Errorf("failed to reach the Docker daemon: %w", err))
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return &DockerAPIError{StatusCode: resp.StatusCode, Message: "ping failed"}
+	}
+	return nil
+}
+
+// Send an API request and return the response once its status is known to be good
+func (d *DockerClient) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	version, err := d.apiVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	endpoint := "http://docker/v" + version + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &DockerAPIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+	return resp, nil
+}
+
+// Send an API request and decode its JSON response into out, unless out is nil
+func (d *DockerClient) call(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := d.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	return contextError(ctx, json.NewDecoder(resp.Body).Decode(out))
+}
+
+// API path of a Docker object; the identifier is validated so it cannot step into another endpoint
+func objectPath(kind, id, suffix string) (string, error) {
+	if err := ValidateIdentifier(kind, id); err != nil {
+		return "", err
+	}
+	return "/" + objectCollections[kind] + "/" + id + suffix, nil
+}
+
+// API collection of each kind of object
+var objectCollections = map[string]string{
+	ContainerObject: "containers",
+	VolumeObject:    "volumes",
+	NetworkObject:   "networks",
+}
+
+// Encode filters the way the API expects them
+func filterQuery(filters map[string][]string) url.Values {
+	query := url.Values{}
+	if len(filters) > 0 {
+		data, _ := json.Marshal(filters)
+		query.Set("filters", string(data))
+	}
+	return query
+}
+
+// A container as listed by /containers/json
+type ContainerSummary struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	Created int64             `json:"Created"`
+	State   string            `json:"State"`
+	Status  string            `json:"Status"`
+	Ports   []ContainerPort   `json:"Ports"`
+	Labels  map[string]string `json:"Labels"`
+}
+
+type ContainerPort struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+// Container name without the leading slash
+func (c ContainerSummary) Name() string {
+	if len(c.Names) == 0 {
+		return shortID(c.ID)
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+func (d *DockerClient) ContainerList(ctx context.Context, all bool, filters map[string][]string) ([]ContainerSummary, error) {
+	query := filterQuery(filters)
+	if all {
+		query.Set("all", "1")
+	}
+	var containers []ContainerSummary
+	err := d.call(ctx, http.MethodGet, "/containers/json", query, nil, &containers)
+	return containers, err
+}
+
+// The parts of /containers/{id}/json the handlers use
+type ContainerDetails struct {
+	ID           string `json:"Id"`
+	Name         string `json:"Name"`
+	Created      string `json:"Created"`
+	Image        string `json:"Image"` // ID of the image
+	RestartCount int    `json:"RestartCount"`
+	State        struct {
+		Status     string `json:"Status"`
+		Running    bool   `json:"Running"`
+		Paused     bool   `json:"Paused"`
+		Restarting bool   `json:"Restarting"`
+		OOMKilled  bool   `json:"OOMKilled"`
+		Dead       bool   `json:"Dead"`
+		Pid        int    `json:"Pid"`
+		ExitCode   int    `json:"ExitCode"`
+		Error      string `json:"Error"`
+		StartedAt  string `json:"StartedAt"`
+		FinishedAt string `json:"FinishedAt"`
+		Health     *struct {
+			Status        string `json:"Status"`
+			FailingStreak int    `json:"FailingStreak"`
+			Log           []struct {
+				Start    string `json:"Start"`
+				End      string `json:"End"`
+				ExitCode int    `json:"ExitCode"`
+				Output   string `json:"Output"`
+			} `json:"Log"`
+		} `json:"Health"`
+	} `json:"State"`
+	Config struct {
+		Hostname   string            `json:"Hostname"`
+		User       string            `json:"User"`
+		Env        []string          `json:"Env"`
+		Cmd        commandLine       `json:"Cmd"`
+		Entrypoint commandLine       `json:"Entrypoint"`
+		Image      string            `json:"Image"`
+		WorkingDir string            `json:"WorkingDir"`
+		Labels     map[string]string `json:"Labels"`
+		Tty        bool              `json:"Tty"`
+	} `json:"Config"`
+	HostConfig struct {
+		NetworkMode   string `json:"NetworkMode"`
+		Privileged    bool   `json:"Privileged"`
+		RestartPolicy struct {
+			Name              string `json:"Name"`
+			MaximumRetryCount int    `json:"MaximumRetryCount"`
+		} `json:"RestartPolicy"`
+		NanoCpus          int64  `json:"NanoCpus"`
+		CpuShares         int64  `json:"CpuShares"`
+		CpuQuota          int64  `json:"CpuQuota"`
+		CpuPeriod         int64  `json:"CpuPeriod"`
+		CpusetCpus        string `json:"CpusetCpus"`
+		Memory            int64  `json:"Memory"`
+		MemoryReservation int64  `json:"MemoryReservation"`
+		MemorySwap        int64  `json:"MemorySwap"`
+		PidsLimit         *int64 `json:"PidsLimit"`
+	} `json:"HostConfig"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		Mode        string `json:"Mode"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+	NetworkSettings struct {
+		IPAddress string `json:"IPAddress"`
+		Ports     map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+		Networks map[string]struct {
+			IPAddress  string   `json:"IPAddress"`
+			Gateway    string   `json:"Gateway"`
+			MacAddress string   `json:"MacAddress"`
+			Aliases    []string `json:"Aliases"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// A command in inspect output, which podman prints as a single string in some versions
+type commandLine []string
+
+func (c *commandLine) UnmarshalJSON(data []byte) error {
+	var line string
+	if err := json.Unmarshal(data, &line); err == nil {
+		*c = strings.Fields(line)
+		return nil
+	}
+	var words []string
+	if err := json.Unmarshal(data, &words); err != nil {
+		return err
+	}
+	*c = words
+	return nil
+}
+
+// IP address of the container on its default network, or else on the first network by name
+func (c ContainerDetails) address() (string, error) {
+	if c.NetworkSettings.IPAddress != "" {
+		return c.NetworkSettings.IPAddress, nil
+	}
+	names := make([]string, 0, len(c.NetworkSettings.Networks))
+	for name := range c.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if address := c.NetworkSettings.Networks[name].IPAddress; address != "" {
+			return address, nil
+		}
+	}
+	return "", fmt.Errorf("container %s has no IP address, it is stopped or shares the network of its host", strings.TrimPrefix(c.Name, "/"))
+}
+
+func (d *DockerClient) ContainerInspect(ctx context.Context, id string) (ContainerDetails, error) {
+	var details ContainerDetails
+	path, err := objectPath(ContainerObject, id, "/json")
+	if err != nil {
+		return details, err
+	}
+	err = d.call(ctx, http.MethodGet, path, nil, nil, &details)
+	return details, err
+}
+
+// IP address of a container, as reached from its host
+func (d *DockerClient) ContainerAddress(ctx context.Context, id string) (string, error) {
+	details, err := d.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return details.address()
+}
+
+// Start a container; one that is already running is not an error
+func (d *DockerClient) ContainerStart(ctx context.Context, id string) error {
+	path, err := objectPath(ContainerObject, id, "/start")
+	if err != nil {
+		return err
+	}
+	return d.call(ctx, http.MethodPost, path, nil, nil, nil)
+}
+
+// Stop a container; one that is already stopped is not an error
+func (d *DockerClient) ContainerStop(ctx context.Context, id string) error {
+	path, err := objectPath(ContainerObject, id, "/stop")
+	if err != nil {
+		return err
+	}
+	return d.call(ctx, http.MethodPost, path, nil, nil, nil)
+}
+
+// Restart a container, starting it when it is stopped
+func (d *DockerClient) ContainerRestart(ctx context.Context, id string) error {
+	return d.containerAction(ctx, id, "/restart", nil)
+}
+
+func (d *DockerClient) ContainerPause(ctx context.Context, id string) error {
+	return d.containerAction(ctx, id, "/pause", nil)
+}
+
+func (d *DockerClient) ContainerUnpause(ctx context.Context, id string) error {
+	return d.containerAction(ctx, id, "/unpause", nil)
+}
+
+func (d *DockerClient) ContainerKill(ctx context.Context, id, signal string) error {
+	return d.containerAction(ctx, id, "/kill", url.Values{"signal": {signal}})
+}
+
+func (d *DockerClient) ContainerRemove(ctx context.Context, id string, options ContainerRemoveOptions) error {
+	path, err := objectPath(ContainerObject, id, "")
+	if err != nil {
+		return err
+	}
+	query := url.Values{"force": {strconv.FormatBool(options.Force)}, "v": {strconv.FormatBool(options.Volumes)}}
+	return d.call(ctx, http.MethodDelete, path, query, nil, nil)
+}
+
+func (d *DockerClient) ContainerRename(ctx context.Context, id, name string) error {
+	if err := ValidateIdentifier(ContainerObject, name); err != nil {
+		return err
+	}
+	return d.containerAction(ctx, id, "/rename", url.Values{"name": {name}})
+}
+
+// POST to an action endpoint of a container
+func (d *DockerClient) containerAction(ctx context.Context, id, action string, query url.Values) error {
+	path, err := objectPath(ContainerObject, id, action)
+	if err != nil {
+		return err
+	}
+	return d.call(ctx, http.MethodPost, path, query, nil, nil)
+}
+
+// Log lines of a container, split into lines with stdout and stderr merged
+func (d *DockerClient) ContainerLogs(ctx context.Context, id string, tail int, timestamps bool) ([]string, error) {
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}}
+	if tail > 0 {
+		query.Set("tail", strconv.Itoa(tail))
+	}
+	if timestamps {
+		query.Set("timestamps", "1")
+	}
+
+	path, err := objectPath(ContainerObject, id, "/logs")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.do(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Newer daemons say whether the stream is multiplexed, older ones need the TTY setting
+	var multiplexed bool
+	switch resp.Header.Get("Content-Type") {
+	case "application/vnd.docker.multiplexed-stream":
+		multiplexed = true
+	case "application/vnd.docker.raw-stream":
+		multiplexed = false
+	default:
+		details, err := d.ContainerInspect(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		multiplexed = !details.Config.Tty
+	}
+
+	var output []byte
+	if multiplexed {
+		output, err = demuxStream(resp.Body)
+	} else {
+		output, err = ioutil.ReadAll(resp.Body)
+	}
+	if err != nil {
+		return nil, contextError(ctx, fmt.Errorf("failed to read logs: %w", err))
+	}
+
+	return logLines(output), nil
+}
+
+// Merge the frames of a multiplexed stdout/stderr stream, in the order they arrived
+func demuxStream(r io.Reader) ([]byte, error) {
+	var output bytes.Buffer
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return output.Bytes(), nil
+			}
+			return output.Bytes(), err
+		}
+		size := binary.BigEndian.Uint32(header[4:])
+		if _, err := io.CopyN(&output, r, int64(size)); err != nil {
+			return output.Bytes(), err
+		}
+	}
+}
+
+// One sample of /containers/{id}/stats, reduced to what the dashboard shows
+type ContainerStats struct {
+	Read     time.Time `json:"read"`
+	CPUStats cpuStats  `json:"cpu_stats"`
+	PreCPU   cpuStats  `json:"precpu_stats"`
+	Memory   struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+}
+
+type cpuStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint32 `json:"online_cpus"`
+}
+
+func (d *DockerClient) ContainerStats(ctx context.Context, id string) (ContainerStats, error) {
+	var stats ContainerStats
+	query := url.Values{"stream": {"0"}}
+	path, err := objectPath(ContainerObject, id, "/stats")
+	if err != nil {
+		return stats, err
+	}
+	err = d.call(ctx, http.MethodGet, path, query, nil, &stats)
+	return stats, err
+}
+
+// CPU usage in percent of one CPU, computed like docker stats does
+func (s ContainerStats) CPUPercent() float64 {
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPU.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPU.SystemUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+// Memory in use without the page cache, like docker stats
+func (s ContainerStats) MemoryUsage() uint64 {
+	usage := s.Memory.Usage
+	// cgroup v2 reports inactive_file, v1 total_inactive_file
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if cache, exists := s.Memory.Stats[key]; exists && cache < usage {
+			return usage - cache
+		}
+	}
+	return usage
+}
+
+func (s ContainerStats) NetworkIO() (rx, tx uint64) {
+	for _, network := range s.Networks {
+		rx += network.RxBytes
+		tx += network.TxBytes
+	}
+	return rx, tx
+}
+
+func (s ContainerStats) BlockIO() (read, write uint64) {
+	for _, entry := range s.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			read += entry.Value
+		case "write":
+			write += entry.Value
+		}
+	}
+	return read, write
+}
+
+func (d *DockerClient) ContainerUsage(ctx context.Context, id string) (ContainerUsage, error) {
+	stats, err := d.ContainerStats(ctx, id)
+	if err != nil {
+		return ContainerUsage{}, err
+	}
+	usage := ContainerUsage{
+		CPUPercent:  stats.CPUPercent(),
+		MemoryUsage: stats.MemoryUsage(),
+		MemoryLimit: stats.Memory.Limit,
+	}
+	usage.NetworkRx, usage.NetworkTx = stats.NetworkIO()
+	usage.BlockRead, usage.BlockWrite = stats.BlockIO()
+	return usage, nil
+}
+
+// An image as listed by /images/json
+type ImageSummary struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+	Created  int64    `json:"Created"`
+	Size     int64    `json:"Size"`
+}
+
+func (d *DockerClient) ImageList(ctx context.Context) ([]ImageSummary, error) {
+	var images []ImageSummary
+	err := d.call(ctx, http.MethodGet, "/images/json", nil, nil, &images)
+	return images, err
+}
+
+type Volume struct {
+	Name       string            `json:"Name"`
+	Driver     string            `json:"Driver"`
+	Mountpoint string            `json:"Mountpoint"`
+	CreatedAt  string            `json:"CreatedAt"`
+	Labels     map[string]string `json:"Labels"`
+	UsageData  *struct {
+		Size     int64 `json:"Size"`
+		RefCount int64 `json:"RefCount"`
+	} `json:"UsageData"`
+}
+
+func (d *DockerClient) VolumeList(ctx context.Context) ([]Volume, error) {
+	var response struct {
+		Volumes []Volume `json:"Volumes"`
+	}
+	err := d.call(ctx, http.MethodGet, "/volumes", nil, nil, &response)
+	return response.Volumes, err
+}
+
+func (d *DockerClient) VolumeRemove(ctx context.Context, name string) error {
+	path, err := objectPath(VolumeObject, name, "")
+	if err != nil {
+		return err
+	}
+	return d.call(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+type Network struct {
+	ID       string `json:"Id"`
+	Name     string `json:"Name"`
+	Driver   string `json:"Driver"`
+	Scope    string `json:"Scope"`
+	Internal bool   `json:"Internal"`
+	IPAM     struct {
+		Driver string       `json:"Driver"`
+		Config []IPAMConfig `json:"Config"`
+	} `json:"IPAM"`
+}
+
+type IPAMConfig struct {
+	Subnet  string `json:"Subnet"`
+	Gateway string `json:"Gateway"`
+}
+
+func (d *DockerClient) NetworkList(ctx context.Context) ([]Network, error) {
+	var networks []Network
+	err := d.call(ctx, http.MethodGet, "/networks", nil, nil, &networks)
+	return networks, err
+}
+
+func (d *DockerClient) NetworkRemove(ctx context.Context, id string) error {
+	path, err := objectPath(NetworkObject, id, "")
+	if err != nil {
+		return err
+	}
+	return d.call(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// The parts of /info the dashboard shows
+type DockerInfo struct {
+	ServerVersion     string `json:"ServerVersion"`
+	OSType            string `json:"OSType"`
+	OperatingSystem   string `json:"OperatingSystem"`
+	Architecture      string `json:"Architecture"`
+	NCPU              int    `json:"NCPU"`
+	MemTotal          int64  `json:"MemTotal"`
+	DockerRootDir     string `json:"DockerRootDir"`
+	SystemTime        string `json:"SystemTime"`
+	ExperimentalBuild bool   `json:"ExperimentalBuild"`
+}
+
+func (d *DockerClient) Info(ctx context.Context) (DockerInfo, error) {
+	var info DockerInfo
+	err := d.call(ctx, http.MethodGet, "/info", nil, nil, &info)
+	return info, err
+}
+
+type DockerVersion struct {
+	Version    string `json:"Version"`
+	APIVersion string `json:"ApiVersion"`
+	Os         string `json:"Os"`
+	Arch       string `json:"Arch"`
+}
+
+func (d *DockerClient) Version(ctx context.Context) (DockerVersion, error) {
+	var version DockerVersion
+	err := d.call(ctx, http.MethodGet, "/version", nil, nil, &version)
+	return version, err
+}
+
+// Space used by the daemon, from /system/df
+type DiskUsage struct {
+	LayersSize int64    `json:"LayersSize"`
+	Volumes    []Volume `json:"Volumes"`
+}
+
+func (d *DockerClient) DiskUsage(ctx context.Context) (DiskUsage, error) {
+	var usage DiskUsage
+	err := d.call(ctx, http.MethodGet, "/system/df", nil, nil, &usage)
+	return usage, err
+}
+
+func (d *DockerClient) SpaceUsage(ctx context.Context) (SpaceUsage, error) {
+	df, err := d.DiskUsage(ctx)
+	if err != nil {
+		return SpaceUsage{}, err
+	}
+	usage := SpaceUsage{Images: df.LayersSize}
+	for _, volume := range df.Volumes {
+		if volume.UsageData != nil && volume.UsageData.Size > 0 {
+			usage.Volumes += volume.UsageData.Size
+		}
+	}
+	return usage, nil
+}
+
+// A message from /events
+type EventMessage struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Status string `json:"status"` // Deprecated in the API, still sent by older daemons
+	ID     string `json:"id"`
+	From   string `json:"from"`
+	Time   int64  `json:"time"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+// The last events of a stream, oldest first, kept in a ring as they are decoded; a limit of 0 keeps them all
+type recentEvents struct {
+	limit  int
+	events []EventMessage
+	next   int // Where the oldest event is once the ring is full
+}
+
+func newRecentEvents(limit int) *recentEvents {
+	return &recentEvents{limit: limit, events: make([]EventMessage, 0, max(limit, 0))}
+}
+
+func (r *recentEvents) add(event EventMessage) {
+	if r.limit <= 0 || len(r.events) < r.limit {
+		r.events = append(r.events, event)
+		return
+	}
+	r.events[r.next] = event
+	r.next = (r.next + 1) % r.limit
+}
+
+func (r *recentEvents) list() []EventMessage {
+	return append(append([]EventMessage{}, r.events[r.next:]...), r.events[:r.next]...)
+}
+
+// The last limit events between since and until; the daemon ends the stream once until has passed
+func (d *DockerClient) Events(ctx context.Context, since, until time.Time, limit int) ([]EventMessage, error) {
+	query := url.Values{
+		"since": {strconv.FormatInt(since.Unix(), 10)},
+		"until": {strconv.FormatInt(until.Unix(), 10)},
+	}
+	resp, err := d.do(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	events := newRecentEvents(limit)
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event EventMessage
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return events.list(), nil
+			}
+			return events.list(), contextError(ctx, err)
+		}
+		events.add(event)
+	}
+}
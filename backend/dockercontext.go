@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A local port leading to the Docker daemon of an environment, for the docker CLI of the
+// machine running Docker Desktop
+type DockerEndpointRequest struct {
+	SSHTarget
+	LocalPort   int    `json:"localPort,omitempty"`   // The first free port of the forward range when left out
+	ContextName string `json:"contextName,omitempty"` // Docker context to describe, named after the host when left out
+}
+
+// Names the docker CLI accepts for a context
+var dockerContextNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.+-]+$`)
+
+// Forward a local port to the Docker daemon of a target; a connection has at most one, which is
+// returned again when asked for twice
+func (m *SSHTunnelManager) OpenDockerEndpoint(req DockerEndpointRequest) (PortForward, error) {
+	if req.engine() != EngineDocker {
+		return PortForward{}, &UnsupportedOperationError{Engine: req.engine(), Operation: "a Docker endpoint"}
+	}
+	if req.LocalPort != 0 && (req.LocalPort < forwardPortMin || req.LocalPort > forwardPortMax) {
+		return PortForward{}, &InvalidForwardError{Reason: fmt.Sprintf("local port must be between %d and %d, the ports the extension publishes", forwardPortMin, forwardPortMax)}
+	}
+
+	// Connects, and checks the privilege mode, before anything listens
+	if _, err := m.Docker(req.SSHTarget); err != nil {
+		return PortForward{}, err
+	}
+	conn, _, err := m.usableConnection(req.SSHTarget)
+	if err != nil {
+		return PortForward{}, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := connectionKey(req.SSHTarget)
+	if !conn.Active {
+		return PortForward{}, fmt.Errorf("connection to %s was closed", key)
+	}
+	for _, existing := range m.forwards {
+		if existing.conn == conn && existing.Kind == ForwardDocker {
+			return existing.statusLocked(), nil
+		}
+	}
+
+	forward := &portForward{
+		PortForward: PortForward{
+			Kind:       ForwardDocker,
+			Connection: key,
+			Target:     conn.Target.String(),
+		},
+		target: req.SSHTarget,
+		conn:   conn,
+	}
+	if err := m.startForwardLocked(forward, req.LocalPort); err != nil {
+		return PortForward{}, err
+	}
+	return forward.statusLocked(), nil
+}
+
+// Hosts the docker CLI names in requests to a local endpoint. A page in a browser that rebinds
+// its own name to 127.0.0.1 still sends that name, and is refused.
+var dockerEndpointHosts = map[string]bool{
+	"localhost": true,
+	"127.0.0.1": true,
+	"::1":       true,
+}
+
+// Read the first request of a connection to a Docker endpoint and check its Host header,
+// answering 403 when it is not local. Returns what was read, to pass on to the daemon.
+// Browsers never change the Host of a connection, so later requests are not checked.
+func checkDockerEndpointHost(local net.Conn, timeout time.Duration) ([]byte, bool) {
+	var consumed bytes.Buffer
+	local.SetReadDeadline(time.Now().Add(timeout))
+	request, err := http.ReadRequest(bufio.NewReader(io.TeeReader(local, &consumed)))
+	local.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, false
+	}
+
+	host := request.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	if !dockerEndpointHosts[strings.ToLower(host)] {
+		logger.Warnf("Refused a request to the Docker endpoint for host %q", request.Host)
+		io.WriteString(local, "HTTP/1.1 403 Forbidden\r\nContent-Type: text/plain\r\nContent-Length: 34\r\nConnection: close\r\n\r\nOnly local clients may use Docker\n")
+		return nil, false
+	}
+	return consumed.Bytes(), true
+}
+
+// A docker CLI context for a Docker endpoint, both as a command creating it and as the
+// archive docker context export writes, for docker context import
+type DockerContext struct {
+	Name          string `json:"name"`
+	Host          string `json:"host"`
+	CreateCommand string `json:"createCommand"`
+	ImportCommand string `json:"importCommand"`
+	Archive       []byte `json:"archive"` // Base64 in JSON
+}
+
+// meta.json of an exported context
+type dockerContextMeta struct {
+	Name     string `json:"Name"`
+	Metadata struct {
+		Description string `json:"Description,omitempty"`
+	} `json:"Metadata"`
+	Endpoints map[string]dockerContextEndpoint `json:"Endpoints"`
+}
+
+type dockerContextEndpoint struct {
+	Host          string `json:"Host"`
+	SkipTLSVerify bool   `json:"SkipTLSVerify"`
+}
+
+// Context name for a host, with the characters the docker CLI refuses replaced
+func defaultDockerContextName(hostname string) string {
+	name := []byte("remote-" + hostname)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_.+-", c) >= 0) {
+			name[i] = '-'
+		}
+	}
+	return string(name)
+}
+
+// Describe the context for the docker CLI reaching an endpoint on a local port
+func NewDockerContext(name, description string, localPort int) (DockerContext, error) {
+	if !dockerContextNamePattern.MatchString(name) {
+		return DockerContext{}, &InvalidForwardError{Reason: fmt.Sprintf("invalid Docker context name %q", name)}
+	}
+	host := fmt.Sprintf("tcp://127.0.0.1:%d", localPort)
+
+	meta := dockerContextMeta{Name: name, Endpoints: map[string]dockerContextEndpoint{"docker": {Host: host}}}
+	meta.Metadata.Description = description
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return DockerContext{}, err
+	}
+
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	if err := writer.WriteHeader(&tar.Header{Name: "meta.json", Mode: 0644, Size: int64(len(data))}); err != nil {
+		return DockerContext{}, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return DockerContext{}, err
+	}
+	if err := writer.Close(); err != nil {
+		return DockerContext{}, err
+	}
+
+	create := []string{"docker", "context", "create", name, "--description", description, "--docker", "host=" + host}
+	for i, word := range create {
+		create[i] = shellQuote(word)
+	}
+	return DockerContext{
+		Name:          name,
+		Host:          host,
+		CreateCommand: strings.Join(create, " "),
+		ImportCommand: fmt.Sprintf("echo %s | base64 -d | docker context import %s -", base64.StdEncoding.EncodeToString(archive.Bytes()), shellQuote(name)),
+		Archive:       archive.Bytes(),
+	}, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The formatting below mirrors the docker CLI so the UI shows the same values it used to scrape
+
+var (
+	decimalUnits = []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	binaryUnits  = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+)
+
+func formatSize(size float64, base float64, units []string) string {
+	i := 0
+	for size >= base && i < len(units)-1 {
+		size /= base
+		i++
+	}
+	return fmt.Sprintf("%.4g%s", size, units[i])
+}
+
+// Size in decimal units, like docker images
+func humanSize(size int64) string {
+	return formatSize(float64(size), 1000, decimalUnits)
+}
+
+// Size in binary units, like the memory columns of docker stats
+func bytesSize(size uint64) string {
+	return formatSize(float64(size), 1024, binaryUnits)
+}
+
+// Approximate duration, like the CREATED column of docker images
+func humanDuration(d time.Duration) string {
+	seconds := int(d.Seconds())
+	switch {
+	case seconds < 1:
+		return "Less than a second"
+	case seconds == 1:
+		return "1 second"
+	case seconds < 60:
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+
+	minutes := int(d.Minutes())
+	switch {
+	case minutes == 1:
+		return "About a minute"
+	case minutes < 60:
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+
+	hours := int(d.Hours() + 0.5)
+	switch {
+	case hours == 1:
+		return "About an hour"
+	case hours < 48:
+		return fmt.Sprintf("%d hours", hours)
+	case hours < 24*7*2:
+		return fmt.Sprintf("%d days", hours/24)
+	case hours < 24*30*2:
+		return fmt.Sprintf("%d weeks", hours/24/7)
+	case hours < 24*365*2:
+		return fmt.Sprintf("%d months", hours/24/30)
+	}
+	return fmt.Sprintf("%d years", int(d.Hours())/24/365)
+}
+
+// Time since a Unix timestamp, like "3 days ago"
+func createdSince(created int64) string {
+	return humanDuration(time.Since(time.Unix(created, 0))) + " ago"
+}
+
+// Image or container ID as shown by the CLI
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// Published and exposed ports, like the PORTS column of docker ps
+func formatPorts(ports []ContainerPort) string {
+	sorted := append([]ContainerPort{}, ports...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].PrivatePort != sorted[j].PrivatePort {
+			return sorted[i].PrivatePort < sorted[j].PrivatePort
+		}
+		return sorted[i].IP < sorted[j].IP
+	})
+
+	var parts []string
+	seen := make(map[string]bool)
+	for _, port := range sorted {
+		part := fmt.Sprintf("%d/%s", port.PrivatePort, port.Type)
+		if port.PublicPort != 0 {
+			part = fmt.Sprintf("%s->%s", net.JoinHostPort(port.IP, strconv.Itoa(port.PublicPort)), part)
+		}
+		if !seen[part] {
+			seen[part] = true
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Labels as sorted key=value pairs
+func labelList(labels map[string]string) []string {
+	list := make([]string, 0, len(labels))
+	for key, value := range labels {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Labels joined with commas, like the LABELS column of docker ps
+func formatLabels(labels map[string]string) string {
+	return strings.Join(labelList(labels), ",")
+}
+
+// Engines driven through their CLI print values in the same formats, which are parsed back below
+
+// Multipliers of the size units the CLIs print, lower-cased
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// Bytes in a size like "1.5MiB", "12kB" or "7.6 MiB"
+func parseSize(s string) (uint64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	number, unit := s, ""
+	if i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' }); i >= 0 {
+		number, unit = s[:i], s[i:]
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	multiplier, known := sizeUnits[strings.ToLower(unit)]
+	if err != nil || !known {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return uint64(value * multiplier), nil
+}
+
+// The two sizes of a column like "1.2MB / 8GB"; a part that cannot be read is zero
+func parseSizePair(s string) (uint64, uint64) {
+	first, second, _ := strings.Cut(s, "/")
+	a, _ := parseSize(first)
+	b, _ := parseSize(second)
+	return a, b
+}
+
+// Value of a percentage like "12.50%"
+func parsePercent(s string) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	return value
+}
+
+// Ports of a PORTS column like "0.0.0.0:8080->80/tcp, 443/tcp"
+func parsePorts(s string) []ContainerPort {
+	var ports []ContainerPort
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var port ContainerPort
+		published, exposed, mapped := strings.Cut(part, "->")
+		if !mapped {
+			exposed = published
+		} else if host, public, err := net.SplitHostPort(published); err == nil {
+			port.IP = host
+			port.PublicPort, _ = strconv.Atoi(public)
+		}
+
+		private, protocol, _ := strings.Cut(exposed, "/")
+		port.PrivatePort, _ = strconv.Atoi(private)
+		port.Type = protocol
+		if port.Type == "" {
+			port.Type = "tcp"
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// Labels of a LABELS column like "a=1,b=2"
+func parseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if key, value, _ := strings.Cut(pair, "="); key != "" {
+			labels[key] = value
+		}
+	}
+	return labels
+}
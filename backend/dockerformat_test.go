@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want uint64
+	}{
+		{"0B", 0},
+		{"12kB", 12000},
+		{"1.5MiB", 1572864},
+		{"7.6 MiB", 7969177},
+		{"2GB", 2000000000},
+		{"512", 512},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.size)
+		if err != nil || got != test.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", test.size, got, err, test.want)
+		}
+	}
+	if _, err := parseSize("3 parsecs"); err == nil {
+		t.Errorf("parseSize accepted an unknown unit")
+	}
+}
+
+func TestPorts(t *testing.T) {
+	tests := []struct {
+		column    string
+		ports     []ContainerPort
+		formatted string // Sorted by container port, like docker ps
+	}{
+		{"", nil, ""},
+		{"443/tcp", []ContainerPort{{PrivatePort: 443, Type: "tcp"}}, "443/tcp"},
+		{"0.0.0.0:8080->80/tcp, 53/udp", []ContainerPort{
+			{IP: "0.0.0.0", PublicPort: 8080, PrivatePort: 80, Type: "tcp"},
+			{PrivatePort: 53, Type: "udp"},
+		}, "53/udp, 0.0.0.0:8080->80/tcp"},
+		{"[::]:8080->80/tcp", []ContainerPort{{IP: "::", PublicPort: 8080, PrivatePort: 80, Type: "tcp"}}, "[::]:8080->80/tcp"},
+	}
+	for _, test := range tests {
+		ports := parsePorts(test.column)
+		if !reflect.DeepEqual(ports, test.ports) {
+			t.Errorf("parsePorts(%q) = %+v, want %+v", test.column, ports, test.ports)
+		}
+		if got := formatPorts(ports); got != test.formatted {
+			t.Errorf("formatPorts(%+v) = %q, want %q", ports, got, test.formatted)
+		}
+	}
+}
+
+func TestHumanSizes(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{humanSize(0), "0B"},
+		{humanSize(999), "999B"},
+		{humanSize(1000), "1kB"},
+		{humanSize(187654321), "187.7MB"},
+		{bytesSize(1 << 30), "1GiB"},
+		{bytesSize(1536), "1.5KiB"},
+		{shortID("sha256:0123456789abcdef"), "0123456789ab"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("got %q, want %q", test.got, test.want)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Container engine of an environment. Docker is talked to over its Engine API,
+// Podman and nerdctl through their CLI.
+type EngineKind string
+
+const (
+	EngineDocker  EngineKind = "docker"
+	EnginePodman  EngineKind = "podman"
+	EngineNerdctl EngineKind = "nerdctl"
+)
+
+// What the handlers need from a container engine, in the shapes of the Docker Engine API
+type Engine interface {
+	ContainerList(ctx context.Context, all bool, filters map[string][]string) ([]ContainerSummary, error)
+	ContainerStart(ctx context.Context, id string) error
+	ContainerStop(ctx context.Context, id string) error
+	ContainerRestart(ctx context.Context, id string) error
+	ContainerPause(ctx context.Context, id string) error
+	ContainerUnpause(ctx context.Context, id string) error
+	ContainerKill(ctx context.Context, id, signal string) error
+	ContainerRemove(ctx context.Context, id string, options ContainerRemoveOptions) error
+	ContainerRename(ctx context.Context, id, name string) error
+	ContainerLogs(ctx context.Context, id string, tail int, timestamps bool) ([]string, error)
+	ContainerUsage(ctx context.Context, id string) (ContainerUsage, error)
+	ContainerInspect(ctx context.Context, id string) (ContainerDetails, error)
+	ContainerAddress(ctx context.Context, id string) (string, error)
+	ImageList(ctx context.Context) ([]ImageSummary, error)
+	VolumeList(ctx context.Context) ([]Volume, error)
+	VolumeRemove(ctx context.Context, name string) error
+	NetworkList(ctx context.Context) ([]Network, error)
+	NetworkRemove(ctx context.Context, id string) error
+	Info(ctx context.Context) (DockerInfo, error)
+	Version(ctx context.Context) (DockerVersion, error)
+	SpaceUsage(ctx context.Context) (SpaceUsage, error)
+	Events(ctx context.Context, since, until time.Time, limit int) ([]EventMessage, error) // The last limit of them
+}
+
+// How a container is removed
+type ContainerRemoveOptions struct {
+	Force   bool // Kill it first when it is running
+	Volumes bool // Remove its anonymous volumes along with it
+}
+
+// Resource usage of a running container
+type ContainerUsage struct {
+	CPUPercent  float64
+	MemoryUsage uint64
+	MemoryLimit uint64
+	NetworkRx   uint64
+	NetworkTx   uint64
+	BlockRead   uint64
+	BlockWrite  uint64
+}
+
+// Space taken by images and volumes
+type SpaceUsage struct {
+	Images  int64
+	Volumes int64
+}
+
+// Returned for an operation an engine has no way to perform
+type UnsupportedOperationError struct {
+	Engine    EngineKind
+	Operation string
+}
+
+func (e *UnsupportedOperationError) Error() string {
+	return fmt.Sprintf("%s does not support %s", e.Engine, e.Operation)
+}
+
+// A CLI command of an engine that exited with an error
+type EngineError struct {
+	Engine  EngineKind
+	Message string
+}
+
+func (e *EngineError) Error() string {
+	return fmt.Sprintf("%s error: %s", e.Engine, e.Message)
+}
+
+// Whether the command failed because the object it was given does not exist
+func (e *EngineError) NotFound() bool {
+	message := strings.ToLower(e.Message)
+	return strings.Contains(message, "no such") || strings.Contains(message, "not found")
+}
+
+// Whether the command failed because of the state the object is in, like pausing a stopped container
+func (e *EngineError) Conflict() bool {
+	message := strings.ToLower(e.Message)
+	for _, reason := range []string{"is not running", "is not paused", "is already paused", "is paused", "already in use", "is running", "running status"} {
+		if strings.Contains(message, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// The engine of a target, reached over its SSH connection as its privilege mode says
+func (m *SSHTunnelManager) Engine(target SSHTarget) (Engine, error) {
+	if target.engine() == EngineDocker {
+		return m.Docker(target)
+	}
+
+	if err := target.DockerAccess.Validate(); err != nil {
+		return nil, err
+	}
+	if _, _, err := m.usableConnection(target); err != nil {
+		return nil, err
+	}
+	return newCLIEngine(m, target), nil
+}
+
+// An engine driven through its CLI; the CLIs keep no state, so neither does this
+func newCLIEngine(runner commandRunner, target SSHTarget) Engine {
+	if target.engine() == EngineNerdctl {
+		return &nerdctlEngine{engineCLI{runner: runner, target: target, kind: EngineNerdctl}}
+	}
+	return &podmanEngine{engineCLI{runner: runner, target: target, kind: EnginePodman}}
+}
+
+// Runs the CLI of an engine on a target with the privileges of its mode
+type engineCLI struct {
+	runner commandRunner
+	target SSHTarget
+	kind   EngineKind
+}
+
+// Stdout of a CLI command; stderr only explains a failure, warnings there do not spoil the output
+func (c engineCLI) output(ctx context.Context, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	if err := c.run(ctx, &stdout, nil, args...); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Stdout and stderr of a CLI command merged, as a container's logs are written to both
+func (c engineCLI) combinedOutput(ctx context.Context, args ...string) ([]byte, error) {
+	var output bytes.Buffer
+	shared := &syncWriter{w: &output}
+	if err := c.run(ctx, shared, shared, args...); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// Run a CLI command, also passing stderr to the given writer unless it is nil
+func (c engineCLI) run(ctx context.Context, stdout, stderr io.Writer, args ...string) error {
+	var input []byte
+	if c.target.Privilege == PrivilegeSudoPassword {
+		var err error
+		input, err = sudoPasswordInput(ctx, c.runner, c.target)
+		if err != nil {
+			return err
+		}
+		defer wipeBytes(input)
+	}
+
+	tail := &stderrTail{}
+	stderrWriter := io.Writer(tail)
+	if stderr != nil {
+		stderrWriter = io.MultiWriter(stderr, tail)
+	}
+
+	command := c.target.DockerAccess.command(string(c.kind), args...)
+	err := c.runner.runCommand(ctx, c.target, command, input, stdout, stderrWriter)
+	var exitErr exitStatusError
+	if err != nil && errors.As(err, &exitErr) {
+		message := tail.String()
+		if message == "" {
+			message = exitErr.Error()
+		}
+		return &EngineError{Engine: c.kind, Message: message}
+	}
+	return err
+}
+
+// Run a lifecycle command on one container, which both CLIs name and flag like the docker CLI
+func (c engineCLI) containerCommand(ctx context.Context, command, id string, flags []string, args ...string) error {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return err
+	}
+	_, err := c.output(ctx, append(append(append([]string{command}, flags...), id), args...)...)
+	return err
+}
+
+// Flags of rm for the remove options
+func removeFlags(options ContainerRemoveOptions) []string {
+	var flags []string
+	if options.Force {
+		flags = append(flags, "--force")
+	}
+	if options.Volumes {
+		flags = append(flags, "--volumes")
+	}
+	return flags
+}
+
+// Configuration and state of a container, which both CLIs print in the shape of the Engine API
+func (c engineCLI) containerInspect(ctx context.Context, id string) (ContainerDetails, error) {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return ContainerDetails{}, err
+	}
+	output, err := c.output(ctx, "container", "inspect", id)
+	if err != nil {
+		return ContainerDetails{}, err
+	}
+	details, err := decodeJSONList[ContainerDetails](output)
+	if err != nil {
+		return ContainerDetails{}, err
+	}
+	if len(details) == 0 {
+		return ContainerDetails{}, &EngineError{Engine: c.kind, Message: "no such container: " + id}
+	}
+	return details[0], nil
+}
+
+// IP address of a container from inspect
+func (c engineCLI) containerAddress(ctx context.Context, id string) (string, error) {
+	details, err := c.containerInspect(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return details.address()
+}
+
+// Values of a CLI's JSON output, printed either as one array or as one object per line
+func decodeJSONList[T any](data []byte) ([]T, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+
+	if data[0] == '[' {
+		var list []T
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("unexpected output: %w", err)
+		}
+		return list, nil
+	}
+
+	var list []T
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var value T
+		if err := decoder.Decode(&value); err != nil {
+			if errors.Is(err, io.EOF) {
+				return list, nil
+			}
+			return list, fmt.Errorf("unexpected output: %w", err)
+		}
+		list = append(list, value)
+	}
+}
+
+// Decode one JSON document printed by a CLI
+func decodeJSON(data []byte, out interface{}) error {
+	if err := json.Unmarshal(bytes.TrimSpace(data), out); err != nil {
+		return fmt.Errorf("unexpected output: %w", err)
+	}
+	return nil
+}
+
+// CLI flags for filters in the map form the Engine API takes, in a stable order
+func filterFlags(filters map[string][]string) []string {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var flags []string
+	for _, key := range keys {
+		for _, value := range filters[key] {
+			flags = append(flags, "--filter", key+"="+value)
+		}
+	}
+	return flags
+}
+
+// A copy of filters that can be added to without touching the caller's
+func copyFilters(filters map[string][]string) map[string][]string {
+	copied := make(map[string][]string, len(filters))
+	for key, values := range filters {
+		copied[key] = append([]string{}, values...)
+	}
+	return copied
+}
+
+// Labels printed either as an object or as "a=1,b=2"
+type cliLabels map[string]string
+
+func (l *cliLabels) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*l = parseLabels(text)
+		return nil
+	}
+	var labels map[string]string
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return err
+	}
+	*l = labels
+	return nil
+}
+
+// A container state like "running" from a STATUS column like "Up 2 hours"
+func stateFromStatus(status string) string {
+	status = strings.ToLower(status)
+	switch {
+	case strings.HasPrefix(status, "up"):
+		if strings.Contains(status, "paused") {
+			return "paused"
+		}
+		return "running"
+	case strings.HasPrefix(status, "exited"):
+		return "exited"
+	case strings.HasPrefix(status, "created"):
+		return "created"
+	case strings.HasPrefix(status, "restarting"):
+		return "restarting"
+	}
+	return status
+}
+
+// A time printed as Unix seconds or nanoseconds, or as a date string; kept as Unix seconds
+type cliTime int64
+
+// Layouts of the date strings, RFC 3339 and the String form of a Go time
+var cliTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999 -0700 MST"}
+
+func (t *cliTime) UnmarshalJSON(data []byte) error {
+	var number int64
+	if err := json.Unmarshal(data, &number); err == nil {
+		// Nothing happened before 1973 in seconds, so larger values are nanoseconds
+		if number > 1e11 {
+			number /= int64(time.Second)
+		}
+		*t = cliTime(number)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	for _, layout := range cliTimeLayouts {
+		if parsed, err := time.Parse(layout, text); err == nil {
+			*t = cliTime(parsed.Unix())
+			return nil
+		}
+	}
+	// Relative times like "2 hours ago" are left out
+	*t = 0
+	return nil
+}
+
+// A size printed as a byte count or as "7.6 MiB"
+type cliSize int64
+
+func (s *cliSize) UnmarshalJSON(data []byte) error {
+	var number int64
+	if err := json.Unmarshal(data, &number); err == nil {
+		*s = cliSize(number)
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	size, _ := parseSize(text)
+	*s = cliSize(size)
+	return nil
+}
+
+// Usage as printed by docker stats and the CLIs that copy its columns
+type cliStats struct {
+	CPUPerc  string `json:"CPUPerc"`
+	MemUsage string `json:"MemUsage"`
+	NetIO    string `json:"NetIO"`
+	BlockIO  string `json:"BlockIO"`
+}
+
+func (s cliStats) usage() ContainerUsage {
+	usage := ContainerUsage{CPUPercent: parsePercent(s.CPUPerc)}
+	usage.MemoryUsage, usage.MemoryLimit = parseSizePair(s.MemUsage)
+	usage.NetworkRx, usage.NetworkTx = parseSizePair(s.NetIO)
+	usage.BlockRead, usage.BlockWrite = parseSizePair(s.BlockIO)
+	return usage
+}
+
+// Flags for the log options the handlers take
+func logFlags(tail int, timestamps bool) []string {
+	var flags []string
+	if tail > 0 {
+		flags = append(flags, "--tail", strconv.Itoa(tail))
+	}
+	if timestamps {
+		flags = append(flags, "--timestamps")
+	}
+	return flags
+}
+
+// Log output split into lines, like the Docker client returns it
+func logLines(output []byte) []string {
+	lines := strings.Split(string(output), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
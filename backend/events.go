@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind of tunnel state transition
+type TunnelEventType string
+
+const (
+	EventOpened      TunnelEventType = "opened"
+	EventClosed      TunnelEventType = "closed"
+	EventIdleReaped  TunnelEventType = "idle-reaped"
+	EventDegraded    TunnelEventType = "degraded"
+	EventRecovered   TunnelEventType = "recovered"
+	EventBroken      TunnelEventType = "broken"
+	EventReconnected TunnelEventType = "reconnected"
+	EventFailed      TunnelEventType = "failed"
+)
+
+const (
+	// Events a subscriber may fall behind by before it starts missing them
+	eventBufferSize = 64
+
+	// Comment lines keep idle streams from being cut by proxies
+	eventHeartbeatInterval = 15 * time.Second
+)
+
+// A state transition of a tunnel, as pushed on /tunnel/events
+type TunnelEvent struct {
+	Type       TunnelEventType `json:"type"`
+	Connection string          `json:"connection"`
+	Target     string          `json:"target"`
+	State      ConnectionState `json:"state,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Time       time.Time       `json:"time"`
+}
+
+// Fans tunnel events out to every subscriber
+type EventBroker struct {
+	mutex       sync.Mutex
+	subscribers map[chan TunnelEvent]struct{}
+}
+
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: make(map[chan TunnelEvent]struct{})}
+}
+
+// Receive every event published from now on; call the returned function to stop
+func (b *EventBroker) Subscribe() (<-chan TunnelEvent, func()) {
+	events := make(chan TunnelEvent, eventBufferSize)
+
+	b.mutex.Lock()
+	b.subscribers[events] = struct{}{}
+	b.mutex.Unlock()
+
+	return events, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, exists := b.subscribers[events]; exists {
+			delete(b.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// Hand an event to every subscriber without ever blocking the publisher
+func (b *EventBroker) Publish(event TunnelEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+			logger.Warnf("Dropping %s event for %s, subscriber is not keeping up", event.Type, event.Connection)
+		}
+	}
+}
+
+// Publish a transition of a connection; the caller must hold the manager mutex
+func (m *SSHTunnelManager) publishLocked(eventType TunnelEventType, key string, conn *SSHConnection) {
+	event := TunnelEvent{
+		Type:       eventType,
+		Connection: key,
+		Target:     conn.Target.String(),
+	}
+	if conn.Active {
+		event.State = conn.State
+	}
+	if conn.lastErr != nil {
+		event.Error = conn.lastErr.Error()
+	}
+	m.events.Publish(event)
+}
+
+// Get the broker tunnel events are published on
+func (m *SSHTunnelManager) Events() *EventBroker {
+	return m.events
+}
+
+// Relay /tunnel/events of a running backend to stdout, one JSON event per line.
+// The UI runs this inside the extension container, where it can stream command output.
+func relayTunnelEvents(socketPath string) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	resp, err := client.Get("http://backend/tunnel/events")
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to tunnel events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to subscribe to tunnel events: %s", resp.Status)
+	}
+
+	// Only the data lines matter, every payload carries its own type
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+			fmt.Fprintln(os.Stdout, data)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Local ports forwards listen on; docker-compose.yaml publishes the same range on the
+// localhost of the machine running Docker Desktop
+const (
+	forwardPortMin = 41000
+	forwardPortMax = 41019
+)
+
+// A local port to forward to a port of the remote host or of a container, over the SSH connection
+type ForwardRequest struct {
+	SSHTarget
+	LocalPort   int    `json:"localPort,omitempty"`  // The first free port of the range when left out
+	RemoteHost  string `json:"remoteHost,omitempty"` // As seen from the remote host, 127.0.0.1 when left out
+	RemotePort  int    `json:"remotePort"`
+	ContainerId string `json:"containerId,omitempty"` // Forward to the address of this container, unless RemoteHost is set to reach a port it publishes
+}
+
+// Returned for a forward that cannot be made whatever the state of the connection
+type InvalidForwardError struct {
+	Reason string
+}
+
+func (e *InvalidForwardError) Error() string {
+	return "invalid port forward: " + e.Reason
+}
+
+// Check the parts of a request that do not depend on the connection
+func (r ForwardRequest) validate() error {
+	if r.transport() != TransportSSH {
+		return &UnsupportedTransportError{Transport: r.transport(), Operation: "port forwarding"}
+	}
+	if r.RemotePort < 1 || r.RemotePort > 65535 {
+		return &InvalidForwardError{Reason: fmt.Sprintf("remote port %d is out of range", r.RemotePort)}
+	}
+	if r.LocalPort != 0 && (r.LocalPort < forwardPortMin || r.LocalPort > forwardPortMax) {
+		return &InvalidForwardError{Reason: fmt.Sprintf("local port must be between %d and %d, the ports the extension publishes", forwardPortMin, forwardPortMax)}
+	}
+	if r.ContainerId != "" {
+		if err := ValidateIdentifier(ContainerObject, r.ContainerId); err != nil {
+			return err
+		}
+	}
+	if strings.ContainsAny(r.RemoteHost, " \t\r\n/") {
+		return &InvalidForwardError{Reason: fmt.Sprintf("invalid remote host %q", r.RemoteHost)}
+	}
+	return nil
+}
+
+// Returned for a local port that is taken, or a remote end that is forwarded already
+type ForwardConflictError struct {
+	LocalPort int
+	Forward   string // What the local port forwards to, when it is one of ours
+}
+
+func (e *ForwardConflictError) Error() string {
+	switch {
+	case e.LocalPort == 0:
+		return fmt.Sprintf("every local port from %d to %d is in use", forwardPortMin, forwardPortMax)
+	case e.Forward != "":
+		return fmt.Sprintf("local port %d already forwards to %s", e.LocalPort, e.Forward)
+	}
+	return fmt.Sprintf("local port %d is in use", e.LocalPort)
+}
+
+// Returned for a local port that is not forwarded
+type ForwardNotFoundError struct {
+	LocalPort int
+}
+
+func (e *ForwardNotFoundError) Error() string {
+	return fmt.Sprintf("local port %d is not forwarded", e.LocalPort)
+}
+
+// What a forward leads to
+type ForwardKind string
+
+const (
+	ForwardPort   ForwardKind = "port"   // A TCP port of the remote host or of a container
+	ForwardDocker ForwardKind = "docker" // The Docker daemon, reached as the environment's privilege mode says
+)
+
+// Whether connections to a forward reach its remote end
+type ForwardState string
+
+const (
+	ForwardActive  ForwardState = "active"  // Connections are forwarded
+	ForwardWaiting ForwardState = "waiting" // The tunnel is down, connections are refused until it is back
+)
+
+// A forward as listed by /forwards
+type PortForward struct {
+	Kind        ForwardKind  `json:"kind"`
+	LocalPort   int          `json:"localPort"`
+	Connection  string       `json:"connection"`
+	Target      string       `json:"target"`
+	RemoteHost  string       `json:"remoteHost,omitempty"`
+	RemotePort  int          `json:"remotePort,omitempty"`
+	ContainerId string       `json:"containerId,omitempty"`
+	State       ForwardState `json:"state"`
+	Streams     int          `json:"streams"` // Connections being forwarded right now
+	LastError   string       `json:"lastError,omitempty"`
+	Created     time.Time    `json:"created"`
+}
+
+// A listening forward; lives as long as the connection it belongs to, across reconnects
+type portForward struct {
+	PortForward
+
+	target   SSHTarget // As requested, to look the container up again
+	lookup   bool      // RemoteHost is the address of the container, which changes when it restarts
+	conn     *SSHConnection
+	listener net.Listener
+	streams  map[net.Conn]struct{}
+	lastErr  error
+}
+
+// What the forward dials on the remote side; the caller must hold the mutex
+func (f *portForward) addressLocked() string {
+	if f.Kind == ForwardDocker {
+		return "the Docker daemon"
+	}
+	return net.JoinHostPort(f.RemoteHost, strconv.Itoa(f.RemotePort))
+}
+
+// Snapshot of the forward; the caller must hold the mutex
+func (f *portForward) statusLocked() PortForward {
+	status := f.PortForward
+	status.State = ForwardActive
+	if !f.conn.State.usable() {
+		status.State = ForwardWaiting
+	}
+	status.Streams = len(f.streams)
+	if f.lastErr != nil {
+		status.LastError = f.lastErr.Error()
+	}
+	return status
+}
+
+// Listen on a local port and forward what connects to it to the remote end of the request
+func (m *SSHTunnelManager) OpenForward(ctx context.Context, req ForwardRequest) (PortForward, error) {
+	if err := req.validate(); err != nil {
+		return PortForward{}, err
+	}
+	conn, _, err := m.usableConnection(req.SSHTarget)
+	if err != nil {
+		return PortForward{}, err
+	}
+
+	remoteHost := req.RemoteHost
+	lookup := req.ContainerId != "" && remoteHost == ""
+	if lookup {
+		if remoteHost, err = m.containerAddress(ctx, req.SSHTarget, req.ContainerId); err != nil {
+			return PortForward{}, err
+		}
+	} else if remoteHost == "" {
+		remoteHost = "127.0.0.1"
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := connectionKey(req.SSHTarget)
+	if !conn.Active {
+		return PortForward{}, fmt.Errorf("connection to %s was closed", key)
+	}
+	for _, existing := range m.forwards {
+		if existing.conn == conn && existing.RemoteHost == remoteHost && existing.RemotePort == req.RemotePort {
+			return PortForward{}, &ForwardConflictError{LocalPort: existing.LocalPort, Forward: existing.addressLocked()}
+		}
+	}
+
+	forward := &portForward{
+		PortForward: PortForward{
+			Kind:        ForwardPort,
+			Connection:  key,
+			Target:      conn.Target.String(),
+			RemoteHost:  remoteHost,
+			RemotePort:  req.RemotePort,
+			ContainerId: req.ContainerId,
+		},
+		target: req.SSHTarget,
+		lookup: lookup,
+		conn:   conn,
+	}
+	if err := m.startForwardLocked(forward, req.LocalPort); err != nil {
+		return PortForward{}, err
+	}
+	return forward.statusLocked(), nil
+}
+
+// Listen on the local port of a new forward and start serving it; the caller must hold the mutex
+func (m *SSHTunnelManager) startForwardLocked(forward *portForward, localPort int) error {
+	listener, port, err := m.listenForwardLocked(localPort)
+	if err != nil {
+		return err
+	}
+
+	forward.LocalPort = port
+	forward.Created = time.Now()
+	forward.listener = listener
+	forward.streams = make(map[net.Conn]struct{})
+	m.forwards[port] = forward
+	m.background(func() { m.serveForward(forward) })
+
+	logger.Infof("Forwarding local port %d to %s on %s", port, forward.addressLocked(), forward.Connection)
+	return nil
+}
+
+// Listen on the requested port, or on the first free one of the range; the caller must hold the mutex
+func (m *SSHTunnelManager) listenForwardLocked(port int) (net.Listener, int, error) {
+	if port != 0 {
+		if existing, exists := m.forwards[port]; exists {
+			return nil, 0, &ForwardConflictError{LocalPort: port, Forward: existing.addressLocked()}
+		}
+		listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return nil, 0, &ForwardConflictError{LocalPort: port}
+		}
+		return listener, port, err
+	}
+
+	for port := forwardPortMin; port <= forwardPortMax; port++ {
+		if _, exists := m.forwards[port]; exists {
+			continue
+		}
+		if listener, err := net.Listen("tcp", ":"+strconv.Itoa(port)); err == nil {
+			return listener, port, nil
+		}
+	}
+	return nil, 0, &ForwardConflictError{}
+}
+
+// IP address of a container on the remote host
+func (m *SSHTunnelManager) containerAddress(ctx context.Context, target SSHTarget, id string) (string, error) {
+	engine, err := m.Engine(target)
+	if err != nil {
+		return "", err
+	}
+	return engine.ContainerAddress(ctx, id)
+}
+
+// Accept connections until the forward is closed. Each one is dialed over the client the
+// connection has at that moment, so a forward carries on by itself once a tunnel is reconnected.
+func (m *SSHTunnelManager) serveForward(forward *portForward) {
+	for {
+		local, err := forward.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		// The Docker daemon of a TCP+TLS environment is dialed without an SSH client
+		m.mutex.Lock()
+		conn := forward.conn
+		client := conn.Client
+		if _, open := m.forwards[forward.LocalPort]; !open || !conn.State.usable() || (client == nil && forward.Kind == ForwardPort) {
+			forward.lastErr = &ConnectionNotReadyError{Target: conn.Target.String(), State: conn.State, LastError: conn.lastErr, NextRetry: conn.nextRetry}
+			m.mutex.Unlock()
+			local.Close()
+			continue
+		}
+		conn.LastUsed = time.Now()
+		forward.streams[local] = struct{}{}
+		m.mutex.Unlock()
+
+		m.background(func() { m.forwardStream(forward, client, local) })
+	}
+}
+
+// Carry one accepted connection to the remote end of the forward
+func (m *SSHTunnelManager) forwardStream(forward *portForward, client *ssh.Client, local net.Conn) {
+	defer func() {
+		local.Close()
+		m.mutex.Lock()
+		delete(forward.streams, local)
+		m.mutex.Unlock()
+	}()
+
+	// The Docker endpoint only serves the docker CLI of this machine, not pages in a browser
+	var consumed []byte
+	if forward.Kind == ForwardDocker {
+		var allowed bool
+		consumed, allowed = checkDockerEndpointHost(local, forward.target.connectTimeout())
+		if !allowed {
+			return
+		}
+	}
+
+	remote, err := m.dialForward(forward, client)
+
+	m.mutex.Lock()
+	forward.lastErr = err
+	address := forward.addressLocked()
+	m.mutex.Unlock()
+	if err != nil {
+		logger.Warnf("Failed to forward local port %d to %s: %v", forward.LocalPort, address, err)
+		return
+	}
+	defer remote.Close()
+
+	if _, err := remote.Write(consumed); err != nil {
+		return
+	}
+	pipe(local, remote)
+}
+
+// Open the remote end of a forward for one accepted connection
+func (m *SSHTunnelManager) dialForward(forward *portForward, client *ssh.Client) (net.Conn, error) {
+	if forward.Kind == ForwardDocker {
+		docker, err := m.Docker(forward.target)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := withOperationTimeout(context.Background(), "connecting to Docker", forward.target.connectTimeout())
+		defer cancel()
+		return docker.dial(ctx)
+	}
+
+	m.mutex.Lock()
+	address := forward.addressLocked()
+	m.mutex.Unlock()
+
+	remote, err := client.Dial("tcp", address)
+	if err != nil && forward.lookup {
+		// The container may have been restarted with another address
+		ctx, cancel := withOperationTimeout(context.Background(), "looking up container address", dockerInspectTimeout)
+		host, lookupErr := m.containerAddress(ctx, forward.target, forward.ContainerId)
+		cancel()
+		if lookupErr == nil {
+			m.mutex.Lock()
+			forward.RemoteHost = host
+			address = forward.addressLocked()
+			m.mutex.Unlock()
+			remote, err = client.Dial("tcp", address)
+		}
+	}
+	return remote, err
+}
+
+// Half of a connection that can be closed for writing only
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Copy both ways until both sides are done, passing on when one side stops writing
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if half, ok := dst.(closeWriter); ok {
+			half.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+}
+
+// Every forward, by local port
+func (m *SSHTunnelManager) Forwards() []PortForward {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	forwards := make([]PortForward, 0, len(m.forwards))
+	for _, forward := range m.forwards {
+		forwards = append(forwards, forward.statusLocked())
+	}
+	sort.Slice(forwards, func(i, j int) bool {
+		return forwards[i].LocalPort < forwards[j].LocalPort
+	})
+	return forwards
+}
+
+// Stop forwarding a local port, cutting the connections it carries
+func (m *SSHTunnelManager) CloseForward(localPort int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	forward, exists := m.forwards[localPort]
+	if !exists {
+		return &ForwardNotFoundError{LocalPort: localPort}
+	}
+	logger.Infof("Closing forward of local port %d", localPort)
+	m.closeForwardLocked(forward)
+	return nil
+}
+
+// The caller must hold the mutex
+func (m *SSHTunnelManager) closeForwardLocked(forward *portForward) {
+	forward.listener.Close()
+	for stream := range forward.streams {
+		stream.Close()
+	}
+	delete(m.forwards, forward.LocalPort)
+}
+
+// Close the forwards of a connection that is torn down; the caller must hold the mutex
+func (m *SSHTunnelManager) closeForwardsLocked(conn *SSHConnection) {
+	for _, forward := range m.forwards {
+		if forward.conn == conn {
+			logger.Infof("Closing forward of local port %d with its connection", forward.LocalPort)
+			m.closeForwardLocked(forward)
+		}
+	}
+}
+
+// Whether a connection carries forwards, which keep it from being closed as idle; the caller must hold the mutex
+func (m *SSHTunnelManager) hasForwardsLocked(conn *SSHConnection) bool {
+	for _, forward := range m.forwards {
+		if forward.conn == conn {
+			return true
+		}
+	}
+	return false
+}
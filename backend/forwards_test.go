@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// GET a path of the router into out
+func getJSON(t *testing.T, router http.Handler, path string, out interface{}) {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+		t.Fatalf("GET %s answered %d with %q: %v", path, recorder.Code, recorder.Body.String(), err)
+	}
+}
+
+// Ping the Engine API of the test server through a forwarded local port
+func pingForward(port int) error {
+	client := http.Client{Timeout: 5 * time.Second}
+	response, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/_ping", port))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if string(body) != "OK" {
+		return fmt.Errorf("ping answered %q", body)
+	}
+	return nil
+}
+
+func TestPortForward(t *testing.T) {
+	api := fakeDockerAPI{
+		"GET /containers/web/json": {body: `{"Id":"0123456789abcdef","Name":"/web","NetworkSettings":{"Networks":{"shop":{"IPAddress":"172.18.0.5"}}}}`},
+	}
+	server := startSSHServer(t, newFakeExecutor(t, nil), api)
+	manager := server.manager(t)
+	router := newTestRouter(manager)
+	target := server.target()
+
+	var opened struct {
+		Error   string      `json:"error"`
+		Forward PortForward `json:"forward"`
+	}
+	request := ForwardRequest{SSHTarget: target, ContainerId: "web", RemotePort: 80}
+	if code := postJSON(t, router, "/forwards", request, &opened); code != http.StatusOK {
+		t.Fatalf("opening the forward answered %d: %s", code, opened.Error)
+	}
+	forward := opened.Forward
+	if forward.RemoteHost != "172.18.0.5" || forward.LocalPort < forwardPortMin || forward.LocalPort > forwardPortMax {
+		t.Errorf("forward = %+v, want a port of the range to the address of the container", forward)
+	}
+	if err := pingForward(forward.LocalPort); err != nil {
+		t.Fatalf("forwarded port: %v", err)
+	}
+
+	// The same remote end, or the same local port, is not forwarded twice
+	if code := postJSON(t, router, "/forwards", request, &opened); code != http.StatusConflict {
+		t.Errorf("forwarding the container port again answered %d", code)
+	}
+	taken := ForwardRequest{SSHTarget: target, LocalPort: forward.LocalPort, RemotePort: 5432}
+	if code := postJSON(t, router, "/forwards", taken, &opened); code != http.StatusConflict {
+		t.Errorf("forwarding a taken local port answered %d", code)
+	}
+
+	// Once the tunnel is back, the forward carries on by itself
+	events, unsubscribe := manager.Events().Subscribe()
+	defer unsubscribe()
+	server.dropConnections()
+	deadline := time.After(defaultKeepaliveInterval)
+	for reconnected := false; !reconnected; {
+		select {
+		case event := <-events:
+			reconnected = event.Type == EventReconnected
+		case <-deadline:
+			t.Fatal("the tunnel did not reconnect")
+		}
+	}
+	if err := pingForward(forward.LocalPort); err != nil {
+		t.Errorf("forwarded port after reconnecting: %v", err)
+	}
+
+	var listed struct {
+		Forwards []PortForward `json:"forwards"`
+	}
+	getJSON(t, router, "/forwards", &listed)
+	if len(listed.Forwards) != 1 || listed.Forwards[0].State != ForwardActive {
+		t.Errorf("forwards = %+v, want the one active forward", listed.Forwards)
+	}
+
+	// Closing the tunnel closes its forwards
+	if code := postJSON(t, router, "/tunnel/close", target, nil); code != http.StatusOK {
+		t.Fatalf("closing the tunnel answered %d", code)
+	}
+	getJSON(t, router, "/forwards", &listed)
+	if len(listed.Forwards) != 0 {
+		t.Errorf("forwards after closing the tunnel = %+v", listed.Forwards)
+	}
+	if err := pingForward(forward.LocalPort); err == nil {
+		t.Errorf("local port %d still forwarded after closing the tunnel", forward.LocalPort)
+	}
+}
+
+func TestDockerEndpoint(t *testing.T) {
+	server := startSSHServer(t, newFakeExecutor(t, nil), fakeDockerAPI{})
+	router := newTestRouter(server.manager(t))
+	target := server.target()
+
+	var opened struct {
+		Error   string        `json:"error"`
+		Forward PortForward   `json:"forward"`
+		Context DockerContext `json:"context"`
+	}
+	request := DockerEndpointRequest{SSHTarget: target}
+	if code := postJSON(t, router, "/forwards/docker", request, &opened); code != http.StatusOK {
+		t.Fatalf("opening the endpoint answered %d: %s", code, opened.Error)
+	}
+	port := opened.Forward.LocalPort
+	if err := pingForward(port); err != nil {
+		t.Fatalf("Docker endpoint: %v", err)
+	}
+
+	// A page that rebound its own name to the loopback address is refused
+	rebound, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/_ping", port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebound.Host = fmt.Sprintf("attacker.example:%d", port)
+	// On a connection of its own, as a browser would
+	response, err := (&http.Client{Transport: &http.Transport{}, Timeout: 5 * time.Second}).Do(rebound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("request for another host answered %d, want %d", response.StatusCode, http.StatusForbidden)
+	}
+	if err := pingForward(port); err != nil {
+		t.Errorf("Docker endpoint after refusing a request: %v", err)
+	}
+
+	// What docker context import reads
+	archive := tar.NewReader(bytes.NewReader(opened.Context.Archive))
+	header, err := archive.Next()
+	if err != nil || header.Name != "meta.json" {
+		t.Fatalf("archive starts with %v (%v), want meta.json", header, err)
+	}
+	var meta dockerContextMeta
+	if err := json.NewDecoder(archive).Decode(&meta); err != nil {
+		t.Fatal(err)
+	}
+	wantHost := fmt.Sprintf("tcp://127.0.0.1:%d", port)
+	if meta.Name != "remote-127.0.0.1" || meta.Endpoints["docker"].Host != wantHost {
+		t.Errorf("meta.json = %+v, want remote-127.0.0.1 at %s", meta, wantHost)
+	}
+
+	// One endpoint per connection
+	if code := postJSON(t, router, "/forwards/docker", request, &opened); code != http.StatusOK || opened.Forward.LocalPort != port {
+		t.Errorf("opening the endpoint again answered %d with port %d, want %d", code, opened.Forward.LocalPort, port)
+	}
+
+	request.ContextName = "prod; rm -rf /"
+	if code := postJSON(t, router, "/forwards/docker", request, &opened); code != http.StatusBadRequest {
+		t.Errorf("an invalid context name answered %d", code)
+	}
+
+	if code := postJSON(t, router, "/forwards/remove", CloseForwardRequest{LocalPort: port}, nil); code != http.StatusOK {
+		t.Errorf("removing the endpoint answered %d", code)
+	}
+	if err := pingForward(port); err == nil {
+		t.Errorf("local port %d still forwarded after removing it", port)
+	}
+}
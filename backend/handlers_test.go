@@ -0,0 +1,689 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Output of hostUsageCommand: 50% CPU between the samples, 75% of the memory and 42% of the disk in use
+const hostUsageOutput = `cpu  100 0 100 700 100 0 0 0
+cpu  150 0 150 750 150 0 0 0
+MemTotal:        2000000 kB
+MemAvailable:     500000 kB
+Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/sda1         10000000 4200000   5800000      42% /
+`
+
+// Targets for each engine; only the fields the handlers check are needed
+func engineTarget(engine EngineKind) SSHTarget {
+	return SSHTarget{Hostname: "docker.example.com", Username: "deploy", DockerAccess: DockerAccess{Engine: engine}}
+}
+
+func TestDashboardResources(t *testing.T) {
+	hostUsage := map[string]scriptedCommand{hostUsageCommand.String(): {stdout: hostUsageOutput}}
+	want := func(containers ...ContainerResource) ResourcesResponse {
+		var response ResourcesResponse
+		response.Containers = containers
+		response.System.CPUUsage = 50
+		response.System.MemoryUsage = 75
+		response.System.DiskUsage = 42
+		return response
+	}
+
+	tests := []struct {
+		name   string
+		engine EngineKind
+		api    fakeDockerAPI
+		script map[string]scriptedCommand
+		want   ResourcesResponse
+	}{
+		{
+			name:   "docker",
+			engine: EngineDocker,
+			api: fakeDockerAPI{
+				"GET /containers/json": {body: `[{"Id":"0123456789abcdef","Names":["/web"],"State":"running","Status":"Up 2 hours"}]`},
+				"GET /containers/0123456789abcdef/stats": {body: `{
+					"cpu_stats": {"cpu_usage": {"total_usage": 400}, "system_cpu_usage": 2000, "online_cpus": 2},
+					"precpu_stats": {"cpu_usage": {"total_usage": 200}, "system_cpu_usage": 1000},
+					"memory_stats": {"usage": 314572800, "limit": 1073741824, "stats": {"inactive_file": 104857600}},
+					"networks": {"eth0": {"rx_bytes": 1000, "tx_bytes": 2000}},
+					"blkio_stats": {"io_service_bytes_recursive": [{"op": "Read", "value": 3000000}, {"op": "Write", "value": 0}]}
+				}`},
+			},
+			script: hostUsage,
+			want: want(ContainerResource{
+				ID:       "0123456789ab",
+				Name:     "web",
+				CPUPerc:  "40.00%",
+				CPUUsage: 40,
+				MemUsage: "200MiB / 1GiB",
+				MemPerc:  "19.53%",
+				MemValue: 19.53125,
+				NetIO:    "1kB / 2kB",
+				BlockIO:  "3MB / 0B",
+			}),
+		},
+		{
+			name:   "podman",
+			engine: EnginePodman,
+			script: map[string]scriptedCommand{
+				hostUsageCommand.String(): {stdout: hostUsageOutput},
+				Command("podman", "ps", "--format", "json").String(): {
+					stdout: `[{"Id":"fedcba9876543210","Names":["db"],"State":"running","Status":"Up 5 minutes"}]`,
+				},
+				Command("podman", "stats", "--no-stream", "--format", "json", "fedcba9876543210").String(): {
+					stdout: `[{"cpu_percent":"12.50%","mem_usage":"256MiB / 1GiB","net_io":"1.5kB / 500B","block_io":"0B / 2MB"}]`,
+				},
+			},
+			want: want(ContainerResource{
+				ID:       "fedcba987654",
+				Name:     "db",
+				CPUPerc:  "12.50%",
+				CPUUsage: 12.5,
+				MemUsage: "256MiB / 1GiB",
+				MemPerc:  "25.00%",
+				MemValue: 25,
+				NetIO:    "1.5kB / 500B",
+				BlockIO:  "0B / 2MB",
+			}),
+		},
+		{
+			name:   "nerdctl with a container that stopped before it was sampled",
+			engine: EngineNerdctl,
+			script: map[string]scriptedCommand{
+				hostUsageCommand.String(): {stdout: hostUsageOutput},
+				Command("nerdctl", "ps", "--format", "{{json .}}").String(): {
+					stdout: `{"ID":"aaaaaaaaaaaa","Names":"gone","Status":"Up 1 second"}` + "\n",
+				},
+				Command("nerdctl", "stats", "--no-stream", "--format", "{{json .}}", "aaaaaaaaaaaa").String(): {
+					stderr: "no such container aaaaaaaaaaaa", status: 1,
+				},
+			},
+			want: want(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newTestRouter(newFakeTunnels(t, newFakeExecutor(t, test.script), test.api))
+
+			var got ResourcesResponse
+			if status := postJSON(t, router, "/dashboard/resources", engineTarget(test.engine), &got); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if got.Containers == nil {
+				t.Errorf("containers = null, want a list")
+			}
+			if len(got.Containers) == 0 && len(test.want.Containers) == 0 {
+				got.Containers, test.want.Containers = nil, nil
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("resources = %+v\nwant        %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDashboardEvents(t *testing.T) {
+	// What the dashboard shows of an event, leaving out the time string which depends on the time zone
+	type shown struct {
+		Time     int64
+		Type     string
+		Action   string
+		Actor    string
+		Message  string
+		Category string
+	}
+
+	tests := []struct {
+		name   string
+		engine EngineKind
+		api    fakeDockerAPI
+		script map[string]scriptedCommand
+		want   []shown
+	}{
+		{
+			name:   "docker",
+			engine: EngineDocker,
+			api: fakeDockerAPI{
+				"GET /events": {body: `{"Type":"container","Action":"start","Actor":{"ID":"abc","Attributes":{"name":"web"}},"from":"nginx","time":100}
+{"Type":"container","status":"die","id":"abc","from":"nginx","time":200}
+{"Type":"volume","Action":"destroy","Actor":{"ID":"data"},"time":300}
+`},
+			},
+			want: []shown{
+				{Time: 300, Type: "volume", Action: "destroy", Actor: "data", Category: "error"},
+				{Time: 200, Type: "container", Action: "die", Actor: "abc", Message: "nginx", Category: "warning"},
+				{Time: 100, Type: "container", Action: "start", Actor: "web", Message: "nginx", Category: "info"},
+			},
+		},
+		{
+			name:   "podman",
+			engine: EnginePodman,
+			script: map[string]scriptedCommand{
+				// Since and until follow the clock, so only the start of the command is matched
+				Command("podman", "events", "--format", "json").String(): {
+					stdout: `{"ID":"abc","Image":"nginx","Name":"web","Status":"kill","Time":"2024-01-02T03:04:05Z","Type":"container"}
+{"ID":"def","Image":"redis","Name":"cache","Status":"create","Time":1704164646000000000,"Type":"container"}
+`,
+				},
+			},
+			want: []shown{
+				{Time: 1704164646, Type: "container", Action: "create", Actor: "cache", Message: "redis", Category: "info"},
+				{Time: 1704164645, Type: "container", Action: "kill", Actor: "web", Message: "nginx", Category: "warning"},
+			},
+		},
+		{
+			name:   "nerdctl cannot list past events",
+			engine: EngineNerdctl,
+			want:   []shown{},
+		},
+		{
+			name:   "docker daemon failing",
+			engine: EngineDocker,
+			api:    fakeDockerAPI{"GET /events": {status: http.StatusInternalServerError, body: `{"message":"boom"}`}},
+			want:   []shown{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newTestRouter(newFakeTunnels(t, newFakeExecutor(t, test.script), test.api))
+
+			var response EventsResponse
+			if status := postJSON(t, router, "/dashboard/events", engineTarget(test.engine), &response); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if response.Events == nil {
+				t.Fatalf("events = null, want a list")
+			}
+
+			got := make([]shown, 0, len(response.Events))
+			for _, event := range response.Events {
+				got = append(got, shown{event.Time, event.Type, event.Action, event.Actor, event.Message, event.Category})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("events = %+v\nwant     %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDashboardEventsLimit(t *testing.T) {
+	// More events than the dashboard shows, of which only the last are kept
+	var docker, podman strings.Builder
+	for i := 1; i <= dashboardEventCount+5; i++ {
+		fmt.Fprintf(&docker, `{"Type":"container","Action":"start","Actor":{"ID":"c%d"},"time":%d}`+"\n", i, i)
+		fmt.Fprintf(&podman, `{"ID":"c%d","Status":"start","Time":%d000000000,"Type":"container"}`+"\n", i, i)
+	}
+
+	tests := []struct {
+		name   string
+		engine EngineKind
+		api    fakeDockerAPI
+		script map[string]scriptedCommand
+	}{
+		{name: "docker", engine: EngineDocker, api: fakeDockerAPI{"GET /events": {body: docker.String()}}},
+		{
+			name:   "podman",
+			engine: EnginePodman,
+			script: map[string]scriptedCommand{Command("podman", "events", "--format", "json").String(): {stdout: podman.String()}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newTestRouter(newFakeTunnels(t, newFakeExecutor(t, test.script), test.api))
+
+			var response EventsResponse
+			if status := postJSON(t, router, "/dashboard/events", engineTarget(test.engine), &response); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+
+			got := make([]string, 0, len(response.Events))
+			for _, event := range response.Events {
+				got = append(got, event.Actor)
+			}
+			var want []string
+			for i := dashboardEventCount + 5; i > 5; i-- {
+				want = append(want, fmt.Sprintf("c%d", i))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("actors = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestListNetworks(t *testing.T) {
+	tests := []struct {
+		name   string
+		engine EngineKind
+		api    fakeDockerAPI
+		script map[string]scriptedCommand
+		want   []map[string]interface{}
+	}{
+		{
+			name:   "docker",
+			engine: EngineDocker,
+			api: fakeDockerAPI{
+				"GET /networks": {body: `[
+					{"Id":"1111111111111111aaaa","Name":"bridge","Driver":"bridge","Scope":"local",
+					 "IPAM":{"Driver":"default","Config":[{"Subnet":"172.17.0.0/16","Gateway":"172.17.0.1"}]}},
+					{"Id":"2222222222222222bbbb","Name":"backend","Driver":"overlay","Scope":"swarm","Internal":true,"IPAM":{}}
+				]`},
+			},
+			want: []map[string]interface{}{
+				{"id": "111111111111", "name": "bridge", "driver": "bridge", "scope": "local", "ipamDriver": "default",
+					"subnet": "172.17.0.0/16", "gateway": "172.17.0.1", "internal": false},
+				{"id": "222222222222", "name": "backend", "driver": "overlay", "scope": "swarm", "ipamDriver": "default",
+					"subnet": "", "gateway": "", "internal": true},
+			},
+		},
+		{
+			name:   "podman",
+			engine: EnginePodman,
+			script: map[string]scriptedCommand{
+				Command("podman", "network", "ls", "--format", "json").String(): {
+					stdout: `[{"id":"3333333333333333cccc","name":"podman","driver":"bridge","internal":false,
+						"subnets":[{"subnet":"10.88.0.0/16","gateway":"10.88.0.1"}],"ipam_options":{"driver":"host-local"}}]`,
+				},
+			},
+			want: []map[string]interface{}{
+				{"id": "333333333333", "name": "podman", "driver": "bridge", "scope": "local", "ipamDriver": "host-local",
+					"subnet": "10.88.0.0/16", "gateway": "10.88.0.1", "internal": false},
+			},
+		},
+		{
+			name:   "nerdctl",
+			engine: EngineNerdctl,
+			script: map[string]scriptedCommand{
+				Command("nerdctl", "network", "ls", "--format", "{{json .}}").String(): {
+					stdout: `{"ID":"17f29b073143","Name":"bridge"}` + "\n" + `{"ID":"","Name":"host"}` + "\n",
+				},
+			},
+			want: []map[string]interface{}{
+				{"id": "17f29b073143", "name": "bridge", "driver": "", "scope": "local", "ipamDriver": "default",
+					"subnet": "", "gateway": "", "internal": false},
+				{"id": "", "name": "host", "driver": "", "scope": "local", "ipamDriver": "default",
+					"subnet": "", "gateway": "", "internal": false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newTestRouter(newFakeTunnels(t, newFakeExecutor(t, test.script), test.api))
+
+			var got []map[string]interface{}
+			if status := postJSON(t, router, "/networks/list", engineTarget(test.engine), &got); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("networks = %v\nwant       %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConnectGroupsComposeProjects(t *testing.T) {
+	api := fakeDockerAPI{
+		"GET /containers/json": {body: `[
+			{"Id":"aaaaaaaaaaaaaaaa","Names":["/shop-web-1"],"Image":"nginx","Status":"Up 1 hour",
+			 "Ports":[{"IP":"0.0.0.0","PrivatePort":80,"PublicPort":8080,"Type":"tcp"}],
+			 "Labels":{"com.docker.compose.project":"shop","tier":"front"}},
+			{"Id":"bbbbbbbbbbbbbbbb","Names":["/shop-db-1"],"Image":"postgres","Status":"Exited (0) 2 hours ago",
+			 "Labels":{"com.docker.compose.project":"shop"}},
+			{"Id":"cccccccccccccccc","Names":["/lonely"],"Image":"busybox","Status":"Up 3 minutes",
+			 "Ports":[{"PrivatePort":443,"Type":"tcp"}]}
+		]`},
+	}
+	router := newTestRouter(newFakeTunnels(t, newFakeExecutor(t, nil), api))
+
+	var got DockerContainerResponse
+	if status := postJSON(t, router, "/connect", engineTarget(EngineDocker), &got); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+
+	want := DockerContainerResponse{
+		ComposeGroups: []ComposeGroup{{
+			Name:   "shop",
+			Status: "Partial(1/2)",
+			Containers: []DockerContainer{
+				{ID: "aaaaaaaaaaaa", Name: "shop-web-1", Image: "nginx", Status: "Up 1 hour", Ports: "0.0.0.0:8080->80/tcp",
+					Labels: "com.docker.compose.project=shop,tier=front", ComposeProject: "shop"},
+				{ID: "bbbbbbbbbbbb", Name: "shop-db-1", Image: "postgres", Status: "Exited (0) 2 hours ago",
+					Labels: "com.docker.compose.project=shop", ComposeProject: "shop"},
+			},
+		}},
+		Ungrouped: []DockerContainer{
+			{ID: "cccccccccccc", Name: "lonely", Image: "busybox", Status: "Up 3 minutes", Ports: "443/tcp"},
+		},
+		Total: 3,
+		Page:  1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("containers = %+v\nwant         %+v", got, want)
+	}
+}
+
+func TestContainerListFilters(t *testing.T) {
+	api := fakeDockerAPI{
+		"GET /containers/json": {body: `[
+			{"Id":"aaaaaaaaaaaaaaaa","Names":["/shop-web-1"],"Image":"nginx:1.25","State":"running","Created":300,
+			 "Labels":{"com.docker.compose.project":"shop","tier":"front"}},
+			{"Id":"bbbbbbbbbbbbbbbb","Names":["/shop-db-1"],"Image":"postgres","State":"exited","Created":200,
+			 "Labels":{"com.docker.compose.project":"shop"}},
+			{"Id":"cccccccccccccccc","Names":["/lonely"],"Image":"registry:5000/nginx","State":"exited","Created":100},
+			{"Id":"dddddddddddddddd","Names":["/web-canary"],"Image":"nginx","State":"dead","Created":400,
+			 "Labels":{"tier":"front"}}
+		]`},
+	}
+	router := newTestRouter(newFakeTunnels(t, newFakeExecutor(t, nil), api))
+
+	names := func(response DockerContainerResponse) []string {
+		var names []string
+		for _, group := range response.ComposeGroups {
+			for _, container := range group.Containers {
+				names = append(names, container.Name)
+			}
+		}
+		for _, container := range response.Ungrouped {
+			names = append(names, container.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name    string
+		options ContainerListOptions
+		want    []string // Groups first, then the ungrouped containers
+		total   int
+	}{
+		{"every state, newest first", ContainerListOptions{}, []string{"shop-web-1", "shop-db-1", "web-canary", "lonely"}, 4},
+		{"stopped", ContainerListOptions{Status: []string{"exited", "dead"}}, []string{"shop-db-1", "web-canary", "lonely"}, 3},
+		{"label with value", ContainerListOptions{Labels: []string{"tier=front"}}, []string{"shop-web-1", "web-canary"}, 2},
+		{"label key", ContainerListOptions{Labels: []string{"com.docker.compose.project"}}, []string{"shop-web-1", "shop-db-1"}, 2},
+		{"image of any tag", ContainerListOptions{Image: "nginx"}, []string{"shop-web-1", "web-canary"}, 2},
+		{"image with a registry port", ContainerListOptions{Image: "registry:5000/nginx"}, []string{"lonely"}, 1},
+		{"compose project", ContainerListOptions{ComposeProject: "shop", Status: []string{"running"}}, []string{"shop-web-1"}, 1},
+		{"name part", ContainerListOptions{Name: "WEB"}, []string{"shop-web-1", "web-canary"}, 2},
+		{"name glob", ContainerListOptions{Name: "web-*"}, []string{"web-canary"}, 1},
+		{"sorted by name, second page", ContainerListOptions{Sort: "name", Page: 2, PageSize: 2}, []string{"shop-web-1", "web-canary"}, 4},
+		{"past the last page", ContainerListOptions{Page: 3, PageSize: 2}, nil, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got DockerContainerResponse
+			request := SSHConnectionRequest{SSHTarget: engineTarget(EngineDocker), ContainerListOptions: test.options}
+			if status := postJSON(t, router, "/connect", request, &got); status != http.StatusOK {
+				t.Fatalf("status = %d, want %d", status, http.StatusOK)
+			}
+			if !reflect.DeepEqual(names(got), test.want) || got.Total != test.total {
+				t.Errorf("containers = %q of %d, want %q of %d", names(got), got.Total, test.want, test.total)
+			}
+		})
+	}
+
+	for _, invalid := range []ContainerListOptions{{Status: []string{"sleeping"}}, {Sort: "size"}, {Name: "web-["}, {Page: -1}, {PageSize: 1000}, {Page: 4611686018427387905, PageSize: 2}} {
+		request := SSHConnectionRequest{SSHTarget: engineTarget(EngineDocker), ContainerListOptions: invalid}
+		if status := postJSON(t, router, "/connect", request, nil); status != http.StatusBadRequest {
+			t.Errorf("options %+v answered %d, want %d", invalid, status, http.StatusBadRequest)
+		}
+	}
+
+	// Podman filters on its side too, with its stopped containers counting as exited
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		Command("podman", "ps", "--format", "json", "--filter", "label=com.docker.compose.project=shop",
+			"--filter", "status=exited", "--filter", "status=stopped", "--all").String(): {
+			stdout: `[{"Id":"bbbbbbbbbbbbbbbb","Names":["shop-db-1"],"Image":"postgres","State":"stopped","Labels":{"com.docker.compose.project":"shop"}}]`,
+		},
+	})
+	router = newTestRouter(newFakeTunnels(t, executor, nil))
+	var got DockerContainerResponse
+	request := SSHConnectionRequest{SSHTarget: engineTarget(EnginePodman), ContainerListOptions: ContainerListOptions{Status: []string{"exited"}, ComposeProject: "shop"}}
+	if status := postJSON(t, router, "/connect", request, &got); status != http.StatusOK || got.Total != 1 {
+		t.Errorf("podman answered %d with %+v, want shop-db-1", status, got)
+	}
+}
+
+func TestContainerActions(t *testing.T) {
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		Command("podman", "restart", "web").String():                     {},
+		Command("podman", "pause", "web").String():                       {},
+		Command("podman", "unpause", "web").String():                     {},
+		Command("podman", "kill", "--signal", "SIGKILL", "web").String(): {},
+		Command("podman", "kill", "--signal", "HUP", "web").String():     {},
+		Command("podman", "rm", "--force", "--volumes", "web").String():  {},
+		Command("podman", "rename", "web", "shop-web").String():          {},
+	})
+	router := newTestRouter(newFakeTunnels(t, executor, nil))
+	target := engineTarget(EnginePodman)
+
+	tests := []struct {
+		path    string
+		options ContainerActionOptions
+		message string
+	}{
+		{"/container/restart", ContainerActionOptions{}, "Container web restarted"},
+		{"/container/pause", ContainerActionOptions{}, "Container web paused"},
+		{"/container/unpause", ContainerActionOptions{}, "Container web unpaused"},
+		{"/container/kill", ContainerActionOptions{}, "Container web killed"},
+		{"/container/kill", ContainerActionOptions{Signal: "HUP"}, "Container web killed"},
+		{"/container/remove", ContainerActionOptions{Force: true, Volumes: true}, "Container web removed"},
+		{"/container/rename", ContainerActionOptions{Name: "shop-web"}, "Container web renamed to shop-web"},
+	}
+	for _, test := range tests {
+		var response map[string]string
+		request := ContainerRequest{SSHTarget: target, ContainerId: "web", ContainerActionOptions: test.options}
+		if status := postJSON(t, router, test.path, request, &response); status != http.StatusOK {
+			t.Errorf("%s answered %d: %v", test.path, status, response)
+			continue
+		}
+		if response["message"] != test.message {
+			t.Errorf("%s message = %q, want %q", test.path, response["message"], test.message)
+		}
+	}
+	if ran := executor.commands(); len(ran) != len(tests) {
+		t.Errorf("commands run = %q, want one per action", ran)
+	}
+}
+
+func TestBulkContainerAction(t *testing.T) {
+	api := fakeDockerAPI{
+		"POST /containers/web/stop":   {status: http.StatusNoContent},
+		"POST /containers/db/stop":    {status: http.StatusNotModified},
+		"POST /containers/cache/stop": {status: http.StatusConflict, body: `{"message":"container cache is restarting"}`},
+	}
+	router := newTestRouter(newFakeTunnels(t, newFakeExecutor(t, nil), api))
+
+	var response struct {
+		Success string                `json:"success"`
+		Failed  int                   `json:"failed"`
+		Results []BulkContainerResult `json:"results"`
+	}
+	request := BulkContainerRequest{SSHTarget: engineTarget(EngineDocker), Action: "stop", ContainerIds: []string{"web", "missing", "db", "cache"}}
+	if status := postJSON(t, router, "/containers/bulk", request, &response); status != http.StatusOK {
+		t.Fatalf("bulk stop answered %d", status)
+	}
+
+	want := []struct {
+		id     string
+		status int
+	}{{"web", http.StatusOK}, {"missing", http.StatusNotFound}, {"db", http.StatusOK}, {"cache", http.StatusConflict}}
+	if len(response.Results) != len(want) {
+		t.Fatalf("results = %+v, want one per container in order", response.Results)
+	}
+	for i, result := range response.Results {
+		if result.ContainerId != want[i].id || result.Status != want[i].status || result.Success != (want[i].status == http.StatusOK) {
+			t.Errorf("result %d = %+v, want %s with %d", i, result, want[i].id, want[i].status)
+		}
+	}
+	if response.Success != "false" || response.Failed != 2 {
+		t.Errorf("success = %s with %d failed, want false with 2", response.Success, response.Failed)
+	}
+
+	// Renaming needs a name per container, so it only exists for one
+	request.Action = "rename"
+	if status := postJSON(t, router, "/containers/bulk", request, nil); status != http.StatusBadRequest {
+		t.Errorf("bulk rename answered %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestInspectContainer(t *testing.T) {
+	const inspect = `{"Id": "4f1c", "Name": "/web", "State": {"Status": "running", "Running": true}, "Config": {"Image": "nginx", "Env": ["DB_PASSWORD=hunter2", "PORT=80"]}}`
+	api := fakeDockerAPI{"GET /containers/web/json": {body: inspect}}
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		Command("podman", "container", "inspect", "web").String(): {stdout: "[" + inspect + "]"},
+	})
+	router := newTestRouter(newFakeTunnels(t, executor, api))
+
+	for _, engine := range []EngineKind{EngineDocker, EnginePodman} {
+		for _, reveal := range []bool{false, true} {
+			var response ContainerInspectResponse
+			request := ContainerInspectRequest{SSHTarget: engineTarget(engine), ContainerId: "web", RevealSecrets: reveal}
+			if status := postJSON(t, router, "/container/inspect", request, &response); status != http.StatusOK {
+				t.Fatalf("%s inspect answered %d", engine, status)
+			}
+			container := response.Container
+			if container.Name != "web" || container.State.Status != "running" || len(container.Env) != 2 {
+				t.Fatalf("%s inspection = %+v", engine, container)
+			}
+			if password := container.Env[0]; password.Masked == reveal || (password.Value == "hunter2") != reveal {
+				t.Errorf("%s with reveal %v: password = %+v", engine, reveal, password)
+			}
+			if port := container.Env[1]; port.Masked || port.Value != "80" {
+				t.Errorf("%s: port = %+v, want it shown", engine, port)
+			}
+		}
+	}
+
+	request := ContainerInspectRequest{SSHTarget: engineTarget(EngineDocker), ContainerId: "missing"}
+	if status := postJSON(t, router, "/container/inspect", request, nil); status != http.StatusNotFound {
+		t.Errorf("inspect of a missing container answered %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestErrorStatuses(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		body   interface{}
+		engine error // Returned instead of an engine
+		api    fakeDockerAPI
+		script map[string]scriptedCommand
+		want   int
+	}{
+		{
+			name: "missing fields",
+			path: "/networks/list",
+			body: SSHTarget{Hostname: "docker.example.com"},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "invalid container ID",
+			path: "/container/stop",
+			body: ContainerRequest{SSHTarget: engineTarget(EngineDocker), ContainerId: "../../info"},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "unknown container on docker",
+			path: "/container/stop",
+			body: ContainerRequest{SSHTarget: engineTarget(EngineDocker), ContainerId: "missing"},
+			api:  fakeDockerAPI{"POST /containers/missing/stop": {status: http.StatusNotFound, body: `{"message":"No such container: missing"}`}},
+			want: http.StatusNotFound,
+		},
+		{
+			name: "unknown container on podman",
+			path: "/container/start",
+			body: ContainerRequest{SSHTarget: engineTarget(EnginePodman), ContainerId: "missing"},
+			script: map[string]scriptedCommand{
+				Command("podman", "start", "missing").String(): {stderr: "Error: no container with name or ID \"missing\" found: no such container\n", status: 125},
+			},
+			want: http.StatusNotFound,
+		},
+		{
+			name: "invalid signal",
+			path: "/container/kill",
+			body: ContainerRequest{SSHTarget: engineTarget(EngineDocker), ContainerId: "web", ContainerActionOptions: ContainerActionOptions{Signal: "9; reboot"}},
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "pausing a stopped container on podman",
+			path: "/container/pause",
+			body: ContainerRequest{SSHTarget: engineTarget(EnginePodman), ContainerId: "web"},
+			script: map[string]scriptedCommand{
+				Command("podman", "pause", "web").String(): {stderr: "Error: \"web\" is not running, can't pause: container state improper\n", status: 125},
+			},
+			want: http.StatusConflict,
+		},
+		{
+			name: "failing podman command",
+			path: "/volumes/remove",
+			body: VolumeRequest{SSHTarget: engineTarget(EnginePodman), VolumeName: "data"},
+			script: map[string]scriptedCommand{
+				Command("podman", "volume", "rm", "data").String(): {stderr: "Error: volume data is being used\n", status: 2},
+			},
+			want: http.StatusInternalServerError,
+		},
+		{
+			name:   "sudo password not given yet",
+			path:   "/images/list",
+			body:   engineTarget(EngineDocker),
+			engine: &SudoPasswordRequiredError{Target: "deploy@docker.example.com"},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "connection reconnecting",
+			path:   "/volumes/list",
+			body:   engineTarget(EngineDocker),
+			engine: &ConnectionNotReadyError{Target: "deploy@docker.example.com", State: StateReconnecting},
+			want:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tunnels := newFakeTunnels(t, newFakeExecutor(t, test.script), test.api)
+			tunnels.err = test.engine
+			router := newTestRouter(tunnels)
+
+			var response map[string]interface{}
+			if status := postJSON(t, router, test.path, test.body, &response); status != test.want {
+				t.Errorf("status = %d, want %d (%v)", status, test.want, response)
+			}
+			if _, exists := response["error"]; !exists {
+				t.Errorf("response %v has no error", response)
+			}
+		})
+	}
+}
+
+func TestImportSSHConfig(t *testing.T) {
+	tunnels := newFakeTunnels(t, newFakeExecutor(t, nil), nil)
+	if err := os.MkdirAll(filepath.Dir(tunnels.sshConfig), 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := "Host web1\n  HostName web1.example.com\n  User deploy\n  Port 2222\n\nHost *.internal\n  User admin\n"
+	if err := os.WriteFile(tunnels.sshConfig, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	router := newTestRouter(tunnels)
+
+	// Read from the config of the manager, and only concrete hosts are proposed
+	var response struct {
+		Environments []ImportedEnvironment `json:"environments"`
+	}
+	getJSON(t, router, "/settings/import/ssh-config", &response)
+	if len(response.Environments) != 1 {
+		t.Fatalf("environments = %+v, want web1", response.Environments)
+	}
+	if imported := response.Environments[0]; imported.Alias != "web1" || imported.Hostname != "web1.example.com" || imported.Username != "deploy" || imported.Port != 2222 {
+		t.Errorf("imported %+v, want web1.example.com as deploy on 2222", imported)
+	}
+}
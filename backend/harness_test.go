@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// Canned result of a remote command
+type scriptedCommand struct {
+	stdout string
+	stderr string
+	status int
+	echo   bool // Then copies stdin to stdout until it closes, like cat
+}
+
+// Answers remote commands from a script instead of running them. A script entry matches
+// a command line it equals or starts with, so arguments like timestamps can be left out.
+type fakeExecutor struct {
+	t      *testing.T
+	script map[string]scriptedCommand
+
+	mutex    sync.Mutex
+	ran      []string
+	password []byte // Sudo password of every target
+}
+
+func newFakeExecutor(t *testing.T, script map[string]scriptedCommand) *fakeExecutor {
+	return &fakeExecutor{t: t, script: script}
+}
+
+// Write the scripted output of a command line and return its exit status
+func (f *fakeExecutor) respond(line string, stdin io.Reader, stdout, stderr io.Writer) int {
+	f.mutex.Lock()
+	f.ran = append(f.ran, line)
+	f.mutex.Unlock()
+
+	match, found := "", false
+	for prefix := range f.script {
+		if (line == prefix || strings.HasPrefix(line, prefix+" ")) && len(prefix) >= len(match) {
+			match, found = prefix, true
+		}
+	}
+	if !found {
+		f.t.Errorf("unexpected command %q", line)
+		fmt.Fprintf(stderr, "sh: command not scripted: %s\n", line)
+		return 127
+	}
+
+	command := f.script[match]
+	io.WriteString(stdout, command.stdout)
+	io.WriteString(stderr, command.stderr)
+	if command.echo {
+		io.Copy(stdout, stdin)
+	}
+	return command.status
+}
+
+func (f *fakeExecutor) runCommand(ctx context.Context, target SSHTarget, command RemoteCommand, stdin []byte, stdout, stderr io.Writer) error {
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	if status := f.respond(command.String(), bytes.NewReader(stdin), stdout, stderr); status != 0 {
+		return &fakeExitError{status: status}
+	}
+	return nil
+}
+
+func (f *fakeExecutor) sudoPassword(target SSHTarget) []byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.password == nil {
+		return nil
+	}
+	return append([]byte{}, f.password...)
+}
+
+// Command lines run so far, in order
+func (f *fakeExecutor) commands() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string{}, f.ran...)
+}
+
+// Non-zero exit of a scripted command, standing in for *ssh.ExitError
+type fakeExitError struct {
+	status int
+}
+
+func (e *fakeExitError) Error() string {
+	return fmt.Sprintf("Process exited with status %d", e.status)
+}
+
+func (e *fakeExitError) ExitStatus() int {
+	return e.status
+}
+
+// Canned Engine API response
+type apiResponse struct {
+	status int // 200 when zero
+	body   string
+}
+
+// Serves canned Engine API responses by "METHOD /path", the version prefix left out
+type fakeDockerAPI map[string]apiResponse
+
+func (api fakeDockerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/_ping" {
+		w.Header().Set("Api-Version", maxDockerAPIVersion)
+		io.WriteString(w, "OK")
+		return
+	}
+
+	path := r.URL.Path
+	if strings.HasPrefix(path, "/v") {
+		if i := strings.Index(path[1:], "/"); i >= 0 {
+			path = path[i+1:]
+		}
+	}
+
+	response, exists := api[r.Method+" "+path]
+	if !exists {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message":"page not found"}`)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if response.status != 0 {
+		w.WriteHeader(response.status)
+	}
+	io.WriteString(w, response.body)
+}
+
+// Docker client talking to a fake Engine API over TCP
+func newFakeDockerClient(t *testing.T, api http.Handler) *DockerClient {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	docker := newDockerClient(func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", server.Listener.Addr().String())
+	})
+	t.Cleanup(docker.closeIdle)
+	return docker
+}
+
+// A TunnelManager without any connection: Docker is a fake Engine API, and
+// commands, including those of the Podman and nerdctl CLIs, come from a script
+type fakeTunnels struct {
+	executor *fakeExecutor
+	docker   *DockerClient
+	err      error // Returned instead of an engine when set
+
+	hostKeys        *HostKeyStore
+	identities      *IdentityStore
+	tlsCertificates *TLSCertificateStore
+	events          *EventBroker
+	sshConfig       string
+
+	mutex  sync.Mutex
+	opened map[string]SSHTarget
+}
+
+func newFakeTunnels(t *testing.T, executor *fakeExecutor, api http.Handler) *fakeTunnels {
+	dir := t.TempDir()
+	hostKeys, err := NewHostKeyStore(filepath.Join(dir, "known_hosts"), filepath.Join(dir, "ssh", "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tunnels := &fakeTunnels{
+		executor:        executor,
+		hostKeys:        hostKeys,
+		identities:      NewIdentityStore(filepath.Join(dir, "ssh")),
+		tlsCertificates: NewTLSCertificateStore(filepath.Join(dir, "tls")),
+		events:          NewEventBroker(),
+		sshConfig:       filepath.Join(dir, "ssh", "config"),
+		opened:          make(map[string]SSHTarget),
+	}
+	if api != nil {
+		tunnels.docker = newFakeDockerClient(t, api)
+	}
+	return tunnels
+}
+
+func (f *fakeTunnels) ResolveTarget(target SSHTarget) (SSHTarget, error) {
+	return target, nil
+}
+
+func (f *fakeTunnels) OpenConnection(target SSHTarget) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.opened[connectionKey(target)] = target
+	return nil
+}
+
+func (f *fakeTunnels) CloseConnection(target SSHTarget) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.opened, connectionKey(target))
+	return nil
+}
+
+func (f *fakeTunnels) Status(target SSHTarget) (ConnectionStatus, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, exists := f.opened[connectionKey(target)]; !exists {
+		return ConnectionStatus{}, false
+	}
+	return ConnectionStatus{Connection: connectionKey(target), Target: target.String(), Transport: target.transport(), State: StateReady}, true
+}
+
+func (f *fakeTunnels) UpdatePolicy(target SSHTarget) (ConnectionStatus, bool, error) {
+	status, open := f.Status(target)
+	return status, open, target.ConnectionPolicy.Validate()
+}
+
+func (f *fakeTunnels) Statuses() []ConnectionStatus {
+	f.mutex.Lock()
+	targets := make([]SSHTarget, 0, len(f.opened))
+	for _, target := range f.opened {
+		targets = append(targets, target)
+	}
+	f.mutex.Unlock()
+
+	statuses := make([]ConnectionStatus, 0, len(targets))
+	for _, target := range targets {
+		status, _ := f.Status(target)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func (f *fakeTunnels) GetActiveConnections() []string {
+	var keys []string
+	for _, status := range f.Statuses() {
+		keys = append(keys, status.Connection)
+	}
+	return keys
+}
+
+func (f *fakeTunnels) Events() *EventBroker                  { return f.events }
+func (f *fakeTunnels) HostKeys() *HostKeyStore               { return f.hostKeys }
+func (f *fakeTunnels) Identities() *IdentityStore            { return f.identities }
+func (f *fakeTunnels) TLSCertificates() *TLSCertificateStore { return f.tlsCertificates }
+func (f *fakeTunnels) SSHConfigPath() string                 { return f.sshConfig }
+
+func (f *fakeTunnels) SudoPasswordRequired(target SSHTarget) bool {
+	return target.Privilege == PrivilegeSudoPassword && f.executor.sudoPassword(target) == nil
+}
+
+func (f *fakeTunnels) SetSudoPassword(ctx context.Context, target SSHTarget, password []byte) error {
+	f.executor.mutex.Lock()
+	defer f.executor.mutex.Unlock()
+	f.executor.password = append([]byte{}, password...)
+	return nil
+}
+
+func (f *fakeTunnels) ProbePrivileges(ctx context.Context, target SSHTarget) ([]PrivilegeProbe, error) {
+	return nil, &UnsupportedOperationError{Engine: target.engine(), Operation: "probing in tests"}
+}
+
+func (f *fakeTunnels) Engine(target SSHTarget) (Engine, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if err := target.DockerAccess.Validate(); err != nil {
+		return nil, err
+	}
+	if target.engine() == EngineDocker {
+		if f.docker == nil {
+			return nil, fmt.Errorf("no Engine API in this test")
+		}
+		return f.docker, nil
+	}
+	return newCLIEngine(f.executor, target), nil
+}
+
+func (f *fakeTunnels) HostUsage(ctx context.Context, target SSHTarget) (HostUsage, error) {
+	return measureHostUsage(ctx, f.executor, target)
+}
+
+// Forwarding needs a real SSH client, see sshTestServer
+func (f *fakeTunnels) OpenForward(ctx context.Context, req ForwardRequest) (PortForward, error) {
+	return PortForward{}, &UnsupportedTransportError{Transport: req.transport(), Operation: "port forwarding without SSH"}
+}
+
+func (f *fakeTunnels) OpenDockerEndpoint(req DockerEndpointRequest) (PortForward, error) {
+	return PortForward{}, &UnsupportedTransportError{Transport: req.transport(), Operation: "a Docker endpoint without SSH"}
+}
+
+func (f *fakeTunnels) Forwards() []PortForward { return []PortForward{} }
+
+func (f *fakeTunnels) CloseForward(localPort int) error {
+	return &ForwardNotFoundError{LocalPort: localPort}
+}
+
+// Terminals need a real SSH client as well
+func (f *fakeTunnels) ExecContainer(req ContainerExecRequest) (*Terminal, error) {
+	return nil, &UnsupportedTransportError{Transport: req.transport(), Operation: "terminals without SSH"}
+}
+
+func (f *fakeTunnels) OpenHostTerminal(req HostTerminalRequest) (*Terminal, error) {
+	return nil, &UnsupportedTransportError{Transport: req.transport(), Operation: "terminals without SSH"}
+}
+
+// Router with every endpoint, reaching environments through tunnels
+func newTestRouter(tunnels TunnelManager) *echo.Echo {
+	router := echo.New()
+	NewServer(tunnels).Register(router)
+	return router
+}
+
+// POST body as JSON and decode the response into out, unless out is nil
+func postJSON(t *testing.T, router *echo.Echo, path string, body, out interface{}) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	if out != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+			t.Fatalf("POST %s answered %d with %q: %v", path, recorder.Code, recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+// An SSH server in the test process. Commands are answered from the script of an executor,
+// and forwarded sockets and ports lead to an Engine API handler, whatever they were opened for.
+type sshTestServer struct {
+	address   string
+	hostKey   ssh.Signer
+	clientKey ed25519.PrivateKey
+	executor  *fakeExecutor
+	api       *httptest.Server
+
+	mutex sync.Mutex
+	conns []net.Conn
+
+	// Keepalive requests received from every client, left unanswered while silent like over a link that drops packets
+	keepalives atomic.Int64
+	silent     atomic.Bool
+
+	// Sizes of the terminals requested and resized, in order
+	terminalSizes chan TerminalSize
+}
+
+func startSSHServer(t *testing.T, executor *fakeExecutor, api http.Handler) *sshTestServer {
+	_, hostPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(hostPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublic, clientPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(clientPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown public key")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &sshTestServer{
+		address:       listener.Addr().String(),
+		hostKey:       hostKey,
+		clientKey:     clientPrivate,
+		executor:      executor,
+		api:           httptest.NewServer(api),
+		terminalSizes: make(chan TerminalSize, 16),
+	}
+	t.Cleanup(server.api.Close)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mutex.Lock()
+			server.conns = append(server.conns, conn)
+			server.mutex.Unlock()
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func (s *sshTestServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+
+	// Keepalives are answered with a failure, as OpenSSH does for requests it does not know
+	go func() {
+		for request := range requests {
+			if request.Type == keepaliveRequest {
+				s.keepalives.Add(1)
+				if s.silent.Load() {
+					continue
+				}
+			}
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+		}
+	}()
+
+	for channel := range channels {
+		switch channel.ChannelType() {
+		case "session":
+			go s.session(channel)
+		case "direct-streamlocal@openssh.com", "direct-tcpip":
+			go s.forward(channel)
+		default:
+			channel.Reject(ssh.UnknownChannelType, "not supported by the test server")
+		}
+	}
+}
+
+// Cut every client connection, like a server that went away
+func (s *sshTestServer) dropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// Run the one command or shell of a session from the script, on a terminal if one is asked for
+func (s *sshTestServer) session(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for request := range requests {
+		switch request.Type {
+		case "pty-req":
+			var pty struct {
+				Term                         string
+				Columns, Rows, Width, Height uint32
+				Modes                        string
+			}
+			if err := ssh.Unmarshal(request.Payload, &pty); err != nil {
+				request.Reply(false, nil)
+				continue
+			}
+			s.resized(pty.Columns, pty.Rows)
+			request.Reply(true, nil)
+		case "window-change":
+			var window struct{ Columns, Rows, Width, Height uint32 }
+			if err := ssh.Unmarshal(request.Payload, &window); err == nil {
+				s.resized(window.Columns, window.Rows)
+			}
+		case "exec", "shell":
+			// A login shell is scripted as the empty command
+			var exec struct{ Command string }
+			if request.Type == "exec" {
+				if err := ssh.Unmarshal(request.Payload, &exec); err != nil {
+					request.Reply(false, nil)
+					return
+				}
+			}
+			request.Reply(true, nil)
+
+			// Requests like window-change keep coming while the command runs
+			go func() {
+				status := s.executor.respond(exec.Command, channel, channel, channel.Stderr())
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+				channel.Close()
+			}()
+		default:
+			request.Reply(false, nil)
+		}
+	}
+}
+
+func (s *sshTestServer) resized(cols, rows uint32) {
+	select {
+	case s.terminalSizes <- TerminalSize{Cols: int(cols), Rows: int(rows)}:
+	default:
+	}
+}
+
+// Connect a forwarded socket or port to the Engine API
+func (s *sshTestServer) forward(newChannel ssh.NewChannel) {
+	upstream, err := net.Dial("tcp", s.api.Listener.Addr().String())
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		io.Copy(upstream, channel)
+		upstream.Close()
+	}()
+	io.Copy(channel, upstream)
+	channel.Close()
+}
+
+// Target of the server, for the user the client key is authorized for
+func (s *sshTestServer) target() SSHTarget {
+	host, port, _ := net.SplitHostPort(s.address)
+	number, _ := strconv.Atoi(port)
+	return SSHTarget{Hostname: host, Username: "tester", Port: number}
+}
+
+// A real tunnel manager that trusts the server and authenticates with its client key
+func (s *sshTestServer) manager(t *testing.T) *SSHTunnelManager {
+	manager, err := newSSHTunnelManager(s.managerPaths(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(manager.CloseAllConnections)
+	return manager
+}
+
+// Files of a manager that trusts the server and holds its client key
+func (s *sshTestServer) managerPaths(t *testing.T) managerPaths {
+	dir := t.TempDir()
+	keyDir := filepath.Join(dir, "ssh")
+	if err := os.Mkdir(keyDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// The identity comes from the key directory only, never from an agent of the machine running the tests
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(dir, "no-agent.sock"))
+
+	block, err := ssh.MarshalPrivateKey(s.clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keyDir, "id_ed25519"), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.address)}, s.hostKey.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return managerPaths{
+		keyDir:          keyDir,
+		sshConfig:       filepath.Join(keyDir, "config"),
+		knownHosts:      knownHosts,
+		userKnownHosts:  filepath.Join(keyDir, "known_hosts"),
+		tlsCertificates: filepath.Join(dir, "tls"),
+		openConnections: filepath.Join(dir, "connections.json"),
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Samples /proc/stat twice a second apart, then reads memory and root filesystem usage.
+// Only plain files and POSIX df are used so no output format depends on the distribution.
+var hostUsageCommand = Sequence(
+	Command("head", "-n1", "/proc/stat"),
+	Command("sleep", "1"),
+	Command("head", "-n1", "/proc/stat"),
+	Command("grep", "-E", "^(MemTotal|MemAvailable):", "/proc/meminfo"),
+	Command("df", "-P", "/"),
+)
+
+// Host level resource usage, in percent
+type HostUsage struct {
+	CPU    float64
+	Memory float64
+	Disk   float64
+}
+
+// Measure CPU, memory and disk usage of the host behind a target
+func (m *SSHTunnelManager) HostUsage(ctx context.Context, target SSHTarget) (HostUsage, error) {
+	return measureHostUsage(ctx, m, target)
+}
+
+func measureHostUsage(ctx context.Context, runner commandRunner, target SSHTarget) (HostUsage, error) {
+	var output bytes.Buffer
+	if err := runner.runCommand(ctx, target, hostUsageCommand, nil, &output, &output); err != nil {
+		return HostUsage{}, err
+	}
+	return parseHostUsage(output.String())
+}
+
+func parseHostUsage(output string) (HostUsage, error) {
+	var usage HostUsage
+	var cpuSamples [][]uint64
+	var memTotal, memAvailable uint64
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case fields[0] == "cpu":
+			var sample []uint64
+			for _, field := range fields[1:] {
+				value, _ := strconv.ParseUint(field, 10, 64)
+				sample = append(sample, value)
+			}
+			cpuSamples = append(cpuSamples, sample)
+
+		case fields[0] == "MemTotal:" && len(fields) >= 2:
+			memTotal, _ = strconv.ParseUint(fields[1], 10, 64)
+
+		case fields[0] == "MemAvailable:" && len(fields) >= 2:
+			memAvailable, _ = strconv.ParseUint(fields[1], 10, 64)
+
+		case fields[0] == "Filesystem" && i+1 < len(lines):
+			// Capacity is the fifth column of the line below the header
+			if row := strings.Fields(lines[i+1]); len(row) >= 5 {
+				usage.Disk, _ = strconv.ParseFloat(strings.TrimSuffix(row[4], "%"), 64)
+			}
+		}
+	}
+
+	if len(cpuSamples) != 2 {
+		return usage, fmt.Errorf("unexpected /proc/stat output")
+	}
+	usage.CPU = cpuPercent(cpuSamples[0], cpuSamples[1])
+
+	if memTotal > 0 {
+		usage.Memory = float64(memTotal-memAvailable) / float64(memTotal) * 100
+	}
+	return usage, nil
+}
+
+// Share of time not spent idle or waiting for I/O between two /proc/stat samples
+func cpuPercent(before, after []uint64) float64 {
+	var total, idle uint64
+	for i := range after {
+		if i >= len(before) || after[i] < before[i] {
+			continue
+		}
+		delta := after[i] - before[i]
+		total += delta
+		// idle and iowait are the fourth and fifth columns
+		if i == 3 || i == 4 {
+			idle += delta
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(total-idle) / float64(total) * 100
+}
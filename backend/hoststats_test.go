@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestParseHostUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    HostUsage
+		wantErr bool
+	}{
+		{name: "full output", output: hostUsageOutput, want: HostUsage{CPU: 50, Memory: 75, Disk: 42}},
+		{
+			name: "idle host without MemAvailable",
+			output: "cpu  10 0 10 80 0\ncpu  10 0 10 180 0\nMemTotal: 1000 kB\n" +
+				"Filesystem 1024-blocks Used Available Capacity Mounted on\noverlay 100 1 99 1% /\n",
+			want: HostUsage{CPU: 0, Memory: 100, Disk: 1},
+		},
+		{name: "one CPU sample", output: "cpu  10 0 10 80 0\n", wantErr: true},
+		{name: "nothing", output: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseHostUsage(test.output)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && got != test.want {
+				t.Errorf("usage = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
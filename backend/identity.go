@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	// Agent socket Docker Desktop forwards from the host into containers
+	hostAgentSocketPath = "/run/host-services/ssh-auth.sock"
+
+	agentDialTimeout = 2 * time.Second
+)
+
+// An identity file that needs a passphrase before it can be used
+type LockedIdentity struct {
+	IdentityFile string    `json:"identityFile"` // Relative to ~/.ssh
+	Fingerprint  string    `json:"fingerprint,omitempty"`
+	SeenAt       time.Time `json:"seenAt"`
+}
+
+// Returned when the only way to authenticate is a key whose passphrase is unknown
+type PassphraseRequiredError struct {
+	Identity LockedIdentity
+}
+
+func (e *PassphraseRequiredError) Error() string {
+	return fmt.Sprintf("identity file %s is protected by a passphrase; unlock it or add it to an SSH agent", e.Identity.IdentityFile)
+}
+
+// A key decrypted with a passphrase; only ever held in memory
+type unlockedIdentity struct {
+	signer ssh.Signer
+	key    interface{}
+}
+
+// Provides the keys to authenticate with: identity files, keys unlocked for this session and an SSH agent
+type IdentityStore struct {
+	keyDir      string
+	agentSocket string
+
+	mutex     sync.Mutex
+	agent     agent.ExtendedAgent
+	agentConn net.Conn
+	unlocked  map[string]unlockedIdentity // By path
+	locked    map[string]LockedIdentity   // By path
+}
+
+// Create an identity store for keyDir, using SSH_AUTH_SOCK or the Docker Desktop agent socket
+func NewIdentityStore(keyDir string) *IdentityStore {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		socket = hostAgentSocketPath
+	}
+
+	return &IdentityStore{
+		keyDir:      keyDir,
+		agentSocket: socket,
+		unlocked:    make(map[string]unlockedIdentity),
+		locked:      make(map[string]LockedIdentity),
+	}
+}
+
+// The directory identity files are resolved in
+func (s *IdentityStore) KeyDir() string {
+	return s.keyDir
+}
+
+// Name of an identity file as shown to the user
+func (s *IdentityStore) displayName(path string) string {
+	if rel, err := filepath.Rel(s.keyDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// Keys held by the SSH agent; nil when no agent is reachable. The caller must hold the mutex.
+func (s *IdentityStore) agentSignersLocked() []ssh.Signer {
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.agent == nil {
+			if _, err := os.Stat(s.agentSocket); err != nil {
+				return nil
+			}
+			conn, err := net.DialTimeout("unix", s.agentSocket, agentDialTimeout)
+			if err != nil {
+				logger.Warnf("Failed to connect to SSH agent at %s: %v", s.agentSocket, err)
+				return nil
+			}
+			s.agentConn = conn
+			s.agent = agent.NewClient(conn)
+		}
+
+		signers, err := s.agent.Signers()
+		if err == nil {
+			return signers
+		}
+
+		// The agent may have restarted, reconnect once
+		logger.Warnf("SSH agent at %s failed: %v", s.agentSocket, err)
+		s.closeAgentLocked()
+	}
+	return nil
+}
+
+func (s *IdentityStore) closeAgentLocked() {
+	if s.agentConn != nil {
+		s.agentConn.Close()
+	}
+	s.agent = nil
+	s.agentConn = nil
+}
+
+// Whether an SSH agent is reachable
+func (s *IdentityStore) AgentAvailable() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.agentSignersLocked() != nil
+}
+
+// Signers to offer for an identity file, or for the default identities when it is empty.
+// Identities skipped for lack of a passphrase are returned as well.
+func (s *IdentityStore) Signers(identityFile string) ([]ssh.Signer, []LockedIdentity, error) {
+	var paths []string
+	if identityFile != "" {
+		path, err := resolveIdentityFile(s.keyDir, identityFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		paths = append(paths, path)
+	} else {
+		for _, name := range defaultIdentityFiles {
+			paths = append(paths, filepath.Join(s.keyDir, name))
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agentSigners := s.agentSignersLocked()
+
+	var signers []ssh.Signer
+	if identityFile == "" {
+		// Like OpenSSH, agent keys are offered before the default identity files
+		signers = append(signers, agentSigners...)
+	}
+
+	var locked []LockedIdentity
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			if identityFile != "" {
+				return nil, nil, fmt.Errorf("failed to read identity file %s: %w", path, err)
+			}
+			if !os.IsNotExist(err) {
+				logger.Warnf("Failed to read identity %s: %v", path, err)
+			}
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(data)
+		if err == nil {
+			signers = append(signers, signer)
+			continue
+		}
+
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			logger.Warnf("Skipping identity %s: %v", path, err)
+			continue
+		}
+
+		if unlocked, exists := s.unlocked[path]; exists {
+			signers = append(signers, unlocked.signer)
+			continue
+		}
+
+		// The agent may hold the same key; for an explicit identity that is the only agent key offered
+		if identityFile != "" && missing.PublicKey != nil {
+			if agentSigner := matchingSigner(agentSigners, missing.PublicKey); agentSigner != nil {
+				signers = append(signers, agentSigner)
+				continue
+			}
+		}
+		if identityFile == "" && missing.PublicKey != nil && matchingSigner(agentSigners, missing.PublicKey) != nil {
+			continue
+		}
+
+		identity := LockedIdentity{IdentityFile: s.displayName(path), SeenAt: time.Now()}
+		if missing.PublicKey != nil {
+			identity.Fingerprint = ssh.FingerprintSHA256(missing.PublicKey)
+		}
+		locked = append(locked, identity)
+	}
+
+	return signers, locked, nil
+}
+
+// The signer among signers for a public key, if any
+func matchingSigner(signers []ssh.Signer, publicKey ssh.PublicKey) ssh.Signer {
+	wanted := publicKey.Marshal()
+	for _, signer := range signers {
+		if string(signer.PublicKey().Marshal()) == string(wanted) {
+			return signer
+		}
+	}
+	return nil
+}
+
+// Record that connecting needs a locked identity and build the error to report
+func (s *IdentityStore) RequirePassphrase(identity LockedIdentity) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path, err := resolveIdentityFile(s.keyDir, identity.IdentityFile)
+	if err != nil {
+		return err
+	}
+	s.locked[path] = identity
+	logger.Warnf("Identity %s needs a passphrase", identity.IdentityFile)
+	return &PassphraseRequiredError{Identity: identity}
+}
+
+// List identities waiting for a passphrase
+func (s *IdentityStore) Locked() []LockedIdentity {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	identities := make([]LockedIdentity, 0, len(s.locked))
+	for _, identity := range s.locked {
+		identities = append(identities, identity)
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].IdentityFile < identities[j].IdentityFile
+	})
+	return identities
+}
+
+// Decrypt an identity file and keep the key in memory for the rest of the session
+func (s *IdentityStore) Unlock(identityFile string, passphrase []byte) error {
+	defer wipeBytes(passphrase)
+
+	path, err := resolveIdentityFile(s.keyDir, identityFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read identity file %s: %v", identityFile, err)
+	}
+
+	key, err := ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+	if err != nil {
+		if strings.Contains(err.Error(), "incorrect") {
+			return fmt.Errorf("incorrect passphrase for %s", identityFile)
+		}
+		return fmt.Errorf("failed to decrypt %s: %v", identityFile, err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		wipeKey(key)
+		return fmt.Errorf("unsupported key in %s: %v", identityFile, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if previous, exists := s.unlocked[path]; exists {
+		wipeKey(previous.key)
+	}
+	s.unlocked[path] = unlockedIdentity{signer: signer, key: key}
+	delete(s.locked, path)
+
+	logger.Infof("Unlocked identity %s (%s) for this session", identityFile, ssh.FingerprintSHA256(signer.PublicKey()))
+	return nil
+}
+
+// Forget every unlocked key and disconnect from the agent
+func (s *IdentityStore) Wipe() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for path, unlocked := range s.unlocked {
+		wipeKey(unlocked.key)
+		delete(s.unlocked, path)
+	}
+	s.locked = make(map[string]LockedIdentity)
+	s.closeAgentLocked()
+}
+
+func wipeBytes(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// Overwrite the secret parts of a decrypted private key
+func wipeKey(key interface{}) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		k.D.SetInt64(0)
+		for _, prime := range k.Primes {
+			prime.SetInt64(0)
+		}
+	case *ecdsa.PrivateKey:
+		k.D.SetInt64(0)
+	case ed25519.PrivateKey:
+		wipeBytes(k)
+	case *ed25519.PrivateKey:
+		wipeBytes(*k)
+	}
+}
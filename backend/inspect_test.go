@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEnvVariableMasking(t *testing.T) {
+	tests := []struct {
+		entry  string
+		want   EnvVariable
+		reveal bool
+	}{
+		{entry: "PATH=/usr/local/bin:/usr/bin", want: EnvVariable{Name: "PATH", Value: "/usr/local/bin:/usr/bin"}},
+		{entry: "POSTGRES_PASSWORD=hunter2", want: EnvVariable{Name: "POSTGRES_PASSWORD", Value: maskedValue, Masked: true}},
+		{entry: "PGPASSWORD=hunter2", want: EnvVariable{Name: "PGPASSWORD", Value: maskedValue, Masked: true}},
+		{entry: "GITHUB_TOKEN=ghp_x", want: EnvVariable{Name: "GITHUB_TOKEN", Value: maskedValue, Masked: true}},
+		{entry: "AWS_SECRET_ACCESS_KEY=abc", want: EnvVariable{Name: "AWS_SECRET_ACCESS_KEY", Value: maskedValue, Masked: true}},
+		{entry: "STRIPE_KEY=sk_live", want: EnvVariable{Name: "STRIPE_KEY", Value: maskedValue, Masked: true}},
+		{entry: "KEYBOARD=us", want: EnvVariable{Name: "KEYBOARD", Value: "us"}},
+		{entry: "DB_PASSWORD=", want: EnvVariable{Name: "DB_PASSWORD"}},
+		{entry: "DATABASE_URL=postgres://shop:hunter2@db:5432/shop", want: EnvVariable{Name: "DATABASE_URL", Value: "postgres://shop:" + maskedValue + "@db:5432/shop", Masked: true}},
+		{entry: "UPSTREAM=http://backend:8080", want: EnvVariable{Name: "UPSTREAM", Value: "http://backend:8080"}},
+		{entry: "API_KEY=abc=def", want: EnvVariable{Name: "API_KEY", Value: "abc=def"}, reveal: true},
+	}
+	for _, test := range tests {
+		if got := envVariable(test.entry, test.reveal); got != test.want {
+			t.Errorf("envVariable(%q, %v) = %+v, want %+v", test.entry, test.reveal, got, test.want)
+		}
+	}
+}
+
+func TestNewContainerInspection(t *testing.T) {
+	var details ContainerDetails
+	err := json.Unmarshal([]byte(`{
+		"Id": "4f1c",
+		"Name": "/shop-web-1",
+		"Created": "2024-05-01T10:00:00Z",
+		"Image": "sha256:ab12",
+		"RestartCount": 3,
+		"State": {"Status": "exited", "OOMKilled": true, "ExitCode": 137, "Health": {"Status": "unhealthy", "FailingStreak": 2, "Log": [{"ExitCode": 1, "Output": "refused"}]}},
+		"Config": {"Image": "nginx:1.25", "Env": ["TOKEN=x"], "Entrypoint": "/docker-entrypoint.sh", "Cmd": ["nginx", "-g", "daemon off;"]},
+		"HostConfig": {"RestartPolicy": {"Name": "on-failure", "MaximumRetryCount": 5}, "CpuQuota": 50000, "CpuPeriod": 100000, "Memory": 268435456, "PidsLimit": -1},
+		"Mounts": [{"Type": "volume", "Name": "html", "Source": "/var/lib/docker/volumes/html/_data", "Destination": "/usr/share/nginx/html", "RW": false}],
+		"NetworkSettings": {
+			"Ports": {"443/tcp": null, "80/tcp": [{"HostIp": "0.0.0.0", "HostPort": "8080"}]},
+			"Networks": {"shop_default": {"IPAddress": "172.18.0.2", "Gateway": "172.18.0.1"}, "bridge": {}}
+		}
+	}`), &details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewContainerInspection(details, false)
+	if got.Name != "shop-web-1" || got.Image != "nginx:1.25" || got.ImageID != "sha256:ab12" || got.RestartCount != 3 {
+		t.Errorf("inspection = %+v", got)
+	}
+	if !got.State.OOMKilled || got.State.ExitCode != 137 || got.State.Health == nil || got.State.Health.Status != "unhealthy" || len(got.State.Health.Log) != 1 {
+		t.Errorf("state = %+v", got.State)
+	}
+	if got.RestartPolicy != (RestartPolicy{Name: "on-failure", MaximumRetryCount: 5}) {
+		t.Errorf("restart policy = %+v", got.RestartPolicy)
+	}
+	if want := (ResourceLimits{CPUs: 0.5, Memory: 268435456}); got.Resources != want {
+		t.Errorf("resources = %+v, want %+v", got.Resources, want)
+	}
+	if !reflect.DeepEqual(got.Entrypoint, []string{"/docker-entrypoint.sh"}) || len(got.Command) != 3 {
+		t.Errorf("entrypoint = %q, command = %q", got.Entrypoint, got.Command)
+	}
+	if len(got.Env) != 1 || !got.Env[0].Masked {
+		t.Errorf("env = %+v, want the token masked", got.Env)
+	}
+	if len(got.Mounts) != 1 || !got.Mounts[0].ReadOnly || got.Mounts[0].Name != "html" {
+		t.Errorf("mounts = %+v", got.Mounts)
+	}
+	if len(got.Networks) != 2 || got.Networks[0].Name != "bridge" || got.Networks[1].Gateway != "172.18.0.1" {
+		t.Errorf("networks = %+v, want them by name", got.Networks)
+	}
+	wantPorts := []InspectionPort{
+		{ContainerPort: 80, Protocol: "tcp", HostIP: "0.0.0.0", HostPort: 8080},
+		{ContainerPort: 443, Protocol: "tcp"},
+	}
+	if !reflect.DeepEqual(got.Ports, wantPorts) {
+		t.Errorf("ports = %+v, want %+v", got.Ports, wantPorts)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Longest jump host chain an environment may declare
+const maxJumpHosts = 8
+
+// An intermediate host the connection is tunneled through, like ProxyJump
+type JumpHost struct {
+	Hostname     string `json:"hostname"`
+	Username     string `json:"username"`
+	Port         int    `json:"port,omitempty"`
+	IdentityFile string `json:"identityFile,omitempty"` // Relative to ~/.ssh unless absolute
+}
+
+// Identifies which hop of a chain failed; the target itself is the last hop
+type HopError struct {
+	Hop   int    `json:"hop"` // 1-based
+	Total int    `json:"total"`
+	Host  string `json:"host"`
+	Err   error  `json:"-"`
+}
+
+func (e *HopError) Error() string {
+	role := "jump host"
+	if e.Hop == e.Total {
+		role = "target"
+	}
+	return fmt.Sprintf("hop %d/%d (%s %s): %v", e.Hop, e.Total, role, e.Host, e.Err)
+}
+
+func (e *HopError) Unwrap() error {
+	return e.Err
+}
+
+// Every host on the way to the target as its own SSHTarget, the target last.
+// Hops share the target's connect timeout but use their own credentials.
+func (t SSHTarget) hops() []SSHTarget {
+	hops := make([]SSHTarget, 0, len(t.JumpHosts)+1)
+	for _, jump := range t.JumpHosts {
+		hops = append(hops, SSHTarget{
+			Hostname:       jump.Hostname,
+			Username:       jump.Username,
+			Port:           jump.Port,
+			IdentityFile:   jump.IdentityFile,
+			ConnectTimeout: t.ConnectTimeout,
+		})
+	}
+
+	target := t
+	target.JumpHosts = nil
+	return append(hops, target)
+}
+
+// Key fragment identifying a jump host, credentials included
+func (j JumpHost) key() string {
+	key := j.Username + "@" + j.Hostname
+	if j.Port != 0 {
+		key += ":" + strconv.Itoa(j.Port)
+	}
+	if j.IdentityFile != "" {
+		key += "#" + j.IdentityFile
+	}
+	return key
+}
+
+// Wrap an error with the hop it happened on; direct connections are left as they are
+func hopError(hops []SSHTarget, index int, err error) error {
+	if len(hops) == 1 {
+		return err
+	}
+	return &HopError{Hop: index + 1, Total: len(hops), Host: hops[index].String(), Err: err}
+}
+
+// Connect to every hop in order, each one tunneled through the previous.
+// The returned clients follow the chain, so the last one talks to the target.
+func (m *SSHTunnelManager) dialChain(target SSHTarget) ([]*ssh.Client, error) {
+	hops := target.hops()
+	clients := make([]*ssh.Client, 0, len(hops))
+
+	for i, hop := range hops {
+		config, locked, err := m.clientConfig(hop)
+		if err != nil {
+			closeClients(clients)
+			return nil, hopError(hops, i, err)
+		}
+
+		var client *ssh.Client
+		if i == 0 {
+			client, err = ssh.Dial("tcp", hop.address(), config)
+		} else {
+			client, err = dialThrough(clients[i-1], hop.address(), config)
+		}
+		if err != nil {
+			// A locked key may well have been the one the server wanted
+			if len(locked) > 0 && strings.Contains(err.Error(), "unable to authenticate") {
+				err = m.identities.RequirePassphrase(locked[0])
+			}
+			closeClients(clients)
+			return nil, hopError(hops, i, err)
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+// Open an SSH connection to address over a direct-tcpip channel of an existing client
+func dialThrough(via *ssh.Client, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := via.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		client *ssh.Client
+		err    error
+	}
+	done := make(chan result, 1)
+
+	// SSH channels have no deadlines, so the handshake is bounded by a timer instead
+	go func() {
+		c, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{client: ssh.NewClient(c, chans, reqs)}
+	}()
+
+	timer := time.NewTimer(config.Timeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			conn.Close()
+		}
+		return res.client, res.err
+	case <-timer.C:
+		conn.Close()
+		return nil, fmt.Errorf("timed out after %v waiting for SSH handshake with %s", config.Timeout, address)
+	}
+}
+
+// Close clients from the target back towards the first hop
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+// Probe every hop of the chain in order and report the first one that does not answer
+// within the timeout. A link that drops packets never fails the request, it only goes unanswered;
+// such a probe is left waiting until its client is closed. Stops without an error once done is closed.
+func probeChain(target SSHTarget, clients []*ssh.Client, timeout time.Duration, done <-chan struct{}) error {
+	hops := target.hops()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for i, client := range clients {
+		replied := make(chan error, 1)
+		go func(client *ssh.Client) {
+			_, _, err := client.SendRequest(keepaliveRequest, true, nil)
+			replied <- err
+		}(client)
+
+		select {
+		case err := <-replied:
+			if err != nil {
+				return hopError(hops, i, err)
+			}
+		case <-timer.C:
+			return hopError(hops, i, fmt.Errorf("no keepalive reply within %v", timeout))
+		case <-done:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// known_hosts file owned by the extension, ~/.ssh is mounted read-only
+	knownHostsFilePath = "/root/docker-extension/known_hosts"
+
+	// The user's own known_hosts, trusted but never written to
+	userKnownHostsFilePath = sshDir + "/known_hosts"
+)
+
+// A host key seen for an unknown host, waiting for the user to accept or reject it
+type PendingHostKey struct {
+	Address     string    `json:"address"`
+	KeyType     string    `json:"keyType"`
+	Fingerprint string    `json:"fingerprint"`
+	SeenAt      time.Time `json:"seenAt"`
+
+	key ssh.PublicKey
+}
+
+// Returned when a host presents a key that is not in any known_hosts file yet
+type UnknownHostKeyError struct {
+	HostKey PendingHostKey
+}
+
+func (e *UnknownHostKeyError) Error() string {
+	return fmt.Sprintf("host key for %s is not trusted yet (%s %s)",
+		e.HostKey.Address, e.HostKey.KeyType, e.HostKey.Fingerprint)
+}
+
+// Returned when a known host presents a different key than the one on record
+type HostKeyChangedError struct {
+	Address     string
+	KeyType     string
+	Fingerprint string
+	File        string
+	Line        int
+}
+
+func (e *HostKeyChangedError) Error() string {
+	return fmt.Sprintf("REMOTE HOST IDENTIFICATION HAS CHANGED for %s: got %s %s, which does not match %s:%d; refusing to connect",
+		e.Address, e.KeyType, e.Fingerprint, e.File, e.Line)
+}
+
+// Verifies host keys against known_hosts and keeps track of keys awaiting a decision
+type HostKeyStore struct {
+	path     string
+	userPath string
+	mutex    sync.Mutex
+	pending  map[string]PendingHostKey
+}
+
+// Create a host key store backed by the extension's known_hosts file
+func NewHostKeyStore(path, userPath string) (*HostKeyStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create known_hosts directory: %v", err)
+	}
+
+	// knownhosts.New refuses missing files, so make sure ours exists
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create known_hosts file: %v", err)
+	}
+	file.Close()
+
+	return &HostKeyStore{
+		path:     path,
+		userPath: userPath,
+		pending:  make(map[string]PendingHostKey),
+	}, nil
+}
+
+// Build a knownhosts callback from the files currently on disk
+func (s *HostKeyStore) loadCallback() (ssh.HostKeyCallback, error) {
+	files := []string{s.path}
+	if _, err := os.Stat(s.userPath); err == nil {
+		files = append(files, s.userPath)
+	}
+	return knownhosts.New(files...)
+}
+
+// Host key algorithms to offer for an address, preferring the types already on record
+func (s *HostKeyStore) KnownAlgorithms(address string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	callback, err := s.loadCallback()
+	if err != nil {
+		logger.Warnf("Failed to load known_hosts: %v", err)
+		return nil
+	}
+
+	// Probe with a throwaway key; the resulting KeyError lists what is on record
+	probe, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probeKey, err := ssh.NewPublicKey(probe)
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if err := callback(address, placeholderAddr(), probeKey); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		algorithms = append(algorithms, keyAlgorithms(known.Key.Type())...)
+	}
+	return algorithms
+}
+
+// Signature algorithms that can be negotiated for a key type
+func keyAlgorithms(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// knownhosts matches on the remote address too, but a hostname lookup is not needed to probe
+func placeholderAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4zero}
+}
+
+// The HostKeyCallback used for every SSH connection
+func (s *HostKeyStore) Callback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		callback, err := s.loadCallback()
+		if err != nil {
+			return fmt.Errorf("failed to load known_hosts: %v", err)
+		}
+
+		err = callback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		address := knownhosts.Normalize(hostname)
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		if len(keyErr.Want) > 0 {
+			known := keyErr.Want[0]
+			for _, want := range keyErr.Want {
+				if want.Key.Type() == key.Type() {
+					known = want
+					break
+				}
+			}
+			return &HostKeyChangedError{
+				Address:     address,
+				KeyType:     key.Type(),
+				Fingerprint: fingerprint,
+				File:        known.Filename,
+				Line:        known.Line,
+			}
+		}
+
+		pending := PendingHostKey{
+			Address:     address,
+			KeyType:     key.Type(),
+			Fingerprint: fingerprint,
+			SeenAt:      time.Now(),
+			key:         key,
+		}
+		s.pending[address] = pending
+		logger.Warnf("Unknown host key for %s: %s %s", address, pending.KeyType, pending.Fingerprint)
+
+		return &UnknownHostKeyError{HostKey: pending}
+	}
+}
+
+// List host keys awaiting a decision
+func (s *HostKeyStore) Pending() []PendingHostKey {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := make([]PendingHostKey, 0, len(s.pending))
+	for _, pending := range s.pending {
+		keys = append(keys, pending)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Address < keys[j].Address
+	})
+	return keys
+}
+
+// Trust a pending host key and record it in known_hosts
+func (s *HostKeyStore) Accept(address, fingerprint string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	address = knownhosts.Normalize(address)
+	pending, exists := s.pending[address]
+	if !exists {
+		return fmt.Errorf("no pending host key for %s", address)
+	}
+	if pending.Fingerprint != fingerprint {
+		return fmt.Errorf("fingerprint %s does not match the pending key for %s", fingerprint, address)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintln(file, knownhosts.Line([]string{address}, pending.key)); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %v", err)
+	}
+
+	delete(s.pending, address)
+	logger.Infof("Trusted host key for %s: %s %s", address, pending.KeyType, pending.Fingerprint)
+	return nil
+}
+
+// Forget a pending host key without trusting it
+func (s *HostKeyStore) Reject(address, fingerprint string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	address = knownhosts.Normalize(address)
+	pending, exists := s.pending[address]
+	if !exists || pending.Fingerprint != fingerprint {
+		return fmt.Errorf("no pending host key %s for %s", fingerprint, address)
+	}
+
+	delete(s.pending, address)
+	logger.Infof("Rejected host key for %s: %s %s", address, pending.KeyType, pending.Fingerprint)
+	return nil
+}
@@ -1,19 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -21,38 +25,20 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-var (
-	logger        = logrus.New()
-	tunnelManager *SSHTunnelManager
-)
-
-// SSH tunnel manager that maintains persistent connections
-type SSHTunnelManager struct {
-	activeConnections map[string]*SSHConnection
-	mutex             sync.Mutex
-	controlDir        string
-}
-
-// SSH connection information
-type SSHConnection struct {
-	Username    string
-	Hostname    string
-	ControlPath string
-	Cmd         *exec.Cmd
-	LastUsed    time.Time
-	Active      bool
-}
+var logger = logrus.New()
 
 type SSHConnectionRequest struct {
-	Hostname string `json:"hostname"`
-	Username string `json:"username"`
+	SSHTarget
+	ContainerListOptions
 }
 
 type DockerContainer struct {
 	ID             string `json:"id"`
 	Name           string `json:"name"`
 	Image          string `json:"image"`
+	State          string `json:"state"` // running, exited, ...
 	Status         string `json:"status"`
+	Created        int64  `json:"created"` // Unix seconds
 	Ports          string `json:"ports"`
 	Labels         string `json:"labels"`         // New field to store raw label string
 	ComposeProject string `json:"composeProject"` // Computed field if the container is part of a Compose project
@@ -65,33 +51,51 @@ type ComposeGroup struct {
 	Containers []DockerContainer `json:"containers"`
 }
 
-// Final response structure
+// Final response structure; the groups only hold the containers of the page
 type DockerContainerResponse struct {
 	ComposeGroups []ComposeGroup    `json:"composeGroups"`
 	Ungrouped     []DockerContainer `json:"ungrouped"`
+	Total         int               `json:"total"` // Containers matching the filters, on every page
+	Page          int               `json:"page"`
+	PageSize      int               `json:"pageSize"` // Zero when every container is on the page
 }
 
 // Settings data file path
 const settingsFilePath = "/root/docker-extension/settings.json"
 
+// How long requests in flight and closing connections get once a shutdown signal arrives
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	var socketPath string
+	var relayEvents bool
 	flag.StringVar(&socketPath, "socket", "/run/guest-services/backend.sock", "Unix domain socket to listen on")
+	flag.BoolVar(&relayEvents, "events", false, "Print the tunnel events of the backend listening on -socket and exit when it stops")
 	flag.Parse()
 
+	if relayEvents {
+		if err := relayTunnelEvents(socketPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	_ = os.RemoveAll(socketPath)
 
 	logger.SetOutput(os.Stdout)
 
 	// Initialize SSH tunnel manager
-	var err error
-	tunnelManager, err = NewSSHTunnelManager()
+	tunnelManager, err := NewSSHTunnelManager()
 	if err != nil {
 		logger.Fatalf("Failed to initialize SSH tunnel manager: %v", err)
 	}
 
-	// Start cleanup routine for idle connections (check every minute, timeout after 30 minutes)
-	tunnelManager.StartCleanupRoutine(1*time.Minute, 10*time.Minute)
+	// Close connections idle for longer than their environment allows, checking every minute
+	tunnelManager.StartCleanupRoutine(1 * time.Minute)
+
+	// Bring back the connections that were open before the extension restarted
+	tunnelManager.RestoreConnections()
 
 	logMiddleware := middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Skipper: middleware.DefaultSkipper,
@@ -115,51 +119,52 @@ func main() {
 	}
 	router.Listener = ln
 
-	router.GET("/hello", hello)
-	router.POST("/connect", connectToRemoteDocker)
-	// Get settings
-	router.GET("/settings", getSettings)
-	// Save settings
-	router.POST("/settings", saveSettings)
-
-	router.POST("/tunnel/open", openTunnel)
-	router.POST("/tunnel/close", closeTunnel)
-	router.GET("/tunnel/status", getTunnelStatus)
-	router.GET("/tunnel/list", listTunnels)
-
-	// Container management endpoints
-	router.POST("/container/start", startContainer)
-	router.POST("/container/stop", stopContainer)
+	server := NewServer(tunnelManager)
+	server.Register(router)
 
-	// Image management endpoints
-	router.POST("/images/list", listImages)
-
-	// Volume management endpoints
-	router.POST("/volumes/list", listVolumes)
-	router.POST("/volumes/remove", removeVolume)
-
-	// Network management endpoints
-	router.POST("/networks/list", listNetworks)
-	router.POST("/networks/remove", removeNetwork)
-
-	router.POST("/container/logs", getContainerLogs)
-	router.POST("/compose/logs", getComposeLogs)
+	// The UI cannot open a WebSocket on the socket, terminals are served on a published port too
+	terminalRouter := echo.New()
+	terminalRouter.HideBanner = true
+	terminalRouter.HidePort = true
+	terminalRouter.Use(logMiddleware)
+	server.RegisterTerminals(terminalRouter)
+	go func() {
+		if err := terminalRouter.Start(fmt.Sprintf(":%d", terminalPort)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Terminals are unavailable: %v", err)
+		}
+	}()
 
-	router.POST("/dashboard/overview", getDashboardOverview)
-	router.POST("/dashboard/resources", getDashboardResources)
-	router.POST("/dashboard/systeminfo", getDashboardSystemInfo)
-	router.POST("/dashboard/events", getDashboardEvents)
+	// Serve until SIGINT or SIGTERM, which Docker Desktop sends when the extension stops
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Graceful shutdown handling
-	c := make(chan os.Signal, 1)
+	serverErr := make(chan error, 1)
 	go func() {
-		<-c
-		logger.Info("Shutting down, closing all SSH connections...")
-		tunnelManager.CloseAllConnections()
-		os.Exit(0)
+		serverErr <- router.Start(startURL)
 	}()
 
-	logger.Fatal(router.Start(startURL))
+	select {
+	case err := <-serverErr:
+		logger.Fatal(err)
+	case <-signals.Done():
+		stop()
+	}
+
+	// Event streams end, requests in flight finish, then the connections they used are closed
+	logger.Info("Shutting down, waiting for requests in flight...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := router.Shutdown(ctx); err != nil {
+		logger.Warnf("Requests still running at shutdown, dropping them: %v", err)
+		router.Close()
+	}
+	terminalRouter.Shutdown(ctx)
+
+	logger.Info("Closing all SSH connections...")
+	if err := tunnelManager.Shutdown(ctx); err != nil {
+		logger.Warnf("Shutdown incomplete: %v", err)
+	}
+	logger.Info("Shut down")
 }
 
 // Dashboard overview response
@@ -243,300 +248,212 @@ type EventsResponse struct {
 
 // Request for dashboard endpoints
 type DashboardRequest struct {
-	Hostname string `json:"hostname"`
-	Username string `json:"username"`
+	SSHTarget
 }
 
-// Add these handler functions to your main.go
-
 // Get dashboard overview statistics
-func getDashboardOverview(ctx echo.Context) error {
+func (s *Server) getDashboardOverview(ctx echo.Context) error {
 	var req DashboardRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Gather container statistics - using simpler commands
-	containerCmd := "sudo docker ps -a | wc -l && sudo docker ps | wc -l"
-	containerOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, containerCmd)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
+	if err != nil {
+		logger.Errorf("Error connecting to the container engine: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to get container statistics: %v", err),
+		})
+	}
+	reqCtx := ctx.Request().Context()
+	listCtx, cancel := withOperationTimeout(reqCtx, "dashboard overview", dockerListTimeout)
+	defer cancel()
+
+	// Gather container statistics
+	containers, err := engine.ContainerList(listCtx, true, nil)
 	if err != nil {
 		logger.Errorf("Error getting container stats: %v", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+		return ctx.JSON(errorStatus(err), map[string]string{
 			"error": fmt.Sprintf("Failed to get container statistics: %v", err),
 		})
 	}
 
-	// Parse container counts (accounting for header row)
-	containerLines := strings.Split(strings.TrimSpace(string(containerOutput)), "\n")
-	totalContainers, runningContainers := 0, 0
-	if len(containerLines) >= 2 {
-		total, err := strconv.Atoi(strings.TrimSpace(containerLines[0]))
-		if err == nil {
-			// Subtract 1 for the header row
-			totalContainers = total - 1
+	overview := DashboardOverview{}
+	projects := make(map[string][]DockerContainer)
+	for _, c := range containers {
+		overview.Containers.Total++
+		if c.State == "running" {
+			overview.Containers.Running++
 		}
-
-		running, err := strconv.Atoi(strings.TrimSpace(containerLines[1]))
-		if err == nil {
-			// Subtract 1 for the header row
-			runningContainers = running - 1
+		if project := c.Labels[composeProjectLabel]; project != "" {
+			projects[project] = append(projects[project], DockerContainer{Status: c.Status})
 		}
 	}
-
-	// Ensure we don't have negative values due to header subtraction
-	if totalContainers < 0 {
-		totalContainers = 0
-	}
-	if runningContainers < 0 {
-		runningContainers = 0
+	overview.Containers.Stopped = overview.Containers.Total - overview.Containers.Running
+
+	// Compose projects count by the state of their containers
+	overview.ComposeProjects.Total = len(projects)
+	for _, projectContainers := range projects {
+		status := computeGroupStatus(projectContainers)
+		switch {
+		case strings.HasPrefix(status, "Running"):
+			overview.ComposeProjects.Running++
+		case strings.HasPrefix(status, "Partial"):
+			overview.ComposeProjects.Partial++
+		default:
+			overview.ComposeProjects.Stopped++
+		}
 	}
 
-	// Gather image statistics - simpler approach
-	imageCmd := "sudo docker images | wc -l"
-	imageOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, imageCmd)
+	// Gather image statistics
+	images, err := engine.ImageList(listCtx)
 	if err != nil {
 		logger.Errorf("Error getting image stats: %v", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+		return ctx.JSON(errorStatus(err), map[string]string{
 			"error": fmt.Sprintf("Failed to get image statistics: %v", err),
 		})
 	}
+	overview.Images.Total = len(images)
 
-	// Parse image count (accounting for header row)
-	totalImages := 0
-	if len(imageOutput) > 0 {
-		count, err := strconv.Atoi(strings.TrimSpace(string(imageOutput)))
-		if err == nil && count > 0 {
-			totalImages = count - 1 // Subtract 1 for the header
-		}
-	}
-
-	// Gather disk usage for images (more basic approach)
-	imageSizeCmd := "sudo docker system df | grep Images || echo 'N/A'"
-	imageSizeOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, imageSizeCmd)
-	imageSize := "N/A"
-	if err == nil && len(imageSizeOutput) > 0 {
-		imageSizeLine := strings.TrimSpace(string(imageSizeOutput))
-		if imageSizeLine != "N/A" {
-			fields := strings.Fields(imageSizeLine)
-			if len(fields) >= 4 {
-				imageSize = fields[3]
-			}
-		}
-	}
-
-	// Gather volume statistics
-	volumeCmd := "sudo docker volume ls | wc -l"
-	volumeOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, volumeCmd)
-	totalVolumes := 0
-	if err == nil && len(volumeOutput) > 0 {
-		count, err := strconv.Atoi(strings.TrimSpace(string(volumeOutput)))
-		if err == nil && count > 0 {
-			totalVolumes = count - 1 // Subtract 1 for the header
-		}
+	// Disk usage is best effort, it can take a while on hosts with large volumes
+	overview.Images.Size = "N/A"
+	overview.Volumes.Size = "N/A"
+	dfCtx, cancelDf := withOperationTimeout(reqCtx, "disk usage", dockerDiskUsageTimeout)
+	defer cancelDf()
+	if usage, err := engine.SpaceUsage(dfCtx); err == nil {
+		overview.Images.Size = humanSize(usage.Images)
+		overview.Volumes.Size = humanSize(usage.Volumes)
+	} else {
+		logger.Warnf("Error getting disk usage: %v", err)
 	}
 
-	// Gather network statistics
-	networkCmd := "sudo docker network ls | wc -l"
-	networkOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, networkCmd)
-	totalNetworks := 0
-	if err == nil && len(networkOutput) > 0 {
-		count, err := strconv.Atoi(strings.TrimSpace(string(networkOutput)))
-		if err == nil && count > 0 {
-			totalNetworks = count - 1 // Subtract 1 for the header
-		}
+	if volumes, err := engine.VolumeList(listCtx); err == nil {
+		overview.Volumes.Total = len(volumes)
+	} else {
+		logger.Warnf("Error getting volume stats: %v", err)
 	}
 
-	// Gather compose project statistics (more tolerant approach)
-	composeCmd := "sudo docker ps --format '{{.Labels}}' | grep -c 'com.docker.compose.project' || echo 0"
-	composeOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, composeCmd)
-	totalCompose := 0
-	if err == nil && len(composeOutput) > 0 {
-		totalCompose, _ = strconv.Atoi(strings.TrimSpace(string(composeOutput)))
+	if networks, err := engine.NetworkList(listCtx); err == nil {
+		overview.Networks.Total = len(networks)
+	} else {
+		logger.Warnf("Error getting network stats: %v", err)
 	}
 
-	// Build the response
-	overview := DashboardOverview{}
-	overview.Containers.Total = totalContainers
-	overview.Containers.Running = runningContainers
-	overview.Containers.Stopped = totalContainers - runningContainers
-	overview.Images.Total = totalImages
-	overview.Images.Size = imageSize
-	overview.Volumes.Total = totalVolumes
-	overview.Volumes.Size = "N/A" // Would need additional commands to calculate
-	overview.Networks.Total = totalNetworks
-	overview.ComposeProjects.Total = totalCompose
-	overview.ComposeProjects.Running = 0 // Would need additional logic to determine
-	overview.ComposeProjects.Partial = 0 // Would need additional logic to determine
-	overview.ComposeProjects.Stopped = 0 // Would need additional logic to determine
-
 	return ctx.JSON(http.StatusOK, overview)
 }
 
+// Containers sampled at a time for the dashboard
+const dashboardStatsParallel = 4
+
 // Get resource usage for containers and system
-func getDashboardResources(ctx echo.Context) error {
+func (s *Server) getDashboardResources(ctx echo.Context) error {
 	var req DashboardRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Get container resource usage with docker stats
-	// Using a simpler format string that's more likely to work across different Docker versions
-	statsCmd := "sudo docker stats --no-stream --format 'table {{.ID}}|{{.Name}}|{{.CPUPerc}}|{{.MemUsage}}|{{.MemPerc}}|{{.NetIO}}|{{.BlockIO}}' || sudo docker stats --no-stream"
-	statsOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, statsCmd)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
 	if err != nil {
-		logger.Errorf("Error getting resource stats: %v", err)
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+		logger.Errorf("Error connecting to the container engine: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
 			"error": fmt.Sprintf("Failed to get resource statistics: %v", err),
 		})
 	}
+	reqCtx := ctx.Request().Context()
+	listCtx, cancel := withOperationTimeout(reqCtx, "listing containers", dockerListTimeout)
+	defer cancel()
 
-	// Parse stats output
-	lines := strings.Split(strings.TrimSpace(string(statsOutput)), "\n")
-	containers := make([]ContainerResource, 0)
-
-	// Skip the header row, process all rows even if we don't have delimiters
-	for i := 1; i < len(lines); i++ {
-		line := lines[i]
-
-		// Try to parse with our delimiter first
-		fields := strings.Split(line, "|")
-
-		// If our custom format didn't work, we'll have the default docker stats output
-		// Try to parse using standard spaces as delimiters
-		if len(fields) < 7 {
-			// Default docker stats has columns separated by variable whitespace
-			// We'll make a best effort to parse it
-			fields = strings.Fields(line)
-			if len(fields) < 7 {
-				continue // Not enough fields, skip this line
-			}
-
-			// With default stats, order is different:
-			// CONTAINER ID, NAME, CPU %, MEM USAGE / LIMIT, MEM %, NET I/O, BLOCK I/O, PIDS
-
-			id := fields[0]
-			name := fields[1]
-			cpuPerc := fields[2]
-			memUsage := fields[3] + " " + fields[4] + " " + fields[5]
-			memPerc := fields[6]
-			netIO := "N/A"
-			blockIO := "N/A"
+	running, err := engine.ContainerList(listCtx, false, nil)
+	if err != nil {
+		logger.Errorf("Error getting resource stats: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to get resource statistics: %v", err),
+		})
+	}
 
-			if len(fields) >= 8 {
-				netIO = fields[7]
-			}
-			if len(fields) >= 9 {
-				blockIO = fields[8]
-			}
+	// A one-shot stats sample takes the daemon about a second, so containers are sampled in parallel,
+	// a few at a time so a host with hundreds of them does not get as many sessions at once
+	containers := make([]ContainerResource, len(running))
+	sampled := make([]bool, len(running))
+	slots := make(chan struct{}, dashboardStatsParallel)
+	var wg sync.WaitGroup
+	for i, c := range running {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, c ContainerSummary) {
+			defer wg.Done()
+			defer func() { <-slots }()
 
-			// Parse CPU percentage
-			cpuValue := 0.0
-			if strings.Contains(cpuPerc, "%") {
-				cpuValue, _ = strconv.ParseFloat(strings.TrimSuffix(cpuPerc, "%"), 64)
-			}
+			statsCtx, cancel := withOperationTimeout(reqCtx, "container stats", dockerStatsTimeout)
+			defer cancel()
 
-			// Parse memory percentage
-			memValue := 0.0
-			if strings.Contains(memPerc, "%") {
-				memValue, _ = strconv.ParseFloat(strings.TrimSuffix(memPerc, "%"), 64)
+			usage, err := engine.ContainerUsage(statsCtx, c.ID)
+			if err != nil {
+				// The container may have stopped since it was listed
+				logger.Warnf("Error getting stats of container %s: %v", c.Name(), err)
+				return
 			}
 
-			container := ContainerResource{
-				ID:       id,
-				Name:     name,
-				CPUPerc:  cpuPerc,
-				CPUUsage: cpuValue,
-				MemUsage: memUsage,
-				MemPerc:  memPerc,
-				MemValue: memValue,
-				NetIO:    netIO,
-				BlockIO:  blockIO,
+			mem := 0.0
+			if usage.MemoryLimit > 0 {
+				mem = float64(usage.MemoryUsage) / float64(usage.MemoryLimit) * 100
 			}
 
-			containers = append(containers, container)
-			continue
-		}
-
-		// If we have our expected delimiter format
-		if len(fields) >= 7 {
-			// Parse CPU percentage
-			cpuPerc := strings.TrimSpace(fields[2])
-			cpuValue, _ := strconv.ParseFloat(strings.TrimSuffix(cpuPerc, "%"), 64)
-
-			// Parse memory percentage
-			memPerc := strings.TrimSpace(fields[4])
-			memValue, _ := strconv.ParseFloat(strings.TrimSuffix(memPerc, "%"), 64)
-
-			container := ContainerResource{
-				ID:       strings.TrimSpace(fields[0]),
-				Name:     strings.TrimSpace(fields[1]),
-				CPUPerc:  cpuPerc,
-				CPUUsage: cpuValue,
-				MemUsage: strings.TrimSpace(fields[3]),
-				MemPerc:  memPerc,
-				MemValue: memValue,
-				NetIO:    strings.TrimSpace(fields[5]),
-				BlockIO:  strings.TrimSpace(fields[6]),
+			containers[i] = ContainerResource{
+				ID:       shortID(c.ID),
+				Name:     c.Name(),
+				CPUPerc:  fmt.Sprintf("%.2f%%", usage.CPUPercent),
+				CPUUsage: usage.CPUPercent,
+				MemUsage: fmt.Sprintf("%s / %s", bytesSize(usage.MemoryUsage), bytesSize(usage.MemoryLimit)),
+				MemPerc:  fmt.Sprintf("%.2f%%", mem),
+				MemValue: mem,
+				NetIO:    fmt.Sprintf("%s / %s", humanSize(int64(usage.NetworkRx)), humanSize(int64(usage.NetworkTx))),
+				BlockIO:  fmt.Sprintf("%s / %s", humanSize(int64(usage.BlockRead)), humanSize(int64(usage.BlockWrite))),
 			}
-
-			containers = append(containers, container)
-		}
-	}
-
-	// Get system resource usage using more basic commands that are more likely to be available
-	// First, try a simpler CPU usage check
-	cpuUsage := 0.0
-	// cpuCmd := "sudo top -bn1 | grep '%Cpu' | awk '{print 100 - $8}' || echo 0"
-	cpuCmd := "sudo vmstat 1 2 | tail -1 | awk '{print 100-$15}' || echo 0"
-
-	cpuOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, cpuCmd)
-	if err == nil && len(cpuOutput) > 0 {
-		cpuUsage, _ = strconv.ParseFloat(strings.TrimSpace(string(cpuOutput)), 64)
+			sampled[i] = true
+		}(i, c)
 	}
+	wg.Wait()
 
-	// Memory usage
-	memUsage := 0.0
-	memCmd := "sudo free | grep Mem | awk '{print $3/$2 * 100}' || echo 0"
-	memOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, memCmd)
-	if err == nil && len(memOutput) > 0 {
-		memUsage, _ = strconv.ParseFloat(strings.TrimSpace(string(memOutput)), 64)
+	resources := ResourcesResponse{
+		Containers: make([]ContainerResource, 0, len(containers)),
 	}
-
-	// Disk usage
-	diskUsage := 0.0
-	diskCmd := "sudo df -h / | awk 'NR==2 {print $5}' | sed 's/%//' || echo 0"
-	diskOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, diskCmd)
-	if err == nil && len(diskOutput) > 0 {
-		diskUsage, _ = strconv.ParseFloat(strings.TrimSpace(string(diskOutput)), 64)
+	for i, container := range containers {
+		if sampled[i] {
+			resources.Containers = append(resources.Containers, container)
+		}
 	}
 
-	// Build the response
-	resources := ResourcesResponse{
-		Containers: containers,
+	// Host usage comes from the host itself, the daemon does not report it
+	usageCtx, cancelUsage := withOperationTimeout(reqCtx, "host resource usage", hostUsageTimeout)
+	defer cancelUsage()
+	usage, err := s.tunnels.HostUsage(usageCtx, req.SSHTarget)
+	if err != nil {
+		logger.Warnf("Error getting host resource usage: %v", err)
 	}
-	resources.System.CPUUsage = cpuUsage
-	resources.System.MemoryUsage = memUsage
-	resources.System.DiskUsage = diskUsage
+	resources.System.CPUUsage = usage.CPU
+	resources.System.MemoryUsage = usage.Memory
+	resources.System.DiskUsage = usage.Disk
 
 	return ctx.JSON(http.StatusOK, resources)
 }
 
-// Get Docker system information - simplified to avoid version-specific commands
-func getDashboardSystemInfo(ctx echo.Context) error {
+// Get Docker system information
+func (s *Server) getDashboardSystemInfo(ctx echo.Context) error {
 	var req DashboardRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
@@ -553,154 +470,119 @@ func getDashboardSystemInfo(ctx echo.Context) error {
 		ExperimentalMode: false,
 	}
 
-	// Get Docker version - simple command
-	versionCmd := "sudo docker version | grep 'Server Version' | awk '{print $3}' || echo 'Unknown'"
-	versionOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, versionCmd)
-	if err == nil && len(versionOutput) > 0 {
-		info.DockerVersion = strings.TrimSpace(string(versionOutput))
-	}
-
-	// Get API version - simple command
-	apiCmd := "sudo docker version | grep 'API version' | head -1 | awk '{print $3}' || echo 'Unknown'"
-	apiOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, apiCmd)
-	if err == nil && len(apiOutput) > 0 {
-		info.APIVersion = strings.TrimSpace(string(apiOutput))
-	}
-
-	// Get OS info
-	osCmd := "uname -s || echo 'Unknown'"
-	osOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, osCmd)
-	if err == nil && len(osOutput) > 0 {
-		info.OS = strings.TrimSpace(string(osOutput))
+	engine, err := s.tunnels.Engine(req.SSHTarget)
+	if err != nil {
+		logger.Errorf("Error connecting to the container engine: %v", err)
+		return ctx.JSON(http.StatusOK, info)
 	}
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "system info", dockerInfoTimeout)
+	defer cancel()
 
-	// Get architecture
-	archCmd := "uname -m || echo 'Unknown'"
-	archOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, archCmd)
-	if err == nil && len(archOutput) > 0 {
-		info.Architecture = strings.TrimSpace(string(archOutput))
+	if version, err := engine.Version(reqCtx); err == nil {
+		info.DockerVersion = version.Version
+		info.APIVersion = version.APIVersion
+	} else {
+		logger.Warnf("Error getting Docker version: %v", err)
 	}
 
-	// Get CPU count
-	cpuCmd := "nproc || echo 0"
-	cpuOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, cpuCmd)
-	if err == nil && len(cpuOutput) > 0 {
-		cpus, err := strconv.Atoi(strings.TrimSpace(string(cpuOutput)))
-		if err == nil {
-			info.CPUs = cpus
+	if system, err := engine.Info(reqCtx); err == nil {
+		info.OS = system.OperatingSystem
+		if info.OS == "" {
+			info.OS = system.OSType
 		}
+		info.Architecture = system.Architecture
+		info.CPUs = system.NCPU
+		info.Memory = bytesSize(uint64(system.MemTotal))
+		info.DockerRoot = system.DockerRootDir
+		if serverTime, err := time.Parse(time.RFC3339Nano, system.SystemTime); err == nil {
+			info.ServerTime = serverTime.Format("2006-01-02 15:04:05 MST")
+		}
+		info.ExperimentalMode = system.ExperimentalBuild
+	} else {
+		logger.Warnf("Error getting Docker info: %v", err)
 	}
 
-	// Get memory
-	memCmd := "free -h | grep Mem | awk '{print $2}' || echo 'Unknown'"
-	memOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, memCmd)
-	if err == nil && len(memOutput) > 0 {
-		info.Memory = strings.TrimSpace(string(memOutput))
-	}
-
-	// Get Docker root directory
-	rootCmd := "sudo docker info | grep 'Docker Root Dir' | awk '{print $4}' || echo 'Unknown'"
-	rootOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, rootCmd)
-	if err == nil && len(rootOutput) > 0 {
-		info.DockerRoot = strings.TrimSpace(string(rootOutput))
-	}
-
-	// Get server time
-	timeCmd := "date +'%Y-%m-%d %H:%M:%S %Z' || echo 'Unknown'"
-	timeOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, timeCmd)
-	if err == nil && len(timeOutput) > 0 {
-		info.ServerTime = strings.TrimSpace(string(timeOutput))
-	}
-
-	// Check if experimental mode is enabled
-	expCmd := "sudo docker info | grep -q 'Experimental: true' && echo 'true' || echo 'false'"
-	expOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, expCmd)
-	if err == nil && len(expOutput) > 0 {
-		info.ExperimentalMode = strings.TrimSpace(string(expOutput)) == "true"
+	// Defaults are fine for a field that failed, a daemon that does not answer is not
+	var timeout *TimeoutError
+	if errors.As(contextError(reqCtx, reqCtx.Err()), &timeout) {
+		return ctx.JSON(http.StatusGatewayTimeout, map[string]string{
+			"error": fmt.Sprintf("Failed to get system info: %v", timeout),
+		})
 	}
 
 	return ctx.JSON(http.StatusOK, info)
 }
 
+// Number of recent events shown on the dashboard
+const dashboardEventCount = 20
+
 // Get recent Docker events
-func getDashboardEvents(ctx echo.Context) error {
+func (s *Server) getDashboardEvents(ctx echo.Context) error {
 	var req DashboardRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Get recent Docker events (up to 20 events, simpler command)
-	eventsCmd := "sudo docker events --format '{{json .}}' --since 24h --until 0s | tail -20 || echo '[]'"
-	eventsOutput, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, eventsCmd)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
 	if err != nil {
 		logger.Errorf("Error getting Docker events: %v", err)
 		// Return empty events array rather than an error
 		return ctx.JSON(http.StatusOK, EventsResponse{Events: []DockerEvent{}})
 	}
 
-	// Parse events
-	lines := strings.Split(strings.TrimSpace(string(eventsOutput)), "\n")
-	events := make([]DockerEvent, 0)
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "docker events", dockerEventsTimeout)
+	defer cancel()
 
-	for _, line := range lines {
-		if line == "" || line == "[]" {
-			continue
-		}
-
-		// Try to parse the event JSON
-		var event struct {
-			Time   int64  `json:"time"`
-			Status string `json:"status"`
-			ID     string `json:"id"`
-			From   string `json:"from"`
-			Type   string `json:"Type"`
-			Actor  struct {
-				ID         string            `json:"ID"`
-				Attributes map[string]string `json:"Attributes"`
-			} `json:"Actor"`
+	now := time.Now()
+	messages, err := engine.Events(reqCtx, now.Add(-24*time.Hour), now, dashboardEventCount)
+	if err != nil {
+		logger.Errorf("Error getting Docker events: %v", err)
+		if errorStatus(err) == http.StatusGatewayTimeout {
+			return ctx.JSON(http.StatusGatewayTimeout, map[string]string{
+				"error": fmt.Sprintf("Failed to get events: %v", err),
+			})
 		}
+		return ctx.JSON(http.StatusOK, EventsResponse{Events: []DockerEvent{}})
+	}
 
-		if err := json.Unmarshal([]byte(line), &event); err != nil {
-			logger.Warnf("Failed to parse event: %v", err)
-			continue
+	events := make([]DockerEvent, 0, len(messages))
+	for _, event := range messages {
+		action := event.Action
+		if action == "" {
+			action = event.Status
 		}
 
 		// Determine category (info, warning, error)
 		category := "info"
-		if strings.Contains(event.Status, "kill") || strings.Contains(event.Status, "die") {
+		if strings.Contains(action, "kill") || strings.Contains(action, "die") {
 			category = "warning"
-		} else if strings.Contains(event.Status, "destroy") || strings.Contains(event.Status, "delete") {
+		} else if strings.Contains(action, "destroy") || strings.Contains(action, "delete") {
 			category = "error"
 		}
 
-		// Convert time to readable format
-		timeStr := time.Unix(event.Time, 0).Format("2006-01-02 15:04:05")
-
 		// Extract name from attributes if available
-		name := event.ID
-		if event.Actor.Attributes != nil {
-			if n, ok := event.Actor.Attributes["name"]; ok {
-				name = n
-			}
+		name := event.Actor.ID
+		if name == "" {
+			name = event.ID
+		}
+		if n, ok := event.Actor.Attributes["name"]; ok {
+			name = n
 		}
 
-		// Create the event
-		dockerEvent := DockerEvent{
+		events = append(events, DockerEvent{
 			Time:     event.Time,
-			TimeStr:  timeStr,
+			TimeStr:  time.Unix(event.Time, 0).Format("2006-01-02 15:04:05"),
 			Type:     event.Type,
-			Action:   event.Status,
+			Action:   action,
 			Actor:    name,
 			Status:   "success", // Assuming success since it was recorded
 			Message:  event.From,
 			Category: category,
-		}
-
-		events = append(events, dockerEvent)
+		})
 	}
 
 	// Sort events by time (newest first)
@@ -713,109 +595,128 @@ func getDashboardEvents(ctx echo.Context) error {
 
 // Request for container logs
 type ContainerLogsRequest struct {
-	Hostname    string `json:"hostname"`
-	Username    string `json:"username"`
+	SSHTarget
 	ContainerId string `json:"containerId"`
 	Tail        int    `json:"tail"`       // Number of lines to show from the end
 	Timestamps  bool   `json:"timestamps"` // Show timestamps
 }
 
-// Stream container logs
-// Stream container logs with keepalive
-func getContainerLogs(ctx echo.Context) error {
+// Get the logs of a container
+func (s *Server) getContainerLogs(ctx echo.Context) error {
 	var req ContainerLogsRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" || req.ContainerId == "" {
+	if req.missingFields() || req.ContainerId == "" {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Build docker logs command with appropriate options
-	dockerCmd := strings.Builder{}
-	dockerCmd.WriteString("sudo docker logs")
-
-	// Add options
-	if req.Tail > 0 {
-		dockerCmd.WriteString(fmt.Sprintf(" --tail %d", req.Tail))
+	if err := ValidateIdentifier(ContainerObject, req.ContainerId); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
-	if req.Timestamps {
-		dockerCmd.WriteString(" --timestamps")
-	}
-
-	// Add container ID
-	dockerCmd.WriteString(fmt.Sprintf(" %s", req.ContainerId))
 
-	logger.Infof("Executing log command: %s", dockerCmd.String())
-
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCmd.String())
+	engine, err := s.tunnels.Engine(req.SSHTarget)
 	if err != nil {
-		logger.Errorf("Error reading logs: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to read logs: %v", err),
-			"output": string(output),
+		logger.Errorf("Error reading logs: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to read logs: %v", err),
 		})
 	}
 
-	// Split into lines for returning a JSON array
-	lines := strings.Split(string(output), "\n")
-	// If the last line is empty, trim it
-	if len(lines) > 0 && lines[len(lines)-1] == "" {
-		lines = lines[:len(lines)-1]
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "reading logs", dockerLogsTimeout)
+	defer cancel()
+
+	lines, err := engine.ContainerLogs(reqCtx, req.ContainerId, req.Tail, req.Timestamps)
+	if err != nil {
+		logger.Errorf("Error reading logs: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to read logs: %v", err),
+		})
 	}
 
 	return ctx.JSON(http.StatusOK, ContainerLogsResponse{Success: "true", Logs: lines})
 }
 
 type ComposeLogsRequest struct {
-	Hostname       string `json:"hostname"`
-	Username       string `json:"username"`
+	SSHTarget
 	ComposeProject string `json:"composeProject"`
 	Tail           int    `json:"tail"`       // Number of lines to show from the end
 	Timestamps     bool   `json:"timestamps"` // Show timestamps
 }
 
-func getComposeLogs(ctx echo.Context) error {
+// Get the logs of every container of a Compose project, merged in time order like docker compose logs
+func (s *Server) getComposeLogs(ctx echo.Context) error {
 	var req ComposeLogsRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" || req.ComposeProject == "" {
+	if req.missingFields() || req.ComposeProject == "" {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Build docker logs command with appropriate options
-	dockerCmd := strings.Builder{}
-	dockerCmd.WriteString(fmt.Sprintf("sudo docker compose -p %s logs", req.ComposeProject))
-
-	// Add options
-	if req.Tail > 0 {
-		dockerCmd.WriteString(fmt.Sprintf(" --tail %d", req.Tail))
-	}
-	if req.Timestamps {
-		dockerCmd.WriteString(" --timestamps")
+	if err := ValidateIdentifier(ComposeProjectObject, req.ComposeProject); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	logger.Infof("Executing log command: %s", dockerCmd.String())
+	engine, err := s.tunnels.Engine(req.SSHTarget)
+	if err != nil {
+		logger.Errorf("Error reading logs: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to read logs: %v", err),
+		})
+	}
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "reading logs", dockerLogsTimeout)
+	defer cancel()
 
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCmd.String())
+	containers, err := engine.ContainerList(reqCtx, true, map[string][]string{
+		"label": {composeProjectLabel + "=" + req.ComposeProject},
+	})
 	if err != nil {
-		logger.Errorf("Error reading logs: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to read logs: %v", err),
-			"output": string(output),
+		logger.Errorf("Error reading logs: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to read logs: %v", err),
 		})
 	}
 
-	// Split into lines for returning a JSON array
-	lines := strings.Split(string(output), "\n")
-	// If the last line is empty, trim it
-	if len(lines) > 0 && lines[len(lines)-1] == "" {
-		lines = lines[:len(lines)-1]
+	type logLine struct {
+		time time.Time
+		text string
+	}
+
+	var merged []logLine
+	for _, c := range containers {
+		// Timestamps are always requested, they are what the lines are merged by
+		lines, err := engine.ContainerLogs(reqCtx, c.ID, req.Tail, true)
+		if err != nil {
+			logger.Errorf("Error reading logs of %s: %v", c.Name(), err)
+			return ctx.JSON(errorStatus(err), map[string]string{
+				"error": fmt.Sprintf("Failed to read logs: %v", err),
+			})
+		}
+
+		prefix := strings.TrimPrefix(c.Name(), req.ComposeProject+"-") + "  | "
+		for _, line := range lines {
+			timestamp, text, _ := strings.Cut(line, " ")
+			parsed, err := time.Parse(time.RFC3339Nano, timestamp)
+			if err != nil {
+				// Not a timestamp after all, keep the line as it is
+				text = line
+			} else if req.Timestamps {
+				text = timestamp + " " + text
+			}
+			merged = append(merged, logLine{time: parsed, text: prefix + text})
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].time.Before(merged[j].time)
+	})
+
+	lines := make([]string, 0, len(merged))
+	for _, line := range merged {
+		lines = append(lines, line.text)
 	}
 
 	return ctx.JSON(http.StatusOK, ContainerLogsResponse{Success: "true", Logs: lines})
@@ -827,354 +728,269 @@ type ContainerLogsResponse struct {
 	Logs    []string `json:"logs"`
 }
 
-// Create a new SSH tunnel manager
-func NewSSHTunnelManager() (*SSHTunnelManager, error) {
-	// Create directory for SSH control sockets
-	controlDir := "/tmp/docker-remote-ssh"
-	if err := os.MkdirAll(controlDir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create control directory: %v", err)
-	}
-
-	return &SSHTunnelManager{
-		activeConnections: make(map[string]*SSHConnection),
-		controlDir:        controlDir,
-	}, nil
+// Request for the configuration and state of a container
+type ContainerInspectRequest struct {
+	SSHTarget
+	ContainerId   string `json:"containerId"`
+	RevealSecrets bool   `json:"revealSecrets"` // Show env values that look like secrets
 }
 
-// Generate connection key for mapping
-func connectionKey(username, hostname string) string {
-	return fmt.Sprintf("%s@%s", username, hostname)
+type ContainerInspectResponse struct {
+	Success   string              `json:"success"`
+	Container ContainerInspection `json:"container"`
 }
 
-// Create and start a new SSH connection
-func (m *SSHTunnelManager) OpenConnection(username, hostname string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	key := connectionKey(username, hostname)
-
-	// Check if connection already exists
-	if conn, exists := m.activeConnections[key]; exists && conn.Active {
-		// Update last used time
-		conn.LastUsed = time.Now()
-		logger.Infof("Reusing existing SSH connection for %s", key)
-		return nil
-	}
-
-	// Create control socket path
-	controlPath := filepath.Join(m.controlDir, fmt.Sprintf("ssh-%s.sock", key))
-
-	// Remove existing control socket if it exists
-	if _, err := os.Stat(controlPath); err == nil {
-		if err := os.Remove(controlPath); err != nil {
-			logger.Warnf("Failed to remove existing control socket: %v", err)
-		}
+// Inspect a container
+func (s *Server) inspectContainer(ctx echo.Context) error {
+	var req ContainerInspectRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	// Start SSH master connection with control socket
-	cmd := exec.Command("ssh",
-		"-M",              // Master mode for connection sharing
-		"-S", controlPath, // Control socket path
-		"-o", "ControlPersist=yes",
-		"-o", "ServerAliveInterval=10",
-		"-o", "ServerAliveCountMax=2",
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "BatchMode=yes", // Non-interactive mode
-		"-N", // Don't execute any command, just forward
-		fmt.Sprintf("%s@%s", username, hostname),
-	)
-
-	// Start the SSH connection
-	logger.Infof("Starting new SSH master connection for %s", key)
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start SSH connection: %v", err)
-	}
-
-	// Wait a moment for connection to establish
-	time.Sleep(1 * time.Second)
-
-	// Check if connection was successful by running a test command
-	testCmd := exec.Command("ssh",
-		"-o ConnectTimeout=5",
-		"-S", controlPath,
-		"-o", "StrictHostKeyChecking=no",
-		fmt.Sprintf("%s@%s", username, hostname),
-		"echo 'Connection test'",
-	)
-
-	output, err := testCmd.CombinedOutput()
-	if err != nil {
-		// Try to kill the master connection if test failed
-		cmd.Process.Kill()
-		return fmt.Errorf("failed to establish SSH connection: %v, output: %s", err, string(output))
+	if req.missingFields() || req.ContainerId == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Store the connection
-	m.activeConnections[key] = &SSHConnection{
-		Username:    username,
-		Hostname:    hostname,
-		ControlPath: controlPath,
-		Cmd:         cmd,
-		LastUsed:    time.Now(),
-		Active:      true,
+	if err := ValidateIdentifier(ContainerObject, req.ContainerId); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	logger.Infof("Successfully established SSH connection for %s", key)
-	return nil
-}
-
-// Close a specific SSH connection
-func (m *SSHTunnelManager) CloseConnection(username, hostname string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	key := connectionKey(username, hostname)
-	conn, exists := m.activeConnections[key]
-	if !exists || !conn.Active {
-		return nil // Connection doesn't exist or is already closed
+	engine, err := s.tunnels.Engine(req.SSHTarget)
+	if err != nil {
+		logger.Errorf("Error inspecting container: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to inspect container: %v", err),
+		})
 	}
 
-	// Close the connection using control socket
-	closeCmd := exec.Command("ssh",
-		"-o ConnectTimeout=5",
-		"-S", conn.ControlPath,
-		"-O", "exit", // Send exit command to master process
-		fmt.Sprintf("%s@%s", username, hostname),
-	)
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "inspecting container", dockerInspectTimeout)
+	defer cancel()
 
-	logger.Infof("Closing SSH connection for %s", key)
-	output, err := closeCmd.CombinedOutput()
+	details, err := engine.ContainerInspect(reqCtx, req.ContainerId)
 	if err != nil {
-		logger.Warnf("Error closing SSH connection cleanly: %v, output: %s", err, string(output))
-		// Try to kill the process directly if clean exit fails
-		if conn.Cmd != nil && conn.Cmd.Process != nil {
-			conn.Cmd.Process.Kill()
-		}
+		logger.Errorf("Error inspecting container: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to inspect container: %v", err),
+		})
 	}
 
-	// Clean up the control socket
-	if _, err := os.Stat(conn.ControlPath); err == nil {
-		if err := os.Remove(conn.ControlPath); err != nil {
-			logger.Warnf("Failed to remove control socket: %v", err)
-		}
+	if req.RevealSecrets {
+		logger.Infof("Revealing environment of container %s", req.ContainerId)
 	}
-
-	// Mark as inactive and remove from map
-	conn.Active = false
-	delete(m.activeConnections, key)
-
-	return nil
+	return ctx.JSON(http.StatusOK, ContainerInspectResponse{
+		Success:   "true",
+		Container: NewContainerInspection(details, req.RevealSecrets),
+	})
 }
 
-// Close all active SSH connections
-func (m *SSHTunnelManager) CloseAllConnections() {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	for key, conn := range m.activeConnections {
-		if conn.Active {
-			// Close the connection using control socket
-			closeCmd := exec.Command("ssh",
-				"-o ConnectTimeout=5",
-				"-S", conn.ControlPath,
-				"-O", "exit",
-				fmt.Sprintf("%s@%s", conn.Username, conn.Hostname),
-			)
-
-			logger.Infof("Closing SSH connection for %s", key)
-			output, err := closeCmd.CombinedOutput()
-			if err != nil {
-				logger.Warnf("Error closing SSH connection cleanly: %v, output: %s", err, string(output))
-				// Try to kill the process directly
-				if conn.Cmd != nil && conn.Cmd.Process != nil {
-					conn.Cmd.Process.Kill()
-				}
-			}
-
-			// Clean up control socket
-			if _, err := os.Stat(conn.ControlPath); err == nil {
-				os.Remove(conn.ControlPath)
-			}
-		}
-	}
+// Where the UI opens the WebSocket of a terminal; the token lets it in once
+type TerminalResponse struct {
+	Success string `json:"success"`
+	Token   string `json:"token"`
+	Port    int    `json:"port"` // Published on localhost
+	Path    string `json:"path"`
 
-	// Clear the map
-	m.activeConnections = make(map[string]*SSHConnection)
+	Transcript string `json:"transcript,omitempty"` // File the output is recorded to
 }
 
-// Execute a command using an existing SSH connection
-func (m *SSHTunnelManager) ExecuteCommand(username, hostname, command string) ([]byte, error) {
-	m.mutex.Lock()
-	key := connectionKey(username, hostname)
-	conn, exists := m.activeConnections[key]
-
-	if !exists || !conn.Active {
-		// No active connection, try to open one
-		m.mutex.Unlock()
-		if err := m.OpenConnection(username, hostname); err != nil {
-			return nil, fmt.Errorf("failed to open connection: %v", err)
-		}
-		m.mutex.Lock()
-		conn = m.activeConnections[key]
+// Prepare a shell in a running container, which its WebSocket on GET /container/exec starts
+func (s *Server) createContainerExec(ctx echo.Context) error {
+	var req ContainerExecRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	// Update last used time
-	conn.LastUsed = time.Now()
-	controlPath := conn.ControlPath
-	m.mutex.Unlock()
-
-	// Execute command using the control socket
-	cmd := exec.Command("ssh",
-		"-o ConnectTimeout=5",
-		"-S", controlPath,
-		"-o", "StrictHostKeyChecking=no",
-		fmt.Sprintf("%s@%s", username, hostname),
-		command,
-	)
-
-	// Run the command and return output
-	return cmd.CombinedOutput()
-}
-
-// Check if connection is active
-func (m *SSHTunnelManager) IsConnectionActive(username, hostname string) bool {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	key := connectionKey(username, hostname)
-	conn, exists := m.activeConnections[key]
-	if !exists || !conn.Active {
-		return false
+	if req.missingFields() || req.ContainerId == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Test connection by running a simple command
-	testCmd := exec.Command("ssh",
-		"-o ConnectTimeout=5",
-		"-S", conn.ControlPath,
-		"-o", "StrictHostKeyChecking=no",
-		fmt.Sprintf("%s@%s", username, hostname),
-		"echo 'Connection test'",
-	)
+	if err := req.Validate(); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
-	if err := testCmd.Run(); err != nil {
-		logger.Warnf("SSH connection for %s appears to be broken: %v", key, err)
-		conn.Active = false
-		return false
+	engine, err := s.tunnels.Engine(req.SSHTarget)
+	if err != nil {
+		logger.Errorf("Error opening terminal: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to open terminal: %v", err),
+		})
 	}
 
-	return true
-}
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "opening terminal", dockerInspectTimeout)
+	defer cancel()
 
-// Get a list of all active connections
-func (m *SSHTunnelManager) GetActiveConnections() []string {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	// Checked now, as the WebSocket can only tell why it failed once it is open
+	details, err := engine.ContainerInspect(reqCtx, req.ContainerId)
+	if err == nil && (!details.State.Running || details.State.Paused) {
+		err = &EngineError{Engine: req.engine(), Message: fmt.Sprintf("container %s is not running", req.ContainerId)}
+	}
+	if err != nil {
+		logger.Errorf("Error opening terminal: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to open terminal: %v", err),
+		})
+	}
 
-	var connections []string
-	for key, conn := range m.activeConnections {
-		if conn.Active {
-			connections = append(connections, key)
-		}
+	const path = "/container/exec"
+	token, err := s.terminals.add(pendingTerminal{path: path, open: func() (*Terminal, error) {
+		return s.tunnels.ExecContainer(req)
+	}})
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": fmt.Sprintf("Failed to open terminal: %v", err),
+		})
 	}
-	return connections
+	return ctx.JSON(http.StatusOK, TerminalResponse{Success: "true", Token: token, Port: terminalPort, Path: path})
 }
 
-// Clean up old, unused connections
-func (m *SSHTunnelManager) CleanupIdleConnections(idleTimeout time.Duration) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+// Prepare a login shell on the host of an SSH environment, which its WebSocket on GET /host/terminal starts
+func (s *Server) createHostTerminal(ctx echo.Context) error {
+	var req HostTerminalRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
 
-	now := time.Now()
-	for key, conn := range m.activeConnections {
-		if conn.Active && now.Sub(conn.LastUsed) > idleTimeout {
-			logger.Infof("Closing idle SSH connection for %s (idle for %v)", key, now.Sub(conn.LastUsed))
-
-			// Close the connection using control socket
-			closeCmd := exec.Command("ssh",
-				"-o ConnectTimeout=5",
-				"-S", conn.ControlPath,
-				"-O", "exit",
-				fmt.Sprintf("%s@%s", conn.Username, conn.Hostname),
-			)
-
-			output, err := closeCmd.CombinedOutput()
-			if err != nil {
-				logger.Warnf("Error closing idle SSH connection: %v, output: %s", err, string(output))
-				// Try to kill the process directly
-				if conn.Cmd != nil && conn.Cmd.Process != nil {
-					conn.Cmd.Process.Kill()
-				}
-			}
+	if req.missingFields() {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
 
-			// Clean up control socket
-			if _, err := os.Stat(conn.ControlPath); err == nil {
-				os.Remove(conn.ControlPath)
-			}
+	if err := req.Validate(); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
-			// Mark as inactive and remove from map
-			conn.Active = false
-			delete(m.activeConnections, key)
-		}
+	// Other transports have no host to log in to
+	if req.transport() != TransportSSH {
+		err := &UnsupportedTransportError{Transport: req.transport(), Operation: "host terminals"}
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to open terminal: %v", err),
+		})
 	}
-}
 
-// Start the background cleanup routine
-func (m *SSHTunnelManager) StartCleanupRoutine(checkInterval time.Duration, idleTimeout time.Duration) {
-	go func() {
-		ticker := time.NewTicker(checkInterval)
-		defer ticker.Stop()
+	var transcript string
+	if req.Transcript {
+		transcript = filepath.Join(s.transcriptsDir, transcriptName(req.SSHTarget, time.Now()))
+	}
 
-		for range ticker.C {
-			m.CleanupIdleConnections(idleTimeout)
-		}
-	}()
+	const path = "/host/terminal"
+	token, err := s.terminals.add(pendingTerminal{
+		path: path,
+		open: func() (*Terminal, error) {
+			return s.tunnels.OpenHostTerminal(req)
+		},
+		idleTimeout: req.idleTimeout(),
+		transcript:  transcript,
+	})
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": fmt.Sprintf("Failed to open terminal: %v", err),
+		})
+	}
+	return ctx.JSON(http.StatusOK, TerminalResponse{Success: "true", Token: token, Port: terminalPort, Path: path, Transcript: transcript})
 }
 
 // /////////////////////////////// SSH TunnelAPI Endpoints //////////////////////////////////////
 // Request to open/close a tunnel
 type TunnelRequest struct {
-	Hostname string `json:"hostname"`
-	Username string `json:"username"`
+	SSHTarget
 }
 
 // Open an SSH tunnel
-func openTunnel(ctx echo.Context) error {
+func (s *Server) openTunnel(ctx echo.Context) error {
 	var req TunnelRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
+	// Aliases from ~/.ssh/config may supply fields the request leaves out
+	resolved, err := s.tunnels.ResolveTarget(req.SSHTarget)
+	if err == nil {
+		err = resolved.Validate(s.tunnels.Identities().KeyDir())
+	}
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
 	// Open SSH tunnel
-	if err := tunnelManager.OpenConnection(req.Username, req.Hostname); err != nil {
+	if err := s.tunnels.OpenConnection(req.SSHTarget); err != nil {
 		logger.Errorf("Failed to open SSH tunnel: %v", err)
+
+		// Unknown host keys need a decision from the user before we can connect
+		var unknownKey *UnknownHostKeyError
+		if errors.As(err, &unknownKey) {
+			return ctx.JSON(http.StatusConflict, map[string]interface{}{
+				"error":   fmt.Sprintf("Failed to open SSH tunnel: %v", err),
+				"hostKey": unknownKey.HostKey,
+			})
+		}
+
+		// So do keys protected by a passphrase when no agent holds them
+		var locked *PassphraseRequiredError
+		if errors.As(err, &locked) {
+			return ctx.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"error":    fmt.Sprintf("Failed to open SSH tunnel: %v", err),
+				"identity": locked.Identity,
+			})
+		}
+
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": fmt.Sprintf("Failed to open SSH tunnel: %v", err),
 		})
 	}
 
-	return ctx.JSON(http.StatusOK, map[string]string{
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"success": "true",
+		"message": fmt.Sprintf("SSH tunnel opened for %s", req.SSHTarget),
+		// Asked for once the tunnel is up, sudo runs on the remote host
+		"sudoPasswordRequired": s.tunnels.SudoPasswordRequired(req.SSHTarget),
+	})
+}
+
+// Apply the idle timeout and keepalives of an edited environment to its open connection
+func (s *Server) updateTunnelPolicy(ctx echo.Context) error {
+	var req TunnelRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.missingFields() {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	status, open, err := s.tunnels.UpdatePolicy(req.SSHTarget)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if !open {
+		return ctx.JSON(http.StatusOK, map[string]interface{}{
+			"success": "true",
+			"message": fmt.Sprintf("No open connection for %s, the policy applies once it is opened", req.SSHTarget),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
 		"success": "true",
-		"message": fmt.Sprintf("SSH tunnel opened for %s@%s", req.Username, req.Hostname),
+		"message": fmt.Sprintf("Connection policy updated for %s", req.SSHTarget),
+		"status":  status,
 	})
 }
 
 // Close an SSH tunnel
-func closeTunnel(ctx echo.Context) error {
+func (s *Server) closeTunnel(ctx echo.Context) error {
 	var req TunnelRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
 	// Close SSH tunnel
-	if err := tunnelManager.CloseConnection(req.Username, req.Hostname); err != nil {
+	if err := s.tunnels.CloseConnection(req.SSHTarget); err != nil {
 		logger.Errorf("Failed to close SSH tunnel: %v", err)
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": fmt.Sprintf("Failed to close SSH tunnel: %v", err),
@@ -1183,148 +999,529 @@ func closeTunnel(ctx echo.Context) error {
 
 	return ctx.JSON(http.StatusOK, map[string]string{
 		"success": "true",
-		"message": fmt.Sprintf("SSH tunnel closed for %s@%s", req.Username, req.Hostname),
+		"message": fmt.Sprintf("SSH tunnel closed for %s", req.SSHTarget),
 	})
 }
 
 // Get tunnel status
-func getTunnelStatus(ctx echo.Context) error {
-	username := ctx.QueryParam("username")
-	hostname := ctx.QueryParam("hostname")
+func (s *Server) getTunnelStatus(ctx echo.Context) error {
+	var req TunnelRequest
+	if ctx.Request().Method == http.MethodGet {
+		// Plain query parameters cover targets without SSH options
+		req.Username = ctx.QueryParam("username")
+		req.Hostname = ctx.QueryParam("hostname")
+		req.IdentityFile = ctx.QueryParam("identityFile")
+		req.Port, _ = strconv.Atoi(ctx.QueryParam("port"))
+		req.ConnectTimeout, _ = strconv.Atoi(ctx.QueryParam("connectTimeout"))
+		req.Transport = TransportKind(ctx.QueryParam("transport"))
+		req.TLSCertificates = ctx.QueryParam("tlsCertificates")
+	} else if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
 
-	if username == "" || hostname == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing username or hostname"})
 	}
 
-	isActive := tunnelManager.IsConnectionActive(username, hostname)
+	response := map[string]interface{}{
+		"active":     false,
+		"connection": req.SSHTarget.String(),
+		"transport":  req.transport(),
+	}
 
-	return ctx.JSON(http.StatusOK, map[string]interface{}{
-		"active":     isActive,
-		"connection": fmt.Sprintf("%s@%s", username, hostname),
-	})
-}
+	// The supervisor keeps probing in the background, so this only reports what it saw last
+	status, exists := s.tunnels.Status(req.SSHTarget)
+	if !exists {
+		response["error"] = fmt.Sprintf("no connection for %s", req.SSHTarget)
+		return ctx.JSON(http.StatusOK, response)
+	}
 
-// List all active tunnels
-func listTunnels(ctx echo.Context) error {
-	activeConnections := tunnelManager.GetActiveConnections()
+	response["active"] = status.State.usable()
+	response["state"] = status.State
+	response["since"] = status.Since
+	if status.LastError != "" {
+		response["error"] = status.LastError
+	}
+	if status.FailedHop != nil {
+		// Point at the hop that broke when going through jump hosts
+		response["failedHop"] = status.FailedHop
+	}
+	if status.NextRetry != nil {
+		response["attempts"] = status.Attempts
+		response["nextRetry"] = status.NextRetry
+	}
+	if status.TLS != nil {
+		// Handshake, certificate expiry and ping latency of a TCP+TLS connection
+		response["tls"] = status.TLS
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// Stream tunnel events as server-sent events, starting with the current state of every tunnel
+func (s *Server) streamTunnelEvents(ctx echo.Context) error {
+	events, unsubscribe := s.tunnels.Events().Subscribe()
+	defer unsubscribe()
+
+	response := ctx.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.WriteHeader(http.StatusOK)
+
+	write := func(name string, data interface{}) error {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(response, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+			return err
+		}
+		response.Flush()
+		return nil
+	}
+
+	// Subscribed before taking the snapshot, so no transition falls in between
+	snapshot := map[string]interface{}{"type": "snapshot", "tunnels": s.tunnels.Statuses()}
+	if err := write("snapshot", snapshot); err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return nil
+		case <-s.closing:
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := write(string(event.Type), event); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(response, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		}
+	}
+}
+
+// List all active tunnels
+func (s *Server) listTunnels(ctx echo.Context) error {
+	activeConnections := s.tunnels.GetActiveConnections()
 
 	return ctx.JSON(http.StatusOK, map[string]interface{}{
 		"active_tunnels": activeConnections,
+		"tunnels":        s.tunnels.Statuses(),
+	})
+}
+
+// Request to accept or reject a host key
+type HostKeyRequest struct {
+	Address     string `json:"address"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// List host keys waiting for the user to accept or reject them
+func (s *Server) listPendingHostKeys(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"pending": s.tunnels.HostKeys().Pending(),
+	})
+}
+
+// Trust a pending host key
+func (s *Server) acceptHostKey(ctx echo.Context) error {
+	var req HostKeyRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.Address == "" || req.Fingerprint == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	if err := s.tunnels.HostKeys().Accept(req.Address, req.Fingerprint); err != nil {
+		logger.Errorf("Failed to accept host key: %v", err)
+		return ctx.JSON(http.StatusNotFound, map[string]string{
+			"error": fmt.Sprintf("Failed to accept host key: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"success": "true",
+		"message": fmt.Sprintf("Host key %s trusted for %s", req.Fingerprint, req.Address),
+	})
+}
+
+// Discard a pending host key
+func (s *Server) rejectHostKey(ctx echo.Context) error {
+	var req HostKeyRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.Address == "" || req.Fingerprint == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	if err := s.tunnels.HostKeys().Reject(req.Address, req.Fingerprint); err != nil {
+		logger.Errorf("Failed to reject host key: %v", err)
+		return ctx.JSON(http.StatusNotFound, map[string]string{
+			"error": fmt.Sprintf("Failed to reject host key: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"success": "true",
+		"message": fmt.Sprintf("Host key %s rejected for %s", req.Fingerprint, req.Address),
+	})
+}
+
+// Request to unlock a passphrase protected identity file
+type UnlockRequest struct {
+	IdentityFile string `json:"identityFile"`
+	Passphrase   string `json:"passphrase"`
+}
+
+// List identity files waiting for a passphrase, and whether an SSH agent is available
+func (s *Server) listLockedIdentities(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"locked": s.tunnels.Identities().Locked(),
+		"agent":  s.tunnels.Identities().AgentAvailable(),
+	})
+}
+
+// Decrypt an identity file for the rest of the session; the passphrase itself is not kept
+func (s *Server) unlockIdentity(ctx echo.Context) error {
+	var req UnlockRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.IdentityFile == "" || req.Passphrase == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	if err := s.tunnels.Identities().Unlock(req.IdentityFile, []byte(req.Passphrase)); err != nil {
+		logger.Errorf("Failed to unlock identity: %v", err)
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{
+			"error": fmt.Sprintf("Failed to unlock identity: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"success": "true",
+		"message": fmt.Sprintf("Identity %s unlocked for this session", req.IdentityFile),
+	})
+}
+
+// Request to give the sudo password of an environment for this session
+type SudoPasswordRequest struct {
+	SSHTarget
+	Password string `json:"password"`
+}
+
+// Check and remember the sudo password of an environment in sudo-password mode
+func (s *Server) setSudoPassword(ctx echo.Context) error {
+	var req SudoPasswordRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.missingFields() || req.Password == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "checking sudo password", commandTimeout)
+	defer cancel()
+
+	if err := s.tunnels.SetSudoPassword(reqCtx, req.SSHTarget, []byte(req.Password)); err != nil {
+		logger.Errorf("Failed to set sudo password: %v", err)
+		status := errorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusUnauthorized
+		}
+		return ctx.JSON(status, map[string]string{
+			"error": fmt.Sprintf("Failed to set sudo password: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"success": "true",
+		"message": fmt.Sprintf("sudo password stored for %s for this session", req.SSHTarget),
+	})
+}
+
+// Request to store the certificates of a TCP+TLS environment
+type TLSCertificatesRequest struct {
+	Name string `json:"name"`
+	CA   string `json:"ca"`
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// List stored TLS certificate bundles, without their keys
+func (s *Server) listTLSCertificates(ctx echo.Context) error {
+	list, err := s.tunnels.TLSCertificates().List()
+	if err != nil {
+		logger.Errorf("Failed to list TLS certificates: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": fmt.Sprintf("Failed to list TLS certificates: %v", err),
+		})
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"certificates": list})
+}
+
+// Check and store the CA, client certificate and key of a TCP+TLS environment
+func (s *Server) saveTLSCertificates(ctx echo.Context) error {
+	var req TLSCertificatesRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.Name == "" || req.CA == "" || req.Cert == "" || req.Key == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	info, err := s.tunnels.TLSCertificates().Save(req.Name, []byte(req.CA), []byte(req.Cert), []byte(req.Key))
+	if err != nil {
+		logger.Errorf("Failed to store TLS certificates: %v", err)
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": fmt.Sprintf("Failed to store TLS certificates: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"success":     "true",
+		"message":     fmt.Sprintf("TLS certificates %s stored", req.Name),
+		"certificate": info,
+	})
+}
+
+// Delete a stored TLS certificate bundle
+func (s *Server) removeTLSCertificates(ctx echo.Context) error {
+	var req TLSCertificatesRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.Name == "" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	if err := s.tunnels.TLSCertificates().Remove(req.Name); err != nil {
+		logger.Errorf("Failed to remove TLS certificates: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to remove TLS certificates: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"success": "true",
+		"message": fmt.Sprintf("TLS certificates %s removed", req.Name),
+	})
+}
+
+// Every port forward, of every connection
+func (s *Server) listForwards(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, map[string]interface{}{"forwards": s.tunnels.Forwards()})
+}
+
+// Forward a local port to a port of the remote host or of a container
+func (s *Server) openForward(ctx echo.Context) error {
+	var req ForwardRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.missingFields() || req.RemotePort == 0 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "opening port forward", dockerInspectTimeout)
+	defer cancel()
+
+	forward, err := s.tunnels.OpenForward(reqCtx, req)
+	if err != nil {
+		logger.Errorf("Failed to open port forward: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to open port forward: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"success": "true",
+		"message": fmt.Sprintf("Local port %d forwards to %s:%d", forward.LocalPort, forward.RemoteHost, forward.RemotePort),
+		"forward": forward,
+	})
+}
+
+// Forward a local port to the Docker daemon of an environment, with a docker CLI context using it
+func (s *Server) openDockerEndpoint(ctx echo.Context) error {
+	var req DockerEndpointRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.missingFields() {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	if req.ContextName == "" {
+		req.ContextName = defaultDockerContextName(req.Hostname)
+	}
+	if !dockerContextNamePattern.MatchString(req.ContextName) {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid Docker context name %q", req.ContextName)})
+	}
+
+	forward, err := s.tunnels.OpenDockerEndpoint(req)
+	var dockerContext DockerContext
+	if err == nil {
+		dockerContext, err = NewDockerContext(req.ContextName, "Docker on "+forward.Target+" through the Remote Docker extension", forward.LocalPort)
+	}
+	if err != nil {
+		logger.Errorf("Failed to open Docker endpoint: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to open Docker endpoint: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"success": "true",
+		"message": fmt.Sprintf("Docker on %s listens on %s", forward.Target, dockerContext.Host),
+		"warning": "The endpoint has no authentication: any process or user on this machine can use it while it is open, and Docker access amounts to root on the remote host",
+		"forward": forward,
+		"context": dockerContext,
+	})
+}
+
+// Local port of a forward to remove
+type CloseForwardRequest struct {
+	LocalPort int `json:"localPort"`
+}
+
+// Stop forwarding a local port
+func (s *Server) closeForward(ctx echo.Context) error {
+	var req CloseForwardRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.LocalPort == 0 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	if err := s.tunnels.CloseForward(req.LocalPort); err != nil {
+		logger.Errorf("Failed to close port forward: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to close port forward: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"success": "true",
+		"message": fmt.Sprintf("Local port %d no longer forwarded", req.LocalPort),
 	})
 }
 
+// Detect which privilege modes reach the Docker daemon of an environment
+func (s *Server) probePrivileges(ctx echo.Context) error {
+	var req DashboardRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+	}
+
+	if req.missingFields() {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+	}
+
+	probes, err := s.tunnels.ProbePrivileges(ctx.Request().Context(), req.SSHTarget)
+	if err != nil {
+		logger.Errorf("Failed to probe privilege modes: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to probe privilege modes: %v", err),
+		})
+	}
+
+	response := map[string]interface{}{"probes": probes}
+	if mode, found := recommendedPrivilege(probes); found {
+		response["recommended"] = mode
+	}
+	return ctx.JSON(http.StatusOK, response)
+}
+
 ////////////////////////////////////
 
 // Request for volume operations
 type VolumeRequest struct {
-	Hostname   string `json:"hostname"`
-	Username   string `json:"username"`
+	SSHTarget
 	VolumeName string `json:"volumeName"`
 }
 
 // Request for network operations
 type NetworkRequest struct {
-	Hostname  string `json:"hostname"`
-	Username  string `json:"username"`
+	SSHTarget
 	NetworkId string `json:"networkId"`
 }
 
 // List volumes
-func listVolumes(ctx echo.Context) error {
+func (s *Server) listVolumes(ctx echo.Context) error {
 	var req struct {
-		Hostname string `json:"hostname"`
-		Username string `json:"username"`
+		SSHTarget
 	}
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// First, get volume names and driver info
-	dockerCommand := "sudo docker volume ls --format '{{.Name}}|{{.Driver}}'"
-
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCommand)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
 	if err != nil {
-		logger.Errorf("Error listing volumes: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to list volumes: %v", err),
-			"output": string(output),
+		logger.Errorf("Error listing volumes: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to list volumes: %v", err),
 		})
 	}
 
-	// Parse the output into volume objects
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	volumes := make([]map[string]interface{}, 0, len(lines))
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "listing volumes", dockerListTimeout)
+	defer cancel()
 
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
+	list, err := engine.VolumeList(reqCtx)
+	if err != nil {
+		logger.Errorf("Error listing volumes: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to list volumes: %v", err),
+		})
+	}
 
-		parts := strings.Split(line, "|")
-		if len(parts) != 2 {
-			logger.Errorf("Invalid format for volume info: %s", line)
-			continue
+	volumes := make([]map[string]interface{}, 0, len(list))
+	for _, v := range list {
+		created := v.CreatedAt
+		if created == "" {
+			created = "N/A"
 		}
 
-		volumeName := parts[0]
-		driver := parts[1]
-
-		// Get detailed info about this volume
-		inspectCommand := fmt.Sprintf("sudo docker volume inspect %s", volumeName)
-		inspectOutput, inspectErr := tunnelManager.ExecuteCommand(req.Username, req.Hostname, inspectCommand)
-
-		mountpoint := "N/A"
-		created := "N/A"
-		labels := []string{}
-
-		// If we can get inspect data, extract more info
-		if inspectErr == nil && len(inspectOutput) > 0 {
-			// Simple parsing approach - in production you'd want to properly parse JSON
-			inspectStr := string(inspectOutput)
-
-			// Extract mountpoint
-			if mountStart := strings.Index(inspectStr, "\"Mountpoint\": \""); mountStart > 0 {
-				mountStart += 15 // Length of "Mountpoint": "
-				if mountEnd := strings.Index(inspectStr[mountStart:], "\""); mountEnd > 0 {
-					mountpoint = inspectStr[mountStart : mountStart+mountEnd]
-				}
-			}
-
-			// Extract creation time if available
-			if createdStart := strings.Index(inspectStr, "\"CreatedAt\": \""); createdStart > 0 {
-				createdStart += 14 // Length of "CreatedAt": "
-				if createdEnd := strings.Index(inspectStr[createdStart:], "\""); createdEnd > 0 {
-					created = inspectStr[createdStart : createdStart+createdEnd]
-				}
-			}
-
-			// Extract labels
-			if labelsStart := strings.Index(inspectStr, "\"Labels\": {"); labelsStart > 0 {
-				labelsStart += 11 // Length of "Labels": {
-				if labelsEnd := strings.Index(inspectStr[labelsStart:], "}"); labelsEnd > 0 {
-					labelsSection := inspectStr[labelsStart : labelsStart+labelsEnd]
-					labelPairs := strings.Split(labelsSection, ",")
-					for _, pair := range labelPairs {
-						if pair = strings.TrimSpace(pair); pair != "" {
-							labels = append(labels, pair)
-						}
-					}
-				}
-			}
+		// Only /system/df computes sizes, which is too slow to run for a listing
+		size := "N/A"
+		if v.UsageData != nil && v.UsageData.Size >= 0 {
+			size = humanSize(v.UsageData.Size)
 		}
 
 		volume := map[string]interface{}{
-			"name":       volumeName,
-			"driver":     driver,
-			"mountpoint": mountpoint,
+			"name":       v.Name,
+			"driver":     v.Driver,
+			"mountpoint": v.Mountpoint,
 			"created":    created,
-			"size":       "N/A", // Size would require more complex commands to determine
-			"labels":     labels,
+			"size":       size,
+			"labels":     labelList(v.Labels),
 		}
 		volumes = append(volumes, volume)
 	}
@@ -1333,25 +1530,31 @@ func listVolumes(ctx echo.Context) error {
 }
 
 // Remove a volume
-func removeVolume(ctx echo.Context) error {
+func (s *Server) removeVolume(ctx echo.Context) error {
 	var req VolumeRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" || req.VolumeName == "" {
+	if req.missingFields() || req.VolumeName == "" {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	dockerCommand := fmt.Sprintf("sudo docker volume rm %s", req.VolumeName)
+	if err := ValidateIdentifier(VolumeObject, req.VolumeName); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "removing volume", dockerActionTimeout)
+	defer cancel()
 
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCommand)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
+	if err == nil {
+		err = engine.VolumeRemove(reqCtx, req.VolumeName)
+	}
 	if err != nil {
-		logger.Errorf("Error removing volume: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to remove volume: %v", err),
-			"output": string(output),
+		logger.Errorf("Error removing volume: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to remove volume: %v", err),
 		})
 	}
 
@@ -1362,105 +1565,60 @@ func removeVolume(ctx echo.Context) error {
 }
 
 // List networks
-func listNetworks(ctx echo.Context) error {
+func (s *Server) listNetworks(ctx echo.Context) error {
 	var req struct {
-		Hostname string `json:"hostname"`
-		Username string `json:"username"`
+		SSHTarget
 	}
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Format: ID|Name|Driver|Scope
-	dockerCommand := "sudo docker network ls --format '{{.ID}}|{{.Name}}|{{.Driver}}|{{.Scope}}'"
-
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCommand)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
 	if err != nil {
-		logger.Errorf("Error listing networks: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to list networks: %v", err),
-			"output": string(output),
+		logger.Errorf("Error listing networks: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to list networks: %v", err),
 		})
 	}
 
-	// Parse the output into network objects
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	networks := make([]map[string]interface{}, 0, len(lines))
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "listing networks", dockerListTimeout)
+	defer cancel()
 
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
+	list, err := engine.NetworkList(reqCtx)
+	if err != nil {
+		logger.Errorf("Error listing networks: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to list networks: %v", err),
+		})
+	}
 
-		parts := strings.Split(line, "|")
-		if len(parts) != 4 {
-			logger.Errorf("Invalid format for network info: %s", line)
-			continue
+	networks := make([]map[string]interface{}, 0, len(list))
+	for _, n := range list {
+		ipamDriver := n.IPAM.Driver
+		if ipamDriver == "" {
+			ipamDriver = "default"
 		}
 
-		networkId := parts[0]
-		name := parts[1]
-		driver := parts[2]
-		scope := parts[3]
-
-		// Now get detailed info about this network
-		inspectCmd := fmt.Sprintf("sudo docker network inspect %s", networkId)
-
-		// Execute command using SSH tunnel
-		inspectOutput, inspectErr := tunnelManager.ExecuteCommand(req.Username, req.Hostname, inspectCmd)
-
 		subnet := ""
 		gateway := ""
-		ipamDriver := "default"
-		internal := false
-
-		// If we can get inspect data, extract more info
-		if inspectErr == nil && len(inspectOutput) > 0 {
-			// Simple parsing approach - in production you'd want to properly parse JSON
-			inspectStr := string(inspectOutput)
-
-			// Extract IPAM driver
-			if driverStart := strings.Index(inspectStr, "\"Driver\": \""); driverStart > 0 {
-				driverStart += 11 // Length of "Driver": "
-				if driverEnd := strings.Index(inspectStr[driverStart:], "\""); driverEnd > 0 {
-					ipamDriver = inspectStr[driverStart : driverStart+driverEnd]
-				}
-			}
-
-			// Extract subnet
-			if subnetStart := strings.Index(inspectStr, "\"Subnet\": \""); subnetStart > 0 {
-				subnetStart += 11 // Length of "Subnet": "
-				if subnetEnd := strings.Index(inspectStr[subnetStart:], "\""); subnetEnd > 0 {
-					subnet = inspectStr[subnetStart : subnetStart+subnetEnd]
-				}
-			}
-
-			// Extract gateway
-			if gatewayStart := strings.Index(inspectStr, "\"Gateway\": \""); gatewayStart > 0 {
-				gatewayStart += 12 // Length of "Gateway": "
-				if gatewayEnd := strings.Index(inspectStr[gatewayStart:], "\""); gatewayEnd > 0 {
-					gateway = inspectStr[gatewayStart : gatewayStart+gatewayEnd]
-				}
-			}
-
-			// Check if internal
-			internal = strings.Contains(inspectStr, "\"Internal\": true")
+		if len(n.IPAM.Config) > 0 {
+			subnet = n.IPAM.Config[0].Subnet
+			gateway = n.IPAM.Config[0].Gateway
 		}
 
 		network := map[string]interface{}{
-			"id":         networkId,
-			"name":       name,
-			"driver":     driver,
-			"scope":      scope,
+			"id":         shortID(n.ID),
+			"name":       n.Name,
+			"driver":     n.Driver,
+			"scope":      n.Scope,
 			"ipamDriver": ipamDriver,
 			"subnet":     subnet,
 			"gateway":    gateway,
-			"internal":   internal,
+			"internal":   n.Internal,
 		}
 		networks = append(networks, network)
 	}
@@ -1469,26 +1627,31 @@ func listNetworks(ctx echo.Context) error {
 }
 
 // Remove a network
-func removeNetwork(ctx echo.Context) error {
+func (s *Server) removeNetwork(ctx echo.Context) error {
 	var req NetworkRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" || req.NetworkId == "" {
+	if req.missingFields() || req.NetworkId == "" {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// SSH to remote host and remove network
-	dockerCommand := fmt.Sprintf("sudo docker network rm %s", req.NetworkId)
+	if err := ValidateIdentifier(NetworkObject, req.NetworkId); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "removing network", dockerActionTimeout)
+	defer cancel()
 
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCommand)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
+	if err == nil {
+		err = engine.NetworkRemove(reqCtx, req.NetworkId)
+	}
 	if err != nil {
-		logger.Errorf("Error removing network: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to remove network: %v", err),
-			"output": string(output),
+		logger.Errorf("Error removing network: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to remove network: %v", err),
 		})
 	}
 
@@ -1498,123 +1661,274 @@ func removeNetwork(ctx echo.Context) error {
 	})
 }
 
-// Request for container operations
+// Request for container operations; the options only apply to the actions that take them
 type ContainerRequest struct {
-	Hostname    string `json:"hostname"`
-	Username    string `json:"username"`
+	SSHTarget
 	ContainerId string `json:"containerId"`
+	ContainerActionOptions
 }
 
-// Start a container
-func startContainer(ctx echo.Context) error {
-	var req ContainerRequest
-	if err := ctx.Bind(&req); err != nil {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
-	}
+type ContainerActionOptions struct {
+	Signal  string `json:"signal,omitempty"`  // kill, SIGKILL when empty
+	Force   bool   `json:"force,omitempty"`   // remove, even when running
+	Volumes bool   `json:"volumes,omitempty"` // remove, with its anonymous volumes
+	Name    string `json:"name,omitempty"`    // rename, the new name
+}
 
-	if req.Hostname == "" || req.Username == "" || req.ContainerId == "" {
-		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+// Signals by name, with or without the SIG prefix, or by number
+var containerSignal = regexp.MustCompile(`^((SIG)?[A-Z][A-Z0-9+-]*|[0-9]{1,2})$`)
+
+// A lifecycle action of the /container endpoints
+type containerAction struct {
+	verb  string // As in "Failed to stop container"
+	doing string // Operation named when it times out
+	done  string // As in "Container web stopped"
+	run   func(ctx context.Context, engine Engine, id string, options ContainerActionOptions) error
+}
+
+var containerActions = map[string]containerAction{
+	"start": {"start", "starting container", "started", func(ctx context.Context, engine Engine, id string, _ ContainerActionOptions) error {
+		return engine.ContainerStart(ctx, id)
+	}},
+	"stop": {"stop", "stopping container", "stopped", func(ctx context.Context, engine Engine, id string, _ ContainerActionOptions) error {
+		return engine.ContainerStop(ctx, id)
+	}},
+	"restart": {"restart", "restarting container", "restarted", func(ctx context.Context, engine Engine, id string, _ ContainerActionOptions) error {
+		return engine.ContainerRestart(ctx, id)
+	}},
+	"pause": {"pause", "pausing container", "paused", func(ctx context.Context, engine Engine, id string, _ ContainerActionOptions) error {
+		return engine.ContainerPause(ctx, id)
+	}},
+	"unpause": {"unpause", "unpausing container", "unpaused", func(ctx context.Context, engine Engine, id string, _ ContainerActionOptions) error {
+		return engine.ContainerUnpause(ctx, id)
+	}},
+	"kill": {"kill", "killing container", "killed", func(ctx context.Context, engine Engine, id string, options ContainerActionOptions) error {
+		return engine.ContainerKill(ctx, id, options.Signal)
+	}},
+	"remove": {"remove", "removing container", "removed", func(ctx context.Context, engine Engine, id string, options ContainerActionOptions) error {
+		return engine.ContainerRemove(ctx, id, ContainerRemoveOptions{Force: options.Force, Volumes: options.Volumes})
+	}},
+	"rename": {"rename", "renaming container", "renamed", func(ctx context.Context, engine Engine, id string, options ContainerActionOptions) error {
+		return engine.ContainerRename(ctx, id, options.Name)
+	}},
+}
+
+// Check the options an action takes and fill in their defaults
+func (o *ContainerActionOptions) prepare(action string) error {
+	switch action {
+	case "kill":
+		if o.Signal == "" {
+			o.Signal = "SIGKILL"
+		}
+		if !containerSignal.MatchString(o.Signal) {
+			return fmt.Errorf("invalid signal %q", o.Signal)
+		}
+	case "rename":
+		if o.Name == "" {
+			return fmt.Errorf("a new name is required to rename a container")
+		}
+		return ValidateIdentifier(ContainerObject, o.Name)
 	}
+	return nil
+}
 
-	// Format the docker command
-	dockerCommand := fmt.Sprintf("sudo docker start %s", req.ContainerId)
+// Handler running one lifecycle action on one container
+func (s *Server) containerAction(name string) echo.HandlerFunc {
+	action := containerActions[name]
+	return func(ctx echo.Context) error {
+		var req ContainerRequest
+		if err := ctx.Bind(&req); err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
+		}
 
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCommand)
-	if err != nil {
-		logger.Errorf("Error starting container: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to start container: %v", err),
-			"output": string(output),
+		if req.missingFields() || req.ContainerId == "" {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
+		}
+
+		if err := ValidateIdentifier(ContainerObject, req.ContainerId); err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if err := req.ContainerActionOptions.prepare(name); err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), action.doing, dockerActionTimeout)
+		defer cancel()
+
+		engine, err := s.tunnels.Engine(req.SSHTarget)
+		if err == nil {
+			err = action.run(reqCtx, engine, req.ContainerId, req.ContainerActionOptions)
+		}
+		if err != nil {
+			logger.Errorf("Error %s: %v", action.doing, err)
+			return ctx.JSON(errorStatus(err), map[string]string{
+				"error": fmt.Sprintf("Failed to %s container: %v", action.verb, err),
+			})
+		}
+
+		message := fmt.Sprintf("Container %s %s", req.ContainerId, action.done)
+		if name == "rename" {
+			message += " to " + req.Name
+		}
+		return ctx.JSON(http.StatusOK, map[string]string{
+			"success": "true",
+			"message": message,
 		})
 	}
+}
 
-	return ctx.JSON(http.StatusOK, map[string]string{
-		"success": "true",
-		"message": fmt.Sprintf("Container %s started", req.ContainerId),
-	})
+// At most this many containers per bulk request, acted on this many at a time
+const (
+	maxBulkContainers  = 100
+	bulkActionParallel = 4
+)
+
+// The same lifecycle action on several containers
+type BulkContainerRequest struct {
+	SSHTarget
+	Action       string   `json:"action"`
+	ContainerIds []string `json:"containerIds"`
+	ContainerActionOptions
 }
 
-// Stop a container
-func stopContainer(ctx echo.Context) error {
-	var req ContainerRequest
+// Outcome of a bulk action for one container, with the status its single request would have had
+type BulkContainerResult struct {
+	ContainerId string `json:"containerId"`
+	Success     bool   `json:"success"`
+	Status      int    `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Run a lifecycle action on several containers, reporting each one's outcome; one failing does not stop the others
+func (s *Server) bulkContainerAction(ctx echo.Context) error {
+	var req BulkContainerRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" || req.ContainerId == "" {
+	if req.missingFields() || req.Action == "" || len(req.ContainerIds) == 0 {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Format the docker command
-	dockerCommand := fmt.Sprintf("sudo docker stop %s", req.ContainerId)
+	action, exists := containerActions[req.Action]
+	if !exists || req.Action == "rename" {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Unknown bulk action %q", req.Action)})
+	}
+	if len(req.ContainerIds) > maxBulkContainers {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("At most %d containers per request", maxBulkContainers)})
+	}
+	for _, id := range req.ContainerIds {
+		if err := ValidateIdentifier(ContainerObject, id); err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if err := req.ContainerActionOptions.prepare(req.Action); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCommand)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
 	if err != nil {
-		logger.Errorf("Error stopping container: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to stop container: %v", err),
-			"output": string(output),
+		logger.Errorf("Error %s: %v", action.doing, err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to %s containers: %v", action.verb, err),
 		})
 	}
 
-	return ctx.JSON(http.StatusOK, map[string]string{
-		"success": "true",
-		"message": fmt.Sprintf("Container %s stopped", req.ContainerId),
+	results := make([]BulkContainerResult, len(req.ContainerIds))
+	slots := make(chan struct{}, bulkActionParallel)
+	var wg sync.WaitGroup
+	for i, id := range req.ContainerIds {
+		i, id := i, id
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			// Each container gets the deadline of a single request
+			reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), action.doing, dockerActionTimeout)
+			defer cancel()
+
+			result := BulkContainerResult{ContainerId: id, Success: true, Status: http.StatusOK}
+			if err := action.run(reqCtx, engine, id, req.ContainerActionOptions); err != nil {
+				logger.Errorf("Error %s %s: %v", action.doing, id, err)
+				result = BulkContainerResult{ContainerId: id, Status: errorStatus(err), Error: err.Error()}
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"success": strconv.FormatBool(failed == 0),
+		"message": fmt.Sprintf("%d of %d containers %s", len(results)-failed, len(results), action.done),
+		"failed":  failed,
+		"results": results,
 	})
 }
 
 // List images
-func listImages(ctx echo.Context) error {
+func (s *Server) listImages(ctx echo.Context) error {
 	var req struct {
-		Hostname string `json:"hostname"`
-		Username string `json:"username"`
+		SSHTarget
 	}
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Format the docker command
-	dockerCommand := "sudo docker images --format '{{.ID}}|{{.Repository}}|{{.Tag}}|{{.CreatedSince}}|{{.Size}}'"
-
-	// Execute command using SSH tunnel
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCommand)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
 	if err != nil {
-		logger.Errorf("Error listing images: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to list images: %v", err),
-			"output": string(output),
+		logger.Errorf("Error listing images: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to list images: %v", err),
 		})
 	}
 
-	// Parse the output into image objects
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	images := make([]map[string]string, 0, len(lines))
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "listing images", dockerListTimeout)
+	defer cancel()
 
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
+	list, err := engine.ImageList(reqCtx)
+	if err != nil {
+		logger.Errorf("Error listing images: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to list images: %v", err),
+		})
+	}
 
-		parts := strings.Split(line, "|")
-		if len(parts) != 5 {
-			logger.Errorf("Invalid format for image info: %s", line)
-			continue
+	// Like docker images, an image is listed once per tag
+	images := make([]map[string]string, 0, len(list))
+	for _, img := range list {
+		tags := img.RepoTags
+		if len(tags) == 0 {
+			tags = []string{"<none>:<none>"}
 		}
 
-		image := map[string]string{
-			"id":         parts[0],
-			"repository": parts[1],
-			"tag":        parts[2],
-			"created":    parts[3],
-			"size":       parts[4],
+		for _, tag := range tags {
+			// The tag follows the last colon, registry ports come before it
+			repository, version := tag, "<none>"
+			if i := strings.LastIndex(tag, ":"); i > strings.LastIndex(tag, "/") {
+				repository, version = tag[:i], tag[i+1:]
+			}
+
+			image := map[string]string{
+				"id":         shortID(img.ID),
+				"repository": repository,
+				"tag":        version,
+				"created":    createdSince(img.Created),
+				"size":       humanSize(img.Size),
+			}
+			images = append(images, image)
 		}
-		images = append(images, image)
 	}
 
 	return ctx.JSON(http.StatusOK, images)
@@ -1685,59 +1999,78 @@ func saveSettings(ctx echo.Context) error {
 	})
 }
 
+// Propose environments from the concrete Host entries of ~/.ssh/config
+func (s *Server) importSSHConfig(ctx echo.Context) error {
+	config, err := LoadSSHConfig(s.tunnels.SSHConfigPath())
+	if err != nil {
+		logger.Errorf("Error reading SSH config: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": fmt.Sprintf("Failed to read SSH config: %v", err),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"environments": config.Environments(),
+	})
+}
+
+// Label Compose puts the project name in
+const composeProjectLabel = "com.docker.compose.project"
+
 // connectToRemoteDocker: called from the frontend to list containers
-func connectToRemoteDocker(ctx echo.Context) error {
+func (s *Server) connectToRemoteDocker(ctx echo.Context) error {
 	var req SSHConnectionRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request format"})
 	}
 
-	if req.Hostname == "" || req.Username == "" {
+	if req.missingFields() {
 		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields"})
 	}
 
-	// Include Labels in docker ps
-	dockerCommand := "sudo docker ps --format '{{.ID}}|{{.Names}}|{{.Image}}|{{.Status}}|{{.Ports}}|{{.Labels}}'"
+	if err := req.ContainerListOptions.Validate(); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
-	output, err := tunnelManager.ExecuteCommand(req.Username, req.Hostname, dockerCommand)
+	engine, err := s.tunnels.Engine(req.SSHTarget)
 	if err != nil {
-		logger.Errorf("Error executing SSH command: %v, output: %s", err, string(output))
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error":  fmt.Sprintf("Failed to connect: %v", err),
-			"output": string(output),
+		logger.Errorf("Error connecting to the container engine: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to connect: %v", err),
+		})
+	}
+
+	reqCtx, cancel := withOperationTimeout(ctx.Request().Context(), "listing containers", dockerListTimeout)
+	defer cancel()
+
+	// Stopped and crashed containers too, unless filtered out
+	list, err := engine.ContainerList(reqCtx, true, req.engineFilters())
+	if err != nil {
+		logger.Errorf("Error listing containers: %v", err)
+		return ctx.JSON(errorStatus(err), map[string]string{
+			"error": fmt.Sprintf("Failed to connect: %v", err),
 		})
 	}
+	list, total := req.apply(list)
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
 	groupsMap := make(map[string][]DockerContainer)
 	ungrouped := []DockerContainer{}
 
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "|")
-		// ID, Name, Image, Status, Ports, Labels
-		if len(parts) != 6 {
-			logger.Warnf("Invalid container info: %s", line)
-			continue
-		}
-
+	for _, c := range list {
 		container := DockerContainer{
-			ID:     parts[0],
-			Name:   parts[1],
-			Image:  parts[2],
-			Status: parts[3],
-			Ports:  parts[4],
-			Labels: parts[5],
+			ID:             shortID(c.ID),
+			Name:           c.Name(),
+			Image:          c.Image,
+			State:          c.State,
+			Status:         c.Status,
+			Created:        c.Created,
+			Ports:          formatPorts(c.Ports),
+			Labels:         formatLabels(c.Labels),
+			ComposeProject: c.Labels[composeProjectLabel],
 		}
 
-		// Check for compose project
-		projectName := parseComposeProjectLabel(container.Labels)
-		container.ComposeProject = projectName
-
-		if projectName != "" {
-			groupsMap[projectName] = append(groupsMap[projectName], container)
+		if container.ComposeProject != "" {
+			groupsMap[container.ComposeProject] = append(groupsMap[container.ComposeProject], container)
 		} else {
 			ungrouped = append(ungrouped, container)
 		}
@@ -1762,6 +2095,9 @@ func connectToRemoteDocker(ctx echo.Context) error {
 	response := DockerContainerResponse{
 		ComposeGroups: composeGroups,
 		Ungrouped:     ungrouped,
+		Total:         total,
+		Page:          req.page(),
+		PageSize:      req.PageSize,
 	}
 	return ctx.JSON(http.StatusOK, response)
 }
@@ -1792,23 +2128,6 @@ func computeGroupStatus(containers []DockerContainer) string {
 	}
 }
 
-// parseComposeProjectLabel checks if the label string contains "com.docker.compose.project=XYZ"
-// and returns the project name if found, or empty string if not found.
-func parseComposeProjectLabel(labels string) string {
-	// Example labels string might look like:
-	//   "com.docker.compose.project=helios,com.docker.compose.version=2.15.1"
-	// or it might be empty or have other labels
-	pairs := strings.Split(labels, ",")
-	for _, pair := range pairs {
-		pair = strings.TrimSpace(pair)
-		if strings.HasPrefix(pair, "com.docker.compose.project=") {
-			// Extract everything after =
-			return strings.TrimPrefix(pair, "com.docker.compose.project=")
-		}
-	}
-	return ""
-}
-
 func listen(path string) (net.Listener, error) {
 	return net.Listen("unix", path)
 }
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// nerdctl driven through its CLI. It prints Docker's table columns as JSON strings,
+// one object per line, so most values have to be parsed back.
+type nerdctlEngine struct {
+	cli engineCLI
+}
+
+// Template printing each row of a listing as JSON
+const nerdctlJSONFormat = "{{json .}}"
+
+// A container as printed by nerdctl ps
+type nerdctlContainer struct {
+	ID        string    `json:"ID"`
+	Names     string    `json:"Names"`
+	Image     string    `json:"Image"`
+	CreatedAt cliTime   `json:"CreatedAt"`
+	Status    string    `json:"Status"`
+	Ports     string    `json:"Ports"`
+	Labels    cliLabels `json:"Labels"`
+}
+
+func (e *nerdctlEngine) ContainerList(ctx context.Context, all bool, filters map[string][]string) ([]ContainerSummary, error) {
+	args := append([]string{"ps", "--format", nerdctlJSONFormat}, filterFlags(filters)...)
+	if all {
+		args = append(args, "--all")
+	}
+	output, err := e.cli.output(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeJSONList[nerdctlContainer](output)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]ContainerSummary, 0, len(listed))
+	for _, c := range listed {
+		containers = append(containers, ContainerSummary{
+			ID:      c.ID,
+			Names:   []string{c.Names},
+			Image:   c.Image,
+			Created: int64(c.CreatedAt),
+			State:   stateFromStatus(c.Status),
+			Status:  c.Status,
+			Ports:   parsePorts(c.Ports),
+			Labels:  c.Labels,
+		})
+	}
+	return containers, nil
+}
+
+func (e *nerdctlEngine) ContainerInspect(ctx context.Context, id string) (ContainerDetails, error) {
+	return e.cli.containerInspect(ctx, id)
+}
+
+func (e *nerdctlEngine) ContainerAddress(ctx context.Context, id string) (string, error) {
+	return e.cli.containerAddress(ctx, id)
+}
+
+func (e *nerdctlEngine) ContainerStart(ctx context.Context, id string) error {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return err
+	}
+	_, err := e.cli.output(ctx, "start", id)
+	return err
+}
+
+func (e *nerdctlEngine) ContainerStop(ctx context.Context, id string) error {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return err
+	}
+	_, err := e.cli.output(ctx, "stop", id)
+	return err
+}
+
+func (e *nerdctlEngine) ContainerRestart(ctx context.Context, id string) error {
+	return e.cli.containerCommand(ctx, "restart", id, nil)
+}
+
+func (e *nerdctlEngine) ContainerPause(ctx context.Context, id string) error {
+	return e.cli.containerCommand(ctx, "pause", id, nil)
+}
+
+func (e *nerdctlEngine) ContainerUnpause(ctx context.Context, id string) error {
+	return e.cli.containerCommand(ctx, "unpause", id, nil)
+}
+
+func (e *nerdctlEngine) ContainerKill(ctx context.Context, id, signal string) error {
+	return e.cli.containerCommand(ctx, "kill", id, []string{"--signal", signal})
+}
+
+func (e *nerdctlEngine) ContainerRemove(ctx context.Context, id string, options ContainerRemoveOptions) error {
+	return e.cli.containerCommand(ctx, "rm", id, removeFlags(options))
+}
+
+func (e *nerdctlEngine) ContainerRename(ctx context.Context, id, name string) error {
+	if err := ValidateIdentifier(ContainerObject, name); err != nil {
+		return err
+	}
+	return e.cli.containerCommand(ctx, "rename", id, nil, name)
+}
+
+func (e *nerdctlEngine) ContainerLogs(ctx context.Context, id string, tail int, timestamps bool) ([]string, error) {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return nil, err
+	}
+	args := append(append([]string{"logs"}, logFlags(tail, timestamps)...), id)
+	output, err := e.cli.combinedOutput(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return logLines(output), nil
+}
+
+func (e *nerdctlEngine) ContainerUsage(ctx context.Context, id string) (ContainerUsage, error) {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return ContainerUsage{}, err
+	}
+	output, err := e.cli.output(ctx, "stats", "--no-stream", "--format", nerdctlJSONFormat, id)
+	if err != nil {
+		return ContainerUsage{}, err
+	}
+	samples, err := decodeJSONList[cliStats](output)
+	if err != nil {
+		return ContainerUsage{}, err
+	}
+	if len(samples) == 0 {
+		return ContainerUsage{}, &EngineError{Engine: EngineNerdctl, Message: "no stats for container " + id}
+	}
+	return samples[0].usage(), nil
+}
+
+// An image as printed by nerdctl images, one row per repository and tag
+type nerdctlImage struct {
+	ID         string  `json:"ID"`
+	Repository string  `json:"Repository"`
+	Tag        string  `json:"Tag"`
+	CreatedAt  cliTime `json:"CreatedAt"`
+	Size       cliSize `json:"Size"`
+}
+
+func (e *nerdctlEngine) ImageList(ctx context.Context) ([]ImageSummary, error) {
+	output, err := e.cli.output(ctx, "images", "--format", nerdctlJSONFormat)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := decodeJSONList[nerdctlImage](output)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows of the same image are merged, as the Engine API lists an image once with all its tags
+	var images []ImageSummary
+	index := make(map[string]int)
+	for _, row := range rows {
+		i, seen := index[row.ID]
+		if !seen {
+			i = len(images)
+			index[row.ID] = i
+			images = append(images, ImageSummary{ID: row.ID, Created: int64(row.CreatedAt), Size: int64(row.Size)})
+		}
+		if row.Repository != "" && row.Repository != "<none>" {
+			tag := row.Tag
+			if tag == "" || tag == "<none>" {
+				tag = "latest"
+			}
+			images[i].RepoTags = append(images[i].RepoTags, row.Repository+":"+tag)
+		}
+	}
+	return images, nil
+}
+
+// A volume as printed by nerdctl volume ls
+type nerdctlVolume struct {
+	Name       string    `json:"Name"`
+	Driver     string    `json:"Driver"`
+	Mountpoint string    `json:"Mountpoint"`
+	Labels     cliLabels `json:"Labels"`
+}
+
+func (e *nerdctlEngine) VolumeList(ctx context.Context) ([]Volume, error) {
+	output, err := e.cli.output(ctx, "volume", "ls", "--format", nerdctlJSONFormat)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeJSONList[nerdctlVolume](output)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make([]Volume, 0, len(listed))
+	for _, v := range listed {
+		volumes = append(volumes, Volume{Name: v.Name, Driver: v.Driver, Mountpoint: v.Mountpoint, Labels: v.Labels})
+	}
+	return volumes, nil
+}
+
+func (e *nerdctlEngine) VolumeRemove(ctx context.Context, name string) error {
+	if err := ValidateIdentifier(VolumeObject, name); err != nil {
+		return err
+	}
+	_, err := e.cli.output(ctx, "volume", "rm", name)
+	return err
+}
+
+func (e *nerdctlEngine) NetworkList(ctx context.Context) ([]Network, error) {
+	output, err := e.cli.output(ctx, "network", "ls", "--format", nerdctlJSONFormat)
+	if err != nil {
+		return nil, err
+	}
+	// Only the ID and name are printed; CNI networks are local to the host
+	listed, err := decodeJSONList[struct {
+		ID   string `json:"ID"`
+		Name string `json:"Name"`
+	}](output)
+	if err != nil {
+		return nil, err
+	}
+
+	networks := make([]Network, 0, len(listed))
+	for _, n := range listed {
+		networks = append(networks, Network{ID: n.ID, Name: n.Name, Scope: "local"})
+	}
+	return networks, nil
+}
+
+func (e *nerdctlEngine) NetworkRemove(ctx context.Context, id string) error {
+	if err := ValidateIdentifier(NetworkObject, id); err != nil {
+		return err
+	}
+	_, err := e.cli.output(ctx, "network", "rm", id)
+	return err
+}
+
+func (e *nerdctlEngine) Info(ctx context.Context) (DockerInfo, error) {
+	output, err := e.cli.output(ctx, "info", "--format", nerdctlJSONFormat)
+	if err != nil {
+		return DockerInfo{}, err
+	}
+	// nerdctl prints info in the shape of docker info
+	var info DockerInfo
+	err = decodeJSON(output, &info)
+	return info, err
+}
+
+func (e *nerdctlEngine) Version(ctx context.Context) (DockerVersion, error) {
+	output, err := e.cli.output(ctx, "version", "--format", nerdctlJSONFormat)
+	if err != nil {
+		return DockerVersion{}, err
+	}
+	var versions struct {
+		Client struct {
+			Version string `json:"Version"`
+			Os      string `json:"Os"`
+			Arch    string `json:"Arch"`
+		} `json:"Client"`
+		Server *struct {
+			Components []struct {
+				Name    string `json:"Name"`
+				Version string `json:"Version"`
+			} `json:"Components"`
+		} `json:"Server"`
+	}
+	if err := decodeJSON(output, &versions); err != nil {
+		return DockerVersion{}, err
+	}
+
+	// There is no API of its own, the containerd version stands in for it
+	version := DockerVersion{Version: versions.Client.Version, Os: versions.Client.Os, Arch: versions.Client.Arch}
+	if versions.Server != nil {
+		for _, component := range versions.Server.Components {
+			if strings.EqualFold(component.Name, "containerd") {
+				version.APIVersion = "containerd " + component.Version
+			}
+		}
+	}
+	return version, nil
+}
+
+func (e *nerdctlEngine) SpaceUsage(ctx context.Context) (SpaceUsage, error) {
+	return SpaceUsage{}, &UnsupportedOperationError{Engine: EngineNerdctl, Operation: "disk usage"}
+}
+
+func (e *nerdctlEngine) Events(ctx context.Context, since, until time.Time, limit int) ([]EventMessage, error) {
+	// nerdctl events only follows new events, it cannot list past ones
+	return nil, &UnsupportedOperationError{Engine: EngineNerdctl, Operation: "past events"}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deadlines of remote operations; a request that outlives them is answered with 504
+const (
+	commandTimeout         = 30 * time.Second // Commands without a more specific deadline
+	hostUsageTimeout       = 15 * time.Second
+	dockerListTimeout      = 30 * time.Second
+	dockerInfoTimeout      = 15 * time.Second
+	dockerInspectTimeout   = 15 * time.Second
+	dockerStatsTimeout     = 20 * time.Second
+	dockerEventsTimeout    = 30 * time.Second
+	dockerLogsTimeout      = 60 * time.Second
+	dockerDiskUsageTimeout = 60 * time.Second
+	dockerActionTimeout    = 60 * time.Second // Stopping waits for the container's grace period
+)
+
+// Returned when a remote operation does not finish before its deadline
+type TimeoutError struct {
+	Operation string
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %v", e.Operation, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+type operationKey struct{}
+
+type operation struct {
+	name    string
+	timeout time.Duration
+}
+
+// Derive a context that ends after timeout, remembering the operation for the TimeoutError
+func withOperationTimeout(parent context.Context, name string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(parent, operationKey{}, operation{name: name, timeout: timeout})
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Turn an error caused by the context running out into a TimeoutError
+func contextError(ctx context.Context, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	op, ok := ctx.Value(operationKey{}).(operation)
+	if !ok {
+		deadline, _ := ctx.Deadline()
+		op = operation{name: "remote operation", timeout: time.Until(deadline)}
+	}
+	return &TimeoutError{Operation: op.name, Timeout: op.timeout}
+}
+
+// HTTP status to answer with for a failed remote operation
+func errorStatus(err error) int {
+	var timeout *TimeoutError
+	if errors.As(err, &timeout) {
+		return http.StatusGatewayTimeout
+	}
+
+	var sudo *SudoPasswordRequiredError
+	if errors.As(err, &sudo) {
+		return http.StatusUnauthorized
+	}
+
+	var notAsked *SudoPasswordNotAskedError
+	if errors.As(err, &notAsked) {
+		return http.StatusBadRequest
+	}
+
+	var invalid *InvalidIdentifierError
+	if errors.As(err, &invalid) {
+		return http.StatusBadRequest
+	}
+
+	var unsupported *UnsupportedOperationError
+	if errors.As(err, &unsupported) {
+		return http.StatusNotImplemented
+	}
+
+	var transport *UnsupportedTransportError
+	if errors.As(err, &transport) {
+		return http.StatusNotImplemented
+	}
+
+	var invalidForward *InvalidForwardError
+	if errors.As(err, &invalidForward) {
+		return http.StatusBadRequest
+	}
+
+	var conflict *ForwardConflictError
+	if errors.As(err, &conflict) {
+		return http.StatusConflict
+	}
+
+	var forward *ForwardNotFoundError
+	if errors.As(err, &forward) {
+		return http.StatusNotFound
+	}
+
+	var certificates *TLSCertificatesNotFoundError
+	if errors.As(err, &certificates) {
+		return http.StatusNotFound
+	}
+
+	var engineErr *EngineError
+	if errors.As(err, &engineErr) && engineErr.NotFound() {
+		return http.StatusNotFound
+	}
+	if errors.As(err, &engineErr) && engineErr.Conflict() {
+		return http.StatusConflict
+	}
+
+	// Client errors of the Docker daemon are passed on
+	var apiErr *DockerAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 {
+		return apiErr.StatusCode
+	}
+	return http.StatusInternalServerError
+}
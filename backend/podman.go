@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Podman driven through its CLI, whose JSON output differs from the Engine API in names and shapes
+type podmanEngine struct {
+	cli engineCLI
+}
+
+// A container as printed by podman ps --format json
+type podmanContainer struct {
+	ID        string            `json:"Id"`
+	Names     []string          `json:"Names"`
+	Image     string            `json:"Image"`
+	Created   cliTime           `json:"Created"`
+	State     string            `json:"State"`
+	Status    string            `json:"Status"`
+	StartedAt cliTime           `json:"StartedAt"`
+	ExitedAt  cliTime           `json:"ExitedAt"`
+	ExitCode  int               `json:"ExitCode"`
+	Labels    map[string]string `json:"Labels"`
+	Ports     []struct {
+		HostIP        string `json:"host_ip"`
+		ContainerPort int    `json:"container_port"`
+		HostPort      int    `json:"host_port"`
+		Protocol      string `json:"protocol"`
+	} `json:"Ports"`
+}
+
+// Status in the words of docker ps, which podman only prints in its table
+func (c podmanContainer) status() string {
+	if c.Status != "" {
+		return c.Status
+	}
+	switch c.State {
+	case "running":
+		return "Up " + humanDuration(time.Since(time.Unix(int64(c.StartedAt), 0)))
+	case "exited", "stopped":
+		return fmt.Sprintf("Exited (%d) %s ago", c.ExitCode, humanDuration(time.Since(time.Unix(int64(c.ExitedAt), 0))))
+	case "":
+		return "Unknown"
+	}
+	return strings.ToUpper(c.State[:1]) + c.State[1:]
+}
+
+func (e *podmanEngine) ContainerList(ctx context.Context, all bool, filters map[string][]string) ([]ContainerSummary, error) {
+	// Listed as exited below, stopped containers have to match that status as well
+	if statuses := filters["status"]; containsString(statuses, "exited") && !containsString(statuses, "stopped") {
+		filters = copyFilters(filters)
+		filters["status"] = append(filters["status"], "stopped")
+	}
+	args := append([]string{"ps", "--format", "json"}, filterFlags(filters)...)
+	if all {
+		args = append(args, "--all")
+	}
+	output, err := e.cli.output(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeJSONList[podmanContainer](output)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]ContainerSummary, 0, len(listed))
+	for _, c := range listed {
+		container := ContainerSummary{
+			ID:      c.ID,
+			Names:   c.Names,
+			Image:   c.Image,
+			Created: int64(c.Created),
+			State:   c.State,
+			Status:  c.status(),
+			Labels:  c.Labels,
+		}
+		if container.State == "stopped" {
+			container.State = "exited"
+		}
+		for _, port := range c.Ports {
+			container.Ports = append(container.Ports, ContainerPort{
+				IP:          port.HostIP,
+				PrivatePort: port.ContainerPort,
+				PublicPort:  port.HostPort,
+				Type:        port.Protocol,
+			})
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+func (e *podmanEngine) ContainerInspect(ctx context.Context, id string) (ContainerDetails, error) {
+	return e.cli.containerInspect(ctx, id)
+}
+
+func (e *podmanEngine) ContainerAddress(ctx context.Context, id string) (string, error) {
+	return e.cli.containerAddress(ctx, id)
+}
+
+func (e *podmanEngine) ContainerStart(ctx context.Context, id string) error {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return err
+	}
+	_, err := e.cli.output(ctx, "start", id)
+	return err
+}
+
+func (e *podmanEngine) ContainerStop(ctx context.Context, id string) error {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return err
+	}
+	_, err := e.cli.output(ctx, "stop", id)
+	return err
+}
+
+func (e *podmanEngine) ContainerRestart(ctx context.Context, id string) error {
+	return e.cli.containerCommand(ctx, "restart", id, nil)
+}
+
+func (e *podmanEngine) ContainerPause(ctx context.Context, id string) error {
+	return e.cli.containerCommand(ctx, "pause", id, nil)
+}
+
+func (e *podmanEngine) ContainerUnpause(ctx context.Context, id string) error {
+	return e.cli.containerCommand(ctx, "unpause", id, nil)
+}
+
+func (e *podmanEngine) ContainerKill(ctx context.Context, id, signal string) error {
+	return e.cli.containerCommand(ctx, "kill", id, []string{"--signal", signal})
+}
+
+func (e *podmanEngine) ContainerRemove(ctx context.Context, id string, options ContainerRemoveOptions) error {
+	return e.cli.containerCommand(ctx, "rm", id, removeFlags(options))
+}
+
+func (e *podmanEngine) ContainerRename(ctx context.Context, id, name string) error {
+	if err := ValidateIdentifier(ContainerObject, name); err != nil {
+		return err
+	}
+	return e.cli.containerCommand(ctx, "rename", id, nil, name)
+}
+
+func (e *podmanEngine) ContainerLogs(ctx context.Context, id string, tail int, timestamps bool) ([]string, error) {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return nil, err
+	}
+	args := append(append([]string{"logs"}, logFlags(tail, timestamps)...), id)
+	output, err := e.cli.combinedOutput(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return logLines(output), nil
+}
+
+// Usage as printed by podman stats --format json, in snake case unlike every other command
+type podmanStats struct {
+	CPUPercent string `json:"cpu_percent"`
+	MemUsage   string `json:"mem_usage"`
+	NetIO      string `json:"net_io"`
+	BlockIO    string `json:"block_io"`
+}
+
+func (e *podmanEngine) ContainerUsage(ctx context.Context, id string) (ContainerUsage, error) {
+	if err := ValidateIdentifier(ContainerObject, id); err != nil {
+		return ContainerUsage{}, err
+	}
+	output, err := e.cli.output(ctx, "stats", "--no-stream", "--format", "json", id)
+	if err != nil {
+		return ContainerUsage{}, err
+	}
+	samples, err := decodeJSONList[podmanStats](output)
+	if err != nil {
+		return ContainerUsage{}, err
+	}
+	if len(samples) == 0 {
+		return ContainerUsage{}, &EngineError{Engine: EnginePodman, Message: "no stats for container " + id}
+	}
+	stats := cliStats{CPUPerc: samples[0].CPUPercent, MemUsage: samples[0].MemUsage, NetIO: samples[0].NetIO, BlockIO: samples[0].BlockIO}
+	return stats.usage(), nil
+}
+
+// An image as printed by podman images --format json
+type podmanImage struct {
+	ID       string   `json:"Id"`
+	Names    []string `json:"Names"`
+	RepoTags []string `json:"RepoTags"`
+	Created  cliTime  `json:"Created"`
+	Size     int64    `json:"Size"`
+}
+
+func (e *podmanEngine) ImageList(ctx context.Context) ([]ImageSummary, error) {
+	output, err := e.cli.output(ctx, "images", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeJSONList[podmanImage](output)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]ImageSummary, 0, len(listed))
+	for _, image := range listed {
+		tags := image.Names
+		if len(tags) == 0 {
+			tags = image.RepoTags
+		}
+		images = append(images, ImageSummary{
+			ID:       image.ID,
+			RepoTags: tags,
+			Created:  int64(image.Created),
+			Size:     image.Size,
+		})
+	}
+	return images, nil
+}
+
+func (e *podmanEngine) VolumeList(ctx context.Context) ([]Volume, error) {
+	output, err := e.cli.output(ctx, "volume", "ls", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	// Podman prints volumes with the field names of the Engine API
+	return decodeJSONList[Volume](output)
+}
+
+func (e *podmanEngine) VolumeRemove(ctx context.Context, name string) error {
+	if err := ValidateIdentifier(VolumeObject, name); err != nil {
+		return err
+	}
+	_, err := e.cli.output(ctx, "volume", "rm", name)
+	return err
+}
+
+// A network as printed by podman network ls --format json since Podman 4
+type podmanNetwork struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Driver   string            `json:"driver"`
+	Internal bool              `json:"internal"`
+	Subnets  []IPAMConfig      `json:"subnets"`
+	IPAM     map[string]string `json:"ipam_options"`
+}
+
+func (e *podmanEngine) NetworkList(ctx context.Context) ([]Network, error) {
+	output, err := e.cli.output(ctx, "network", "ls", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeJSONList[podmanNetwork](output)
+	if err != nil {
+		return nil, err
+	}
+
+	networks := make([]Network, 0, len(listed))
+	for _, n := range listed {
+		network := Network{
+			ID:       n.ID,
+			Name:     n.Name,
+			Driver:   n.Driver,
+			Scope:    "local",
+			Internal: n.Internal,
+		}
+		network.IPAM.Driver = n.IPAM["driver"]
+		network.IPAM.Config = n.Subnets
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (e *podmanEngine) NetworkRemove(ctx context.Context, id string) error {
+	if err := ValidateIdentifier(NetworkObject, id); err != nil {
+		return err
+	}
+	_, err := e.cli.output(ctx, "network", "rm", id)
+	return err
+}
+
+// The parts of podman info --format json the dashboard shows
+type podmanInfo struct {
+	Host struct {
+		Arch         string `json:"arch"`
+		CPUs         int    `json:"cpus"`
+		MemTotal     int64  `json:"memTotal"`
+		OS           string `json:"os"`
+		Distribution struct {
+			Distribution string `json:"distribution"`
+			Version      string `json:"version"`
+		} `json:"distribution"`
+	} `json:"host"`
+	Store struct {
+		GraphRoot string `json:"graphRoot"`
+	} `json:"store"`
+	Version podmanVersion `json:"version"`
+}
+
+func (e *podmanEngine) Info(ctx context.Context) (DockerInfo, error) {
+	output, err := e.cli.output(ctx, "info", "--format", "json")
+	if err != nil {
+		return DockerInfo{}, err
+	}
+	var info podmanInfo
+	if err := decodeJSON(output, &info); err != nil {
+		return DockerInfo{}, err
+	}
+
+	return DockerInfo{
+		ServerVersion:   info.Version.Version,
+		OSType:          info.Host.OS,
+		OperatingSystem: strings.TrimSpace(info.Host.Distribution.Distribution + " " + info.Host.Distribution.Version),
+		Architecture:    info.Host.Arch,
+		NCPU:            info.Host.CPUs,
+		MemTotal:        info.Host.MemTotal,
+		DockerRootDir:   info.Store.GraphRoot,
+	}, nil
+}
+
+type podmanVersion struct {
+	Version    string `json:"Version"`
+	APIVersion string `json:"APIVersion"`
+	OsArch     string `json:"OsArch"`
+}
+
+func (e *podmanEngine) Version(ctx context.Context) (DockerVersion, error) {
+	output, err := e.cli.output(ctx, "version", "--format", "json")
+	if err != nil {
+		return DockerVersion{}, err
+	}
+	// There is only a server when podman talks to a remote service
+	var versions struct {
+		Client *podmanVersion `json:"Client"`
+		Server *podmanVersion `json:"Server"`
+	}
+	if err := decodeJSON(output, &versions); err != nil {
+		return DockerVersion{}, err
+	}
+	version := versions.Server
+	if version == nil {
+		version = versions.Client
+	}
+	if version == nil {
+		return DockerVersion{}, fmt.Errorf("podman printed no version")
+	}
+
+	os, arch, _ := strings.Cut(version.OsArch, "/")
+	return DockerVersion{Version: version.Version, APIVersion: version.APIVersion, Os: os, Arch: arch}, nil
+}
+
+func (e *podmanEngine) SpaceUsage(ctx context.Context) (SpaceUsage, error) {
+	output, err := e.cli.output(ctx, "system", "df", "--format", "json")
+	if err != nil {
+		return SpaceUsage{}, err
+	}
+	rows, err := decodeJSONList[struct {
+		Type    string  `json:"Type"`
+		RawSize int64   `json:"RawSize"`
+		Size    cliSize `json:"Size"`
+	}](output)
+	if err != nil {
+		return SpaceUsage{}, err
+	}
+
+	var usage SpaceUsage
+	for _, row := range rows {
+		size := row.RawSize
+		if size == 0 {
+			size = int64(row.Size)
+		}
+		switch row.Type {
+		case "Images":
+			usage.Images = size
+		case "Local Volumes":
+			usage.Volumes = size
+		}
+	}
+	return usage, nil
+}
+
+// An event as printed by podman events --format json
+type podmanEvent struct {
+	ID         string            `json:"ID"`
+	Image      string            `json:"Image"`
+	Name       string            `json:"Name"`
+	Status     string            `json:"Status"`
+	Time       cliTime           `json:"Time"`
+	Type       string            `json:"Type"`
+	Attributes map[string]string `json:"Attributes"`
+}
+
+// The last lines written, each one event of podman events --format json; a limit of 0 keeps them all
+type lastLines struct {
+	limit   int
+	lines   [][]byte
+	next    int // Where the oldest line is once full
+	partial []byte
+}
+
+func (l *lastLines) Write(p []byte) (int, error) {
+	data := append(l.partial, p...)
+	for {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			break
+		}
+		line := append([]byte{}, data[:end+1]...)
+		data = data[end+1:]
+		if l.limit <= 0 || len(l.lines) < l.limit {
+			l.lines = append(l.lines, line)
+		} else {
+			l.lines[l.next] = line
+			l.next = (l.next + 1) % l.limit
+		}
+	}
+	l.partial = append([]byte{}, data...)
+	return len(p), nil
+}
+
+// The lines kept, oldest first, with an unfinished last line
+func (l *lastLines) Bytes() []byte {
+	var output []byte
+	for i := range l.lines {
+		output = append(output, l.lines[(l.next+i)%len(l.lines)]...)
+	}
+	return append(output, l.partial...)
+}
+
+func (e *podmanEngine) Events(ctx context.Context, since, until time.Time, limit int) ([]EventMessage, error) {
+	// Only the last lines are kept as they arrive, rather than every event of the window
+	output := &lastLines{limit: limit}
+	err := e.cli.run(ctx, output, nil, "events", "--format", "json",
+		"--since", since.Format(time.RFC3339), "--until", until.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	listed, err := decodeJSONList[podmanEvent](output.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]EventMessage, 0, len(listed))
+	for _, event := range listed {
+		message := EventMessage{
+			Type:   event.Type,
+			Action: event.Status,
+			ID:     event.ID,
+			From:   event.Image,
+			Time:   int64(event.Time),
+		}
+		message.Actor.ID = event.ID
+		message.Actor.Attributes = map[string]string{}
+		for key, value := range event.Attributes {
+			message.Actor.Attributes[key] = value
+		}
+		if event.Name != "" {
+			message.Actor.Attributes["name"] = event.Name
+		}
+		events = append(events, message)
+	}
+	return events, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Idle timeout of an environment that keeps its connection open until it is closed
+	neverIdleTimeout = -1
+
+	defaultIdleTimeout       = 10 * time.Minute
+	maxIdleTimeout           = 7 * 24 * time.Hour
+	defaultKeepaliveInterval = 10 * time.Second
+	maxKeepaliveInterval     = 10 * time.Minute
+	defaultKeepaliveCountMax = 2
+	maxKeepaliveCountMax     = 10
+)
+
+// How long a connection may sit unused and how its health is probed, set per environment.
+// Left out fields fall back to the defaults; changing them applies to an open connection.
+type ConnectionPolicy struct {
+	IdleTimeout       int `json:"idleTimeout,omitempty"`       // Minutes, or neverIdleTimeout
+	KeepaliveInterval int `json:"keepaliveInterval,omitempty"` // Seconds
+	KeepaliveCountMax int `json:"keepaliveCountMax,omitempty"` // Missed keepalives before reconnecting
+}
+
+func (p ConnectionPolicy) Validate() error {
+	if p.IdleTimeout != neverIdleTimeout && (p.IdleTimeout < 0 || time.Duration(p.IdleTimeout)*time.Minute > maxIdleTimeout) {
+		return fmt.Errorf("idle timeout must be between 1 and %d minutes, or %d to never close the connection", int(maxIdleTimeout.Minutes()), neverIdleTimeout)
+	}
+	if p.KeepaliveInterval < 0 || p.keepaliveInterval() > maxKeepaliveInterval {
+		return fmt.Errorf("keepalive interval must be between 1 and %d seconds", int(maxKeepaliveInterval.Seconds()))
+	}
+	if p.KeepaliveCountMax < 0 || p.keepaliveCountMax() > maxKeepaliveCountMax {
+		return fmt.Errorf("keepalive count must be between 1 and %d", maxKeepaliveCountMax)
+	}
+	return nil
+}
+
+// How long the connection may stay unused, and whether it is ever closed for it
+func (p ConnectionPolicy) idleTimeout() (time.Duration, bool) {
+	switch p.IdleTimeout {
+	case neverIdleTimeout:
+		return 0, false
+	case 0:
+		return defaultIdleTimeout, true
+	}
+	return time.Duration(p.IdleTimeout) * time.Minute, true
+}
+
+func (p ConnectionPolicy) keepaliveInterval() time.Duration {
+	if p.KeepaliveInterval == 0 {
+		return defaultKeepaliveInterval
+	}
+	return time.Duration(p.KeepaliveInterval) * time.Second
+}
+
+func (p ConnectionPolicy) keepaliveCountMax() int {
+	if p.KeepaliveCountMax == 0 {
+		return defaultKeepaliveCountMax
+	}
+	return p.KeepaliveCountMax
+}
+
+// The policy with the defaults filled in, as reported in the status of a connection
+func (p ConnectionPolicy) effective() ConnectionPolicy {
+	effective := ConnectionPolicy{
+		IdleTimeout:       neverIdleTimeout,
+		KeepaliveInterval: int(p.keepaliveInterval().Seconds()),
+		KeepaliveCountMax: p.keepaliveCountMax(),
+	}
+	if timeout, expires := p.idleTimeout(); expires {
+		effective.IdleTimeout = int(timeout.Minutes())
+	}
+	return effective
+}
+
+// Switch a connection to a new policy; the caller must hold the mutex
+func (m *SSHTunnelManager) applyPolicyLocked(key string, conn *SSHConnection, policy ConnectionPolicy) {
+	if conn.policy == policy {
+		return
+	}
+	logger.Infof("Connection policy for %s is now %+v", key, policy.effective())
+	conn.policy = policy
+
+	// The supervisor waits for its next tick with the old interval otherwise
+	select {
+	case conn.policyChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Apply the policy of a target to its open connection, without reconnecting.
+// Returns false when the target has no open connection; the policy then applies once it is opened.
+func (m *SSHTunnelManager) UpdatePolicy(target SSHTarget) (ConnectionStatus, bool, error) {
+	if err := target.ConnectionPolicy.Validate(); err != nil {
+		return ConnectionStatus{}, false, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := connectionKey(target)
+	conn, exists := m.activeConnections[key]
+	if !exists || !conn.Active {
+		return ConnectionStatus{}, false, nil
+	}
+	m.applyPolicyLocked(key, conn, target.ConnectionPolicy)
+	// Restored with the same policy after a restart
+	m.openConnections.Remember(target)
+	return conn.statusLocked(key), true, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConnectionPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy ConnectionPolicy
+		valid  bool
+	}{
+		{ConnectionPolicy{}, true},
+		{ConnectionPolicy{IdleTimeout: neverIdleTimeout, KeepaliveInterval: 30, KeepaliveCountMax: 5}, true},
+		{ConnectionPolicy{IdleTimeout: -2}, false},
+		{ConnectionPolicy{IdleTimeout: 7*24*60 + 1}, false},
+		{ConnectionPolicy{KeepaliveInterval: 601}, false},
+		{ConnectionPolicy{KeepaliveCountMax: 11}, false},
+	}
+	for _, test := range tests {
+		if err := test.policy.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", test.policy, err, test.valid)
+		}
+	}
+
+	effective := ConnectionPolicy{}.effective()
+	if effective != (ConnectionPolicy{IdleTimeout: 10, KeepaliveInterval: 10, KeepaliveCountMax: 2}) {
+		t.Errorf("default policy = %+v, want 10 minutes idle and 2 keepalives every 10 seconds", effective)
+	}
+}
+
+func TestUpdatePolicyLive(t *testing.T) {
+	server := startSSHServer(t, newFakeExecutor(t, nil), fakeDockerAPI{})
+	manager := server.manager(t)
+	router := newTestRouter(manager)
+	target := server.target()
+	target.IdleTimeout = neverIdleTimeout
+
+	if code := postJSON(t, router, "/tunnel/open", target, nil); code != http.StatusOK {
+		t.Fatalf("opening the tunnel answered %d", code)
+	}
+
+	// Pinned, an unused connection stays open
+	age := func() {
+		manager.mutex.Lock()
+		defer manager.mutex.Unlock()
+		manager.activeConnections[connectionKey(target)].LastUsed = time.Now().Add(-time.Hour)
+	}
+	age()
+	manager.CleanupIdleConnections()
+	if _, exists := manager.Status(target); !exists {
+		t.Fatal("connection that never idles was closed")
+	}
+
+	// Probed every second from now on, without waiting for the default interval
+	target.KeepaliveInterval = 1
+	target.IdleTimeout = 30
+	var response struct {
+		Status ConnectionStatus `json:"status"`
+	}
+	if code := postJSON(t, router, "/tunnel/policy", target, &response); code != http.StatusOK {
+		t.Fatalf("updating the policy answered %d", code)
+	}
+	if want := (ConnectionPolicy{IdleTimeout: 30, KeepaliveInterval: 1, KeepaliveCountMax: 2}); response.Status.Policy != want {
+		t.Errorf("policy = %+v, want %+v", response.Status.Policy, want)
+	}
+	deadline := time.Now().Add(defaultKeepaliveInterval / 2)
+	for server.keepalives.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d keepalives before the default interval, want 2", server.keepalives.Load())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Restored with the new policy, and closed once idle for longer than it allows
+	if remembered := manager.openConnections.List(); len(remembered) != 1 || remembered[0].ConnectionPolicy != target.ConnectionPolicy {
+		t.Errorf("remembered = %+v, want the updated policy", remembered)
+	}
+	age()
+	manager.CleanupIdleConnections()
+	if _, exists := manager.Status(target); exists {
+		t.Error("connection idle for an hour was kept open with a 30 minute timeout")
+	}
+
+	var invalid map[string]string
+	target.KeepaliveCountMax = 100
+	if code := postJSON(t, router, "/tunnel/policy", target, &invalid); code != http.StatusBadRequest {
+		t.Errorf("invalid policy answered %d: %v", code, invalid)
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// How the SSH user gets access to the Docker daemon
+type PrivilegeMode string
+
+const (
+	PrivilegeAuto         PrivilegeMode = ""              // The Docker socket, falling back to passwordless sudo
+	PrivilegeDockerGroup  PrivilegeMode = "docker-group"  // The user may open the Docker socket
+	PrivilegeSudo         PrivilegeMode = "sudo"          // Passwordless sudo
+	PrivilegeSudoPassword PrivilegeMode = "sudo-password" // sudo with a password given for the session
+	PrivilegeRootless     PrivilegeMode = "rootless"      // A daemon run by the user, at DOCKER_HOST or in the runtime directory
+)
+
+// Modes tried by the probe, in order of preference
+var probedPrivilegeModes = []PrivilegeMode{PrivilegeDockerGroup, PrivilegeRootless, PrivilegeSudo, PrivilegeSudoPassword}
+
+// Per-environment settings for reaching the container engine
+type DockerAccess struct {
+	Engine     EngineKind    `json:"engine,omitempty"` // Docker when empty
+	Privilege  PrivilegeMode `json:"privilegeMode,omitempty"`
+	DockerHost string        `json:"dockerHost,omitempty"` // unix:// or tcp:// address of a rootless daemon
+}
+
+func (a DockerAccess) Validate() error {
+	switch a.Engine {
+	case "", EngineDocker, EnginePodman, EngineNerdctl:
+	default:
+		return fmt.Errorf("unknown container engine %q", a.Engine)
+	}
+	switch a.Privilege {
+	case PrivilegeAuto, PrivilegeDockerGroup, PrivilegeSudo, PrivilegeSudoPassword, PrivilegeRootless:
+	default:
+		return fmt.Errorf("unknown privilege mode %q", a.Privilege)
+	}
+	if a.DockerHost != "" {
+		if a.Privilege != PrivilegeRootless || a.engine() != EngineDocker {
+			return fmt.Errorf("a Docker host can only be set for rootless Docker")
+		}
+		if _, _, err := parseDockerHost(a.DockerHost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Split a DOCKER_HOST value into the network and address to forward
+func parseDockerHost(host string) (string, string, error) {
+	parsed, err := url.Parse(host)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid Docker host %q: %v", host, err)
+	}
+	switch {
+	case parsed.Scheme == "unix" && strings.HasPrefix(parsed.Path, "/"):
+		return "unix", parsed.Path, nil
+	case parsed.Scheme == "tcp" && parsed.Host != "":
+		return "tcp", parsed.Host, nil
+	}
+	return "", "", fmt.Errorf("invalid Docker host %q, expected unix:///path or tcp://host:port", host)
+}
+
+// The engine of the environment, Docker unless another one was chosen
+func (a DockerAccess) engine() EngineKind {
+	if a.Engine == "" {
+		return EngineDocker
+	}
+	return a.Engine
+}
+
+// An invocation of an engine CLI run with the privileges of the mode
+func (a DockerAccess) command(binary string, args ...string) RemoteCommand {
+	switch a.Privilege {
+	case PrivilegeDockerGroup:
+		return Command(binary, args...)
+	case PrivilegeSudo:
+		return Command("sudo", append([]string{"-n", binary}, args...)...)
+	case PrivilegeSudoPassword:
+		// The password is read from stdin, without a prompt on the output. -k makes sudo read it
+		// even with credentials still cached, or it would be passed on to the command.
+		return Command("sudo", append([]string{"-k", "-S", "-p", "", binary}, args...)...)
+	case PrivilegeRootless:
+		if a.DockerHost != "" {
+			return Command("env", append([]string{"DOCKER_HOST=" + a.DockerHost, binary}, args...)...)
+		}
+		return Command(binary, args...)
+	}
+
+	// Podman and nerdctl are usually run by the user itself, Docker falls back to sudo
+	if a.engine() != EngineDocker {
+		return Command(binary, args...)
+	}
+	return Command("sudo", append([]string{"-n", binary}, args...)...)
+}
+
+// Returned when the sudo password of a target is needed but was not given this session
+type SudoPasswordRequiredError struct {
+	Target string
+}
+
+func (e *SudoPasswordRequiredError) Error() string {
+	return fmt.Sprintf("sudo on %s needs a password; enter it to access Docker", e.Target)
+}
+
+// Returned in sudo-password mode when sudo on the target runs commands without asking,
+// as with NOPASSWD: it would not read the password, which would reach the command instead
+type SudoPasswordNotAskedError struct {
+	Target string
+}
+
+func (e *SudoPasswordNotAskedError) Error() string {
+	return fmt.Sprintf("sudo on %s does not ask for a password; use the sudo mode instead of sudo with a password", e.Target)
+}
+
+// Asks sudo to run a command without a password and without cached credentials, as the
+// commands of sudo-password mode run with -k; it only succeeds where sudo never prompts
+var sudoWithoutPasswordCommand = Command("sudo", "-k", "-n", "true")
+
+// The sudo password of a target followed by a newline, for the stdin of a command run with
+// sudo -k -S. Sudo is first checked to prompt for it at all, or the password would be passed
+// on to the command; the caller must wipe the input.
+func sudoPasswordInput(ctx context.Context, runner commandRunner, target SSHTarget) ([]byte, error) {
+	password := runner.sudoPassword(target)
+	if password == nil {
+		return nil, &SudoPasswordRequiredError{Target: target.String()}
+	}
+	defer wipeBytes(password)
+
+	if err := checkSudoAsks(ctx, runner, target); err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, password...), '\n'), nil
+}
+
+// Check that sudo on the target asks for a password before running a command
+func checkSudoAsks(ctx context.Context, runner commandRunner, target SSHTarget) error {
+	err := runner.runCommand(ctx, target, sudoWithoutPasswordCommand, nil, io.Discard, io.Discard)
+	var exitErr exitStatusError
+	switch {
+	case err == nil:
+		return &SudoPasswordNotAskedError{Target: target.String()}
+	case errors.As(err, &exitErr):
+		return nil
+	}
+	return fmt.Errorf("failed to check sudo on %s: %w", target, err)
+}
+
+// Where the Docker daemon is reached: a forwarded address, or the stdio of a docker command
+type dockerEndpoint struct {
+	network string // unix or tcp; empty for dial-stdio
+	address string
+	command RemoteCommand
+}
+
+// Opens streams to the Docker daemon of a target over its SSH connection
+type dockerDialer struct {
+	manager *SSHTunnelManager
+	target  SSHTarget
+	conn    *SSHConnection
+
+	mutex    sync.Mutex
+	endpoint *dockerEndpoint // Resolved on the first dial
+}
+
+// The endpoint to reach the daemon at, resolved once per dialer
+func (d *dockerDialer) resolve(ctx context.Context) (dockerEndpoint, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.endpoint != nil {
+		return *d.endpoint, nil
+	}
+
+	access := d.target.DockerAccess
+	endpoint := dockerEndpoint{command: access.command("docker", "system", "dial-stdio")}
+	switch access.Privilege {
+	case PrivilegeAuto, PrivilegeDockerGroup:
+		endpoint.network, endpoint.address = "unix", remoteDockerSocket
+
+	case PrivilegeRootless:
+		if access.DockerHost != "" {
+			endpoint.network, endpoint.address, _ = parseDockerHost(access.DockerHost)
+			break
+		}
+
+		// Rootless Docker listens in the user's runtime directory by default
+		output, err := d.manager.ExecuteCommand(ctx, d.target, Command("id", "-u"))
+		if err != nil {
+			return endpoint, fmt.Errorf("failed to look up the user ID for rootless Docker: %w", err)
+		}
+		endpoint.network = "unix"
+		endpoint.address = fmt.Sprintf("/run/user/%s/docker.sock", strings.TrimSpace(string(output)))
+	}
+
+	d.endpoint = &endpoint
+	return endpoint, nil
+}
+
+// Switch to dial-stdio after the socket turned out to be out of reach
+func (d *dockerDialer) fallBackToStdio() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.endpoint != nil {
+		d.endpoint.network = ""
+		d.endpoint.address = ""
+	}
+}
+
+func (d *dockerDialer) open(ctx context.Context) (net.Conn, error) {
+	m := d.manager
+	m.mutex.Lock()
+	client := d.conn.Client
+	state := d.conn.State
+	m.mutex.Unlock()
+
+	if client == nil || !state.usable() {
+		return nil, &ConnectionNotReadyError{Target: d.target.String(), State: state}
+	}
+
+	endpoint, err := d.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.network != "" {
+		stream, err := client.Dial(endpoint.network, endpoint.address)
+		if err == nil {
+			return stream, nil
+		}
+		if d.target.Privilege != PrivilegeAuto {
+			return nil, fmt.Errorf("failed to forward Docker at %s: %w", endpoint.address, err)
+		}
+
+		// Usually a socket only root and the docker group may open
+		logger.Warnf("Forwarding %s for %s failed, falling back to %q: %v", endpoint.address, d.target, endpoint.command, err)
+		d.fallBackToStdio()
+	}
+
+	var input []byte
+	if d.target.Privilege == PrivilegeSudoPassword {
+		input, err = sudoPasswordInput(ctx, m, d.target)
+		if err != nil {
+			return nil, err
+		}
+		defer wipeBytes(input)
+	}
+	return dialStdio(client, endpoint.command, input)
+}
+
+// Copy of the sudo password given for a target this session, nil if there is none
+func (m *SSHTunnelManager) sudoPassword(target SSHTarget) []byte {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	password, exists := m.sudoPasswords[connectionKey(target)]
+	if !exists {
+		return nil
+	}
+	return append([]byte{}, password...)
+}
+
+// Whether a sudo password is needed for the target and none was given yet
+func (m *SSHTunnelManager) SudoPasswordRequired(target SSHTarget) bool {
+	if target.Privilege != PrivilegeSudoPassword {
+		return false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, exists := m.sudoPasswords[connectionKey(target)]
+	return !exists
+}
+
+// Check a sudo password on the target and keep it in memory until the connection is closed
+func (m *SSHTunnelManager) SetSudoPassword(ctx context.Context, target SSHTarget, password []byte) error {
+	defer wipeBytes(password)
+
+	// Where sudo does not ask, any password would pass the check below and then reach the commands
+	if err := checkSudoAsks(ctx, m, target); err != nil {
+		return err
+	}
+
+	// -k makes sudo ask even if it still has the user's credentials cached
+	input := append(append([]byte{}, password...), '\n')
+	defer wipeBytes(input)
+	_, err := m.executeCommand(ctx, target, Command("sudo", "-k", "-S", "-p", "", "true"), input)
+	if err != nil {
+		var exitErr exitStatusError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("sudo rejected the password for %s", target)
+		}
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := connectionKey(target)
+	m.forgetSudoPasswordLocked(key)
+	m.sudoPasswords[key] = append([]byte{}, password...)
+	logger.Infof("Stored sudo password for %s for this session", key)
+	return nil
+}
+
+// Wipe the sudo password of a connection; the caller must hold the mutex
+func (m *SSHTunnelManager) forgetSudoPasswordLocked(key string) {
+	if password, exists := m.sudoPasswords[key]; exists {
+		wipeBytes(password)
+		delete(m.sudoPasswords, key)
+	}
+}
+
+// Outcome of trying one privilege mode on a host
+type PrivilegeProbe struct {
+	Mode          PrivilegeMode `json:"mode"`
+	Available     bool          `json:"available"`
+	NeedsPassword bool          `json:"needsPassword,omitempty"`
+	APIVersion    string        `json:"apiVersion,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// Try every privilege mode against the container engine of a target
+func (m *SSHTunnelManager) ProbePrivileges(ctx context.Context, target SSHTarget) ([]PrivilegeProbe, error) {
+	if target.transport() != TransportSSH {
+		return nil, &UnsupportedTransportError{Transport: target.transport(), Operation: "probing privilege modes"}
+	}
+
+	conn, _, err := m.usableConnection(target)
+	if err != nil {
+		return nil, err
+	}
+
+	probes := make([]PrivilegeProbe, 0, len(probedPrivilegeModes))
+	for _, mode := range probedPrivilegeModes {
+		probe := PrivilegeProbe{Mode: mode}
+
+		candidate := target
+		candidate.Privilege = mode
+		if mode != PrivilegeRootless {
+			candidate.DockerHost = ""
+		}
+
+		if mode == PrivilegeSudoPassword && m.SudoPasswordRequired(candidate) {
+			// Without a password all that can be told is whether sudo asks for one
+			probeCtx, cancel := withOperationTimeout(ctx, "probing sudo", dockerInfoTimeout)
+			output, err := m.ExecuteCommand(probeCtx, candidate, sudoWithoutPasswordCommand)
+			cancel()
+			if err == nil {
+				probe.Error = "sudo does not ask for a password, use sudo instead"
+			} else if strings.Contains(string(output), "password") {
+				probe.NeedsPassword = true
+				probe.Error = "sudo asks for a password"
+			} else {
+				probe.Error = strings.TrimSpace(string(output))
+				if probe.Error == "" {
+					probe.Error = err.Error()
+				}
+			}
+			probes = append(probes, probe)
+			continue
+		}
+
+		probeCtx, cancel := withOperationTimeout(ctx, "probing "+string(mode), dockerInfoTimeout)
+		var version DockerVersion
+		if candidate.engine() == EngineDocker {
+			dialer := &dockerDialer{manager: m, target: candidate, conn: conn}
+			docker := newDockerClient(dialer.dial)
+			version, err = docker.Version(probeCtx)
+			docker.closeIdle()
+		} else {
+			version, err = newCLIEngine(m, candidate).Version(probeCtx)
+		}
+		cancel()
+
+		if err != nil {
+			probe.Error = err.Error()
+		} else {
+			probe.Available = true
+			probe.APIVersion = version.APIVersion
+		}
+		probes = append(probes, probe)
+	}
+	return probes, nil
+}
+
+// The first mode that works, or one that only lacks a password
+func recommendedPrivilege(probes []PrivilegeProbe) (PrivilegeMode, bool) {
+	for _, probe := range probes {
+		if probe.Available {
+			return probe.Mode, true
+		}
+	}
+	for _, probe := range probes {
+		if probe.NeedsPassword {
+			return probe.Mode, true
+		}
+	}
+	return PrivilegeAuto, false
+}
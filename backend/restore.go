@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Connections open when the backend stopped, so a restart of the extension brings them back
+const openConnectionsFilePath = "/root/docker-extension/connections.json"
+
+// Remembers the targets of the open connections by connection key. Only targets are kept;
+// passphrases and sudo passwords are asked for again after a restart.
+type OpenConnectionStore struct {
+	mutex   sync.Mutex
+	path    string
+	targets map[string]SSHTarget
+}
+
+// Load the connections remembered at the path; a missing or unreadable file remembers none
+func NewOpenConnectionStore(path string) *OpenConnectionStore {
+	s := &OpenConnectionStore{path: path, targets: make(map[string]SSHTarget)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("Failed to read open connections: %v", err)
+		}
+		return s
+	}
+	var targets []SSHTarget
+	if err := json.Unmarshal(data, &targets); err != nil {
+		logger.Warnf("Ignoring open connections in %s: %v", path, err)
+		return s
+	}
+	for _, target := range targets {
+		s.targets[connectionKey(target)] = target
+	}
+	return s
+}
+
+// Remember an opened connection, or the latest settings of one that already is
+func (s *OpenConnectionStore) Remember(target SSHTarget) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := connectionKey(target)
+	if remembered, exists := s.targets[key]; exists && reflect.DeepEqual(remembered, target) {
+		return
+	}
+	s.targets[key] = target
+	s.saveLocked()
+}
+
+// Forget a connection that was closed on purpose
+func (s *OpenConnectionStore) Forget(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.targets[key]; !exists {
+		return
+	}
+	delete(s.targets, key)
+	s.saveLocked()
+}
+
+// Forget every connection
+func (s *OpenConnectionStore) ForgetAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.targets = make(map[string]SSHTarget)
+	s.saveLocked()
+}
+
+// Remembered targets, by connection key
+func (s *OpenConnectionStore) List() []SSHTarget {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := make([]string, 0, len(s.targets))
+	for key := range s.targets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	targets := make([]SSHTarget, 0, len(keys))
+	for _, key := range keys {
+		targets = append(targets, s.targets[key])
+	}
+	return targets
+}
+
+// Write the file aside and rename it, so a crash never leaves half a list
+func (s *OpenConnectionStore) saveLocked() {
+	targets := make([]SSHTarget, 0, len(s.targets))
+	for _, target := range s.targets {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return connectionKey(targets[i]) < connectionKey(targets[j])
+	})
+
+	data, err := json.MarshalIndent(targets, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	}
+	if err == nil {
+		temp := s.path + ".tmp"
+		if err = os.WriteFile(temp, data, 0600); err == nil {
+			err = os.Rename(temp, s.path)
+		}
+	}
+	if err != nil {
+		logger.Warnf("Failed to save open connections: %v", err)
+	}
+}
+
+// Reopen the connections that were open when the backend last stopped, in the background.
+// SSH sessions end with the process, so each one is dialed again; one that fails stays
+// remembered and is tried again on the next start, until it is closed from the UI.
+func (m *SSHTunnelManager) RestoreConnections() {
+	for _, target := range m.openConnections.List() {
+		target := target
+		m.background(func() {
+			logger.Infof("Restoring connection to %s", target)
+			if err := m.OpenConnection(target); err != nil {
+				logger.Warnf("Failed to restore connection to %s: %v", target, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRestoreConnections(t *testing.T) {
+	server := startSSHServer(t, newFakeExecutor(t, nil), fakeDockerAPI{})
+	paths := server.managerPaths(t)
+	target := server.target()
+
+	// A manager that opened a connection and then stopped with the backend
+	previous, err := newSSHTunnelManager(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := previous.OpenConnection(target); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := previous.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := newSSHTunnelManager(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(manager.CloseAllConnections)
+	events, unsubscribe := manager.Events().Subscribe()
+	defer unsubscribe()
+
+	manager.RestoreConnections()
+	select {
+	case event := <-events:
+		if event.Type != EventOpened || event.Connection != connectionKey(target) {
+			t.Fatalf("event = %+v, want %s opened", event, connectionKey(target))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not restored")
+	}
+
+	// Closed from the UI, it stays closed after the next restart
+	if err := manager.CloseConnection(target); err != nil {
+		t.Fatal(err)
+	}
+	if remembered := NewOpenConnectionStore(paths.openConnections).List(); len(remembered) != 0 {
+		t.Errorf("remembered after closing = %+v, want none", remembered)
+	}
+}
+
+func TestCloseConnectionThatFailedToRestore(t *testing.T) {
+	server := startSSHServer(t, newFakeExecutor(t, nil), fakeDockerAPI{})
+	paths := server.managerPaths(t)
+
+	// Remembered for a host that no longer listens
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := server.target()
+	target.Port = listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	NewOpenConnectionStore(paths.openConnections).Remember(target)
+
+	manager, err := newSSHTunnelManager(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.RestoreConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := manager.Status(target); exists {
+		t.Fatal("connection to a closed port was restored")
+	}
+
+	if err := manager.CloseConnection(target); err != nil {
+		t.Fatal(err)
+	}
+	if remembered := NewOpenConnectionStore(paths.openConnections).List(); len(remembered) != 0 {
+		t.Errorf("remembered after closing = %+v, want none", remembered)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// What the handlers need from the tunnel manager; tests hand them a fake instead of SSH
+type TunnelManager interface {
+	ResolveTarget(target SSHTarget) (SSHTarget, error)
+	OpenConnection(target SSHTarget) error
+	CloseConnection(target SSHTarget) error
+	Status(target SSHTarget) (ConnectionStatus, bool)
+	UpdatePolicy(target SSHTarget) (ConnectionStatus, bool, error)
+	Statuses() []ConnectionStatus
+	GetActiveConnections() []string
+	Events() *EventBroker
+
+	HostKeys() *HostKeyStore
+	Identities() *IdentityStore
+	TLSCertificates() *TLSCertificateStore
+	SSHConfigPath() string
+
+	SudoPasswordRequired(target SSHTarget) bool
+	SetSudoPassword(ctx context.Context, target SSHTarget, password []byte) error
+	ProbePrivileges(ctx context.Context, target SSHTarget) ([]PrivilegeProbe, error)
+
+	Engine(target SSHTarget) (Engine, error)
+	HostUsage(ctx context.Context, target SSHTarget) (HostUsage, error)
+
+	OpenForward(ctx context.Context, req ForwardRequest) (PortForward, error)
+	OpenDockerEndpoint(req DockerEndpointRequest) (PortForward, error)
+	Forwards() []PortForward
+	CloseForward(localPort int) error
+
+	ExecContainer(req ContainerExecRequest) (*Terminal, error)
+	OpenHostTerminal(req HostTerminalRequest) (*Terminal, error)
+}
+
+// The HTTP handlers, with the tunnel manager they reach environments through
+type Server struct {
+	tunnels TunnelManager
+
+	// Terminals handed out over the socket and not yet connected to, and where host terminals are recorded
+	terminals      *terminalTokens
+	transcriptsDir string
+
+	// Closed once the HTTP server shuts down, so streaming handlers return and let it drain
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewServer(tunnels TunnelManager) *Server {
+	return &Server{tunnels: tunnels, terminals: newTerminalTokens(), transcriptsDir: transcriptsDir, closing: make(chan struct{})}
+}
+
+// End every stream in flight
+func (s *Server) closeStreams() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
+
+// Register only the terminal WebSockets, for the port the UI opens them on
+func (s *Server) RegisterTerminals(router *echo.Echo) {
+	router.Server.RegisterOnShutdown(s.closeStreams)
+
+	router.GET("/container/exec", s.serveTerminal)
+	router.GET("/host/terminal", s.serveTerminal)
+}
+
+// Register every endpoint of the backend on a router
+func (s *Server) Register(router *echo.Echo) {
+	router.Server.RegisterOnShutdown(s.closeStreams)
+
+	router.GET("/hello", hello)
+	router.POST("/connect", s.connectToRemoteDocker)
+	// Get settings
+	router.GET("/settings", getSettings)
+	// Save settings
+	router.POST("/settings", saveSettings)
+	// Propose environments from ~/.ssh/config
+	router.GET("/settings/import/ssh-config", s.importSSHConfig)
+
+	router.POST("/tunnel/open", s.openTunnel)
+	router.POST("/tunnel/close", s.closeTunnel)
+	router.POST("/tunnel/policy", s.updateTunnelPolicy)
+	router.GET("/tunnel/status", s.getTunnelStatus)
+	router.POST("/tunnel/status", s.getTunnelStatus)
+	router.GET("/tunnel/list", s.listTunnels)
+	router.GET("/tunnel/events", s.streamTunnelEvents)
+	router.GET("/tunnel/hostkey", s.listPendingHostKeys)
+	router.POST("/tunnel/hostkey/accept", s.acceptHostKey)
+	router.POST("/tunnel/hostkey/reject", s.rejectHostKey)
+	router.GET("/tunnel/unlock", s.listLockedIdentities)
+	router.POST("/tunnel/unlock", s.unlockIdentity)
+	router.POST("/tunnel/sudo", s.setSudoPassword)
+
+	// Certificates of TCP+TLS environments
+	router.GET("/tls/certificates", s.listTLSCertificates)
+	router.POST("/tls/certificates", s.saveTLSCertificates)
+	router.POST("/tls/certificates/remove", s.removeTLSCertificates)
+
+	// Local ports forwarded to remote host ports and containers
+	router.GET("/forwards", s.listForwards)
+	router.POST("/forwards", s.openForward)
+	router.POST("/forwards/remove", s.closeForward)
+	router.POST("/forwards/docker", s.openDockerEndpoint)
+
+	// Detect how Docker can be reached on a host
+	router.POST("/docker/probe", s.probePrivileges)
+
+	// Container management endpoints
+	router.POST("/container/start", s.containerAction("start"))
+	router.POST("/container/stop", s.containerAction("stop"))
+	router.POST("/container/restart", s.containerAction("restart"))
+	router.POST("/container/pause", s.containerAction("pause"))
+	router.POST("/container/unpause", s.containerAction("unpause"))
+	router.POST("/container/kill", s.containerAction("kill"))
+	router.POST("/container/remove", s.containerAction("remove"))
+	router.POST("/container/rename", s.containerAction("rename"))
+	router.POST("/containers/bulk", s.bulkContainerAction)
+
+	// Image management endpoints
+	router.POST("/images/list", s.listImages)
+
+	// Volume management endpoints
+	router.POST("/volumes/list", s.listVolumes)
+	router.POST("/volumes/remove", s.removeVolume)
+
+	// Network management endpoints
+	router.POST("/networks/list", s.listNetworks)
+	router.POST("/networks/remove", s.removeNetwork)
+
+	router.POST("/container/logs", s.getContainerLogs)
+	router.POST("/container/inspect", s.inspectContainer)
+	router.POST("/container/exec", s.createContainerExec)
+	router.GET("/container/exec", s.serveTerminal)
+
+	// Host terminal endpoints
+	router.POST("/host/terminal", s.createHostTerminal)
+	router.GET("/host/terminal", s.serveTerminal)
+	router.POST("/compose/logs", s.getComposeLogs)
+
+	router.POST("/dashboard/overview", s.getDashboardOverview)
+	router.POST("/dashboard/resources", s.getDashboardResources)
+	router.POST("/dashboard/systeminfo", s.getDashboardSystemInfo)
+	router.POST("/dashboard/events", s.getDashboardEvents)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownEndsEventStreams(t *testing.T) {
+	router := newTestRouter(newFakeTunnels(t, newFakeExecutor(t, nil), fakeDockerAPI{}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.Listener = listener
+	go router.Start("")
+
+	response, err := http.Get("http://" + listener.Addr().String() + "/tunnel/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	stream := bufio.NewReader(response.Body)
+	if line, err := stream.ReadString('\n'); err != nil || !strings.HasPrefix(line, "event: snapshot") {
+		t.Fatalf("first line = %q (%v), want the snapshot", line, err)
+	}
+
+	// Without ending the stream, shutdown would wait for the full timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	started := time.Now()
+	if err := router.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown did not drain: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("shutdown took %v", elapsed)
+	}
+}
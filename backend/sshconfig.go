@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// OpenSSH client configuration of the user, mounted read-only with ~/.ssh
+	sshConfigFilePath = sshDir + "/config"
+
+	// Same nesting limit OpenSSH applies to Include
+	maxSSHConfigIncludeDepth = 16
+)
+
+// A parsed ~/.ssh/config, reduced to the blocks and keywords the backend understands
+type SSHConfig struct {
+	blocks []sshConfigBlock
+}
+
+// Directives that apply to hosts matching the patterns of a Host line
+type sshConfigBlock struct {
+	patterns []string
+	match    bool // Match blocks are kept so their directives never leak into a Host block
+	options  []sshConfigOption
+}
+
+type sshConfigOption struct {
+	keyword string // Lower case
+	args    []string
+}
+
+// Settings ~/.ssh/config gives for a host
+type SSHHostConfig struct {
+	HostName      string
+	User          string
+	Port          int
+	IdentityFiles []string
+	ProxyJump     string
+}
+
+// Load an SSH config file, following Include directives; a missing file is an empty config
+func LoadSSHConfig(path string) (*SSHConfig, error) {
+	config := &SSHConfig{
+		// Directives before the first Host line apply to every host
+		blocks: []sshConfigBlock{{patterns: []string{"*"}}},
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return config, nil
+	}
+
+	if err := config.parseFile(path, 0); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *SSHConfig) parseFile(path string, depth int) error {
+	if depth > maxSSHConfigIncludeDepth {
+		return fmt.Errorf("%s: Include nested too deeply", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		keyword, args, err := splitSSHConfigLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			c.blocks = append(c.blocks, sshConfigBlock{patterns: args})
+		case "match":
+			c.blocks = append(c.blocks, sshConfigBlock{match: true})
+		case "include":
+			// Included files are read in place, like OpenSSH does
+			for _, pattern := range args {
+				matches, err := filepath.Glob(expandSSHConfigPath(pattern))
+				if err != nil {
+					return fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+				}
+				sort.Strings(matches)
+				for _, included := range matches {
+					if err := c.parseFile(included, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			if len(args) == 0 {
+				return fmt.Errorf("%s:%d: missing argument for %s", path, lineNumber, keyword)
+			}
+			block := &c.blocks[len(c.blocks)-1]
+			block.options = append(block.options, sshConfigOption{keyword: keyword, args: args})
+		}
+	}
+	return scanner.Err()
+}
+
+// Split a config line into its lower case keyword and arguments, honoring quotes and "Keyword=value"
+func splitSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	keyword := strings.ToLower(line[:end])
+	rest := strings.TrimLeft(line[end:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+
+	var args []string
+	var current strings.Builder
+	inQuotes, hasArg := false, false
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasArg = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
+			}
+		case r == '#' && !inQuotes && !hasArg:
+			// Trailing comment
+			return keyword, args, nil
+		default:
+			current.WriteRune(r)
+			hasArg = true
+		}
+	}
+	if inQuotes {
+		return "", nil, fmt.Errorf("unterminated quote")
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
+	return keyword, args, nil
+}
+
+// Resolve ~ and relative paths the way OpenSSH does for files named in ~/.ssh/config
+func expandSSHConfigPath(path string) string {
+	home := filepath.Dir(sshDir)
+	switch {
+	case path == "~":
+		return home
+	case strings.HasPrefix(path, "~/"):
+		return filepath.Join(home, path[2:])
+	case strings.HasPrefix(path, "%d/"):
+		return filepath.Join(home, path[3:])
+	case !filepath.IsAbs(path):
+		return filepath.Join(sshDir, path)
+	}
+	return path
+}
+
+// Match a host against an OpenSSH pattern list; any negated match rules the block out
+func matchSSHHostPatterns(patterns []string, host string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if wildcardMatch(strings.TrimPrefix(pattern, "!"), host) {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// Case-insensitive glob with * and ?, the only wildcards ssh_config knows
+func wildcardMatch(pattern, value string) bool {
+	pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(value); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if value == "" {
+				return false
+			}
+		default:
+			if value == "" || pattern[0] != value[0] {
+				return false
+			}
+		}
+		pattern, value = pattern[1:], value[1:]
+	}
+	return value == ""
+}
+
+// Collect the settings for a host; the first value obtained for a keyword wins
+func (c *SSHConfig) Lookup(host string) SSHHostConfig {
+	var result SSHHostConfig
+	seen := map[string]bool{}
+
+	for _, block := range c.blocks {
+		if block.match || !matchSSHHostPatterns(block.patterns, host) {
+			continue
+		}
+		for _, option := range block.options {
+			// IdentityFile accumulates, everything else keeps its first value
+			if option.keyword == "identityfile" {
+				result.IdentityFiles = append(result.IdentityFiles, option.args[0])
+				continue
+			}
+			if seen[option.keyword] {
+				continue
+			}
+			seen[option.keyword] = true
+
+			switch option.keyword {
+			case "hostname":
+				result.HostName = strings.ReplaceAll(option.args[0], "%h", host)
+			case "user":
+				result.User = option.args[0]
+			case "port":
+				result.Port, _ = strconv.Atoi(option.args[0])
+			case "proxyjump":
+				result.ProxyJump = option.args[0]
+			}
+		}
+	}
+	return result
+}
+
+// Host aliases that name a single concrete host, in file order
+func (c *SSHConfig) Hosts() []string {
+	var hosts []string
+	seen := map[string]bool{}
+	for _, block := range c.blocks[1:] {
+		for _, pattern := range block.patterns {
+			if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+				continue
+			}
+			seen[pattern] = true
+			hosts = append(hosts, pattern)
+		}
+	}
+	return hosts
+}
+
+// Parse a ProxyJump value, "[user@]host[:port]" hops separated by commas
+func parseProxyJump(value string) ([]JumpHost, error) {
+	if strings.EqualFold(value, "none") {
+		return nil, nil
+	}
+
+	var jumps []JumpHost
+	for _, hop := range strings.Split(value, ",") {
+		hop = strings.TrimPrefix(strings.TrimSpace(hop), "ssh://")
+		if hop == "" {
+			continue
+		}
+
+		var jump JumpHost
+		if at := strings.LastIndex(hop, "@"); at >= 0 {
+			jump.Username, hop = hop[:at], hop[at+1:]
+		}
+		jump.Hostname = hop
+		if colon := strings.LastIndex(hop, ":"); colon >= 0 && !strings.HasSuffix(hop, "]") {
+			port, err := strconv.Atoi(hop[colon+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid port in ProxyJump hop %q", hop)
+			}
+			jump.Hostname, jump.Port = hop[:colon], port
+		}
+		jump.Hostname = strings.Trim(jump.Hostname, "[]")
+		jumps = append(jumps, jump)
+	}
+	return jumps, nil
+}
+
+// Fill in what ~/.ssh/config says about a hop; explicit fields always win
+func (c *SSHConfig) applyToHop(hostname, username string, port int, identityFile string) (string, string, int, string) {
+	host := c.Lookup(hostname)
+	if host.HostName != "" {
+		hostname = host.HostName
+	}
+	if username == "" {
+		username = host.User
+	}
+	if port == 0 {
+		port = host.Port
+	}
+	if identityFile == "" && len(host.IdentityFiles) > 0 {
+		identityFile = environmentIdentityFile(host.IdentityFiles[0])
+	}
+	return hostname, username, port, identityFile
+}
+
+// Resolve host aliases of a target and its jump hosts against ~/.ssh/config
+func (c *SSHConfig) Resolve(target SSHTarget) (SSHTarget, error) {
+	resolved := target
+	alias := target.Hostname
+	resolved.Hostname, resolved.Username, resolved.Port, resolved.IdentityFile =
+		c.applyToHop(target.Hostname, target.Username, target.Port, target.IdentityFile)
+
+	// ProxyJump only applies when the environment has no jump hosts of its own
+	jumps := target.JumpHosts
+	if len(jumps) == 0 {
+		if proxyJump := c.Lookup(alias).ProxyJump; proxyJump != "" {
+			parsed, err := parseProxyJump(proxyJump)
+			if err != nil {
+				return target, err
+			}
+			jumps = parsed
+		}
+	}
+
+	resolved.JumpHosts = make([]JumpHost, 0, len(jumps))
+	for _, jump := range jumps {
+		jump.Hostname, jump.Username, jump.Port, jump.IdentityFile =
+			c.applyToHop(jump.Hostname, jump.Username, jump.Port, jump.IdentityFile)
+		if jump.Username == "" {
+			// Like OpenSSH, a hop without a user logs in as the same user as the target
+			jump.Username = resolved.Username
+		}
+		resolved.JumpHosts = append(resolved.JumpHosts, jump)
+	}
+	if len(resolved.JumpHosts) == 0 {
+		resolved.JumpHosts = nil
+	}
+
+	return resolved, nil
+}
+
+// Identity file as stored on an environment: relative to ~/.ssh when it lives there
+func environmentIdentityFile(identityFile string) string {
+	if identityFile == "" {
+		return ""
+	}
+	path := expandSSHConfigPath(identityFile)
+	if rel, err := filepath.Rel(sshDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// An environment proposed from a Host entry of ~/.ssh/config
+type ImportedEnvironment struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias"`
+	SSHTarget
+}
+
+// Propose one environment per concrete Host entry, with every field resolved
+func (c *SSHConfig) Environments() []ImportedEnvironment {
+	environments := []ImportedEnvironment{}
+	for _, alias := range c.Hosts() {
+		target, err := c.Resolve(SSHTarget{Hostname: alias})
+		if err != nil {
+			logger.Warnf("Skipping SSH config host %s: %v", alias, err)
+			continue
+		}
+		environments = append(environments, ImportedEnvironment{
+			Name:      alias,
+			Alias:     alias,
+			SSHTarget: target,
+		})
+	}
+	return environments
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Health of a supervised SSH connection
+type ConnectionState string
+
+const (
+	StateConnecting   ConnectionState = "connecting"   // First dial in progress
+	StateReady        ConnectionState = "ready"        // Keepalives are answered
+	StateDegraded     ConnectionState = "degraded"     // Keepalives are being missed
+	StateReconnecting ConnectionState = "reconnecting" // Dropped, waiting for the next attempt
+	StateFailed       ConnectionState = "failed"       // Given up until the tunnel is opened again
+)
+
+const (
+	reconnectInitialBackoff = 1 * time.Second
+	reconnectMaxBackoff     = 1 * time.Minute
+	reconnectMaxAttempts    = 10
+)
+
+// Snapshot of a connection as reported by /tunnel/status and /tunnel/list
+type ConnectionStatus struct {
+	Connection string           `json:"connection"`
+	Target     string           `json:"target"`
+	State      ConnectionState  `json:"state"`
+	Since      time.Time        `json:"since"`
+	LastUsed   time.Time        `json:"lastUsed"`
+	LastError  string           `json:"lastError,omitempty"`
+	FailedHop  *HopError        `json:"failedHop,omitempty"`
+	Policy     ConnectionPolicy `json:"policy"` // With the defaults filled in
+	Transport  TransportKind    `json:"transport"`
+	TLS        *TLSStatus       `json:"tls,omitempty"` // Only for TCP+TLS connections
+	Attempts   int              `json:"attempts,omitempty"`
+	NextRetry  *time.Time       `json:"nextRetry,omitempty"`
+}
+
+// Whether commands can run on a connection in this state
+func (s ConnectionState) usable() bool {
+	return s == StateReady || s == StateDegraded
+}
+
+// Returned instead of running a command while the connection is not usable
+type ConnectionNotReadyError struct {
+	Target    string
+	State     ConnectionState
+	LastError error
+	NextRetry time.Time
+}
+
+func (e *ConnectionNotReadyError) Error() string {
+	msg := fmt.Sprintf("SSH connection to %s is %s", e.Target, e.State)
+	if !e.NextRetry.IsZero() {
+		msg += fmt.Sprintf(", next attempt in %v", time.Until(e.NextRetry).Round(time.Second))
+	}
+	if e.LastError != nil {
+		msg += fmt.Sprintf(": %v", e.LastError)
+	}
+	return msg
+}
+
+func (e *ConnectionNotReadyError) Unwrap() error {
+	return e.LastError
+}
+
+// Errors retrying cannot fix without the user stepping in
+func permanentError(err error) bool {
+	var unknownKey *UnknownHostKeyError
+	var changedKey *HostKeyChangedError
+	var locked *PassphraseRequiredError
+	return errors.As(err, &unknownKey) ||
+		errors.As(err, &changedKey) ||
+		errors.As(err, &locked) ||
+		strings.Contains(err.Error(), "unable to authenticate")
+}
+
+// Move a connection to a new state; the caller must hold the mutex
+func (c *SSHConnection) setStateLocked(state ConnectionState, err error) {
+	if c.State != state {
+		c.State = state
+		c.since = time.Now()
+	}
+	c.lastErr = err
+	if state != StateReconnecting {
+		c.attempts = 0
+		c.nextRetry = time.Time{}
+	}
+}
+
+// Snapshot of the connection; the caller must hold the mutex
+func (c *SSHConnection) statusLocked(key string) ConnectionStatus {
+	status := ConnectionStatus{
+		Connection: key,
+		Target:     c.Target.String(),
+		State:      c.State,
+		Since:      c.since,
+		LastUsed:   c.LastUsed,
+		Attempts:   c.attempts,
+		Policy:     c.policy.effective(),
+		Transport:  c.Target.transport(),
+	}
+	if c.tls != nil {
+		health := *c.tls
+		status.TLS = &health
+	}
+	if c.lastErr != nil {
+		status.LastError = c.lastErr.Error()
+		errors.As(c.lastErr, &status.FailedHop)
+	}
+	if !c.nextRetry.IsZero() {
+		nextRetry := c.nextRetry
+		status.NextRetry = &nextRetry
+	}
+	return status
+}
+
+// The policy a connection is supervised with, which may change while it is open
+func (m *SSHTunnelManager) policy(conn *SSHConnection) ConnectionPolicy {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return conn.policy
+}
+
+// Probe the connection on every keepalive tick and reconnect once it stops answering
+func (m *SSHTunnelManager) supervise(key string, conn *SSHConnection) {
+	policy := m.policy(conn)
+	ticker := time.NewTicker(policy.keepaliveInterval())
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-conn.policyChanged:
+			// Probes already missed count against the new maximum
+			policy = m.policy(conn)
+			ticker.Reset(policy.keepaliveInterval())
+			continue
+		case err := <-conn.dropped:
+			// No need to wait for keepalives to go unanswered
+			logger.Warnf("SSH connection for %s ended: %v", key, err)
+			if !m.reconnect(key, conn, err) {
+				return
+			}
+			missed = 0
+			continue
+		case <-ticker.C:
+		}
+
+		m.mutex.Lock()
+		clients := conn.clients()
+		m.mutex.Unlock()
+
+		err := probeChain(conn.Target, clients, policy.keepaliveInterval(), conn.done)
+		select {
+		case <-conn.done:
+			return
+		default:
+		}
+		if err == nil {
+			if missed > 0 {
+				logger.Infof("SSH connection for %s answers keepalives again", key)
+				m.mutex.Lock()
+				conn.setStateLocked(StateReady, nil)
+				m.publishLocked(EventRecovered, key, conn)
+				m.mutex.Unlock()
+			}
+			missed = 0
+			continue
+		}
+
+		missed++
+		logger.Warnf("SSH keepalive for %s failed (%d/%d): %v", key, missed, policy.keepaliveCountMax(), err)
+		if missed < policy.keepaliveCountMax() {
+			m.mutex.Lock()
+			conn.setStateLocked(StateDegraded, err)
+			m.publishLocked(EventDegraded, key, conn)
+			m.mutex.Unlock()
+			continue
+		}
+
+		// Closing the clients also ends a probe still waiting for its reply
+		if !m.reconnect(key, conn, err) {
+			return
+		}
+		missed = 0
+	}
+}
+
+// Wait on every client of the chain, so one that ends is noticed at once instead of on the
+// next missed keepalive. Closing or replacing the clients on purpose is not reported.
+func (m *SSHTunnelManager) watchClients(conn *SSHConnection, clients []*ssh.Client) {
+	hops := conn.Target.hops()
+	for i, client := range clients {
+		i, client := i, client
+		m.background(func() {
+			err := client.Wait()
+			if err == nil {
+				err = io.EOF
+			}
+
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			if !conn.Active || conn.Client != clients[len(clients)-1] {
+				return
+			}
+			select {
+			case conn.dropped <- hopError(hops, i, fmt.Errorf("connection closed: %w", err)):
+			default:
+			}
+		})
+	}
+}
+
+// Redial a dropped connection with exponential backoff.
+// Returns false once the connection is closed or has failed for good.
+func (m *SSHTunnelManager) reconnect(key string, conn *SSHConnection, cause error) bool {
+	m.mutex.Lock()
+	if !conn.Active {
+		m.mutex.Unlock()
+		return false
+	}
+	closeClients(conn.clients())
+	if conn.docker != nil {
+		// Pooled API connections were forwarded over the dropped client
+		conn.docker.closeIdle()
+	}
+	conn.Client = nil
+	conn.jumpClients = nil
+	select {
+	case <-conn.dropped:
+		// The end of the clients just closed, already being handled
+	default:
+	}
+	conn.setStateLocked(StateReconnecting, cause)
+	m.publishLocked(EventBroken, key, conn)
+	m.mutex.Unlock()
+
+	backoff := reconnectInitialBackoff
+	for attempt := 1; ; attempt++ {
+		m.mutex.Lock()
+		if !conn.Active {
+			m.mutex.Unlock()
+			return false
+		}
+		conn.setStateLocked(StateReconnecting, cause)
+		conn.attempts = attempt
+		conn.nextRetry = time.Now().Add(backoff)
+		m.mutex.Unlock()
+
+		logger.Infof("Reconnecting SSH connection for %s in %v (attempt %d/%d)", key, backoff, attempt, reconnectMaxAttempts)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-conn.done:
+			timer.Stop()
+			return false
+		case <-conn.retry:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		clients, err := m.dialChain(conn.Target)
+		if err == nil {
+			m.mutex.Lock()
+			if !conn.Active {
+				m.mutex.Unlock()
+				closeClients(clients)
+				return false
+			}
+			conn.Client = clients[len(clients)-1]
+			conn.jumpClients = clients[:len(clients)-1]
+			conn.setStateLocked(StateReady, nil)
+			m.publishLocked(EventReconnected, key, conn)
+			m.watchClients(conn, clients)
+			m.mutex.Unlock()
+
+			logger.Infof("Reconnected SSH connection for %s after %d attempt(s)", key, attempt)
+			return true
+		}
+
+		cause = err
+		logger.Warnf("Reconnecting SSH connection for %s failed: %v", key, err)
+		if permanentError(err) || attempt >= reconnectMaxAttempts {
+			m.mutex.Lock()
+			conn.setStateLocked(StateFailed, err)
+			m.publishLocked(EventFailed, key, conn)
+			m.mutex.Unlock()
+			logger.Errorf("Giving up on SSH connection for %s: %v", key, err)
+			return false
+		}
+
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+// Status of the connection for a target, if there is one
+func (m *SSHTunnelManager) Status(target SSHTarget) (ConnectionStatus, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := connectionKey(target)
+	conn, exists := m.activeConnections[key]
+	if !exists || !conn.Active {
+		return ConnectionStatus{}, false
+	}
+	return conn.statusLocked(key), true
+}
+
+// Status of every connection, sorted by key
+func (m *SSHTunnelManager) Statuses() []ConnectionStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	statuses := make([]ConnectionStatus, 0, len(m.activeConnections))
+	for key, conn := range m.activeConnections {
+		if conn.Active {
+			statuses = append(statuses, conn.statusLocked(key))
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Connection < statuses[j].Connection
+	})
+	return statuses
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// Port the terminal WebSockets are served on besides the socket, which the UI cannot open
+	// a WebSocket on; published on localhost next to the forward range
+	terminalPort = 41020
+
+	// How long a terminal token waits for its WebSocket
+	terminalTokenLifetime = 30 * time.Second
+
+	// Subprotocol of the terminal WebSockets. The token is offered as another subprotocol,
+	// token.<token>, rather than in the URL, which the request log would record.
+	terminalSubprotocol = "remote-docker.terminal"
+	terminalTokenPrefix = "token."
+
+	defaultTerminalCols = 80
+	defaultTerminalRows = 24
+	maxTerminalSize     = 1000
+
+	defaultHostTerminalIdleTimeout = 30 * time.Minute
+	maxHostTerminalIdleTimeout     = 24 * time.Hour
+)
+
+var (
+	// Shells by name or path, and users as user, uid, user:group or uid:gid
+	shellPattern = regexp.MustCompile(`^[a-zA-Z0-9_./][a-zA-Z0-9_./-]*$`)
+	userPattern  = regexp.MustCompile(`^[a-zA-Z0-9_.][a-zA-Z0-9_.-]*(:[a-zA-Z0-9_.][a-zA-Z0-9_.-]*)?$`)
+)
+
+// Size of a terminal in characters
+type TerminalSize struct {
+	Cols int `json:"cols,omitempty"`
+	Rows int `json:"rows,omitempty"`
+}
+
+func (s TerminalSize) Validate() error {
+	if s.Cols < 0 || s.Rows < 0 || s.Cols > maxTerminalSize || s.Rows > maxTerminalSize {
+		return fmt.Errorf("terminal size must be between 1 and %d", maxTerminalSize)
+	}
+	return nil
+}
+
+// The size with the default filled in for what was left out
+func (s TerminalSize) effective() TerminalSize {
+	if s.Cols == 0 {
+		s.Cols = defaultTerminalCols
+	}
+	if s.Rows == 0 {
+		s.Rows = defaultTerminalRows
+	}
+	return s
+}
+
+// A shell in a container, as docker exec -it starts it
+type ContainerExecRequest struct {
+	SSHTarget
+	ContainerId string `json:"containerId"`
+	Shell       string `json:"shell,omitempty"` // bash when the container has it, else sh, when left out
+	User        string `json:"user,omitempty"`  // The user of the container when left out
+	TerminalSize
+}
+
+func (r ContainerExecRequest) Validate() error {
+	if err := ValidateIdentifier(ContainerObject, r.ContainerId); err != nil {
+		return err
+	}
+	if r.Shell != "" && !shellPattern.MatchString(r.Shell) {
+		return fmt.Errorf("invalid shell %q", r.Shell)
+	}
+	if r.User != "" && !userPattern.MatchString(r.User) {
+		return fmt.Errorf("invalid user %q", r.User)
+	}
+	return r.TerminalSize.Validate()
+}
+
+// Arguments of the engine CLI running the shell
+func (r ContainerExecRequest) args() []string {
+	args := []string{"exec", "-it"}
+	if r.User != "" {
+		args = append(args, "--user", r.User)
+	}
+	args = append(args, r.ContainerId)
+	if r.Shell != "" {
+		return append(args, r.Shell)
+	}
+	return append(args, "sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi")
+}
+
+// A login shell on the host of an SSH environment
+type HostTerminalRequest struct {
+	SSHTarget
+	IdleTimeout int  `json:"idleTimeout,omitempty"` // Minutes without input or output before hanging up, or neverIdleTimeout
+	Transcript  bool `json:"transcript,omitempty"`  // Record the output in the data volume
+	TerminalSize
+}
+
+func (r HostTerminalRequest) Validate() error {
+	if r.IdleTimeout != neverIdleTimeout && (r.IdleTimeout < 0 || time.Duration(r.IdleTimeout)*time.Minute > maxHostTerminalIdleTimeout) {
+		return fmt.Errorf("idle timeout must be between 1 and %d minutes, or %d to keep the terminal open", int(maxHostTerminalIdleTimeout.Minutes()), neverIdleTimeout)
+	}
+	return r.TerminalSize.Validate()
+}
+
+// How long the terminal may sit without input or output, zero for as long as it likes
+func (r HostTerminalRequest) idleTimeout() time.Duration {
+	switch r.IdleTimeout {
+	case neverIdleTimeout:
+		return 0
+	case 0:
+		return defaultHostTerminalIdleTimeout
+	}
+	return time.Duration(r.IdleTimeout) * time.Minute
+}
+
+// An interactive command on a PTY of an SSH connection. Reads return what the command
+// writes to the terminal, writes are typed into it.
+type Terminal struct {
+	session *ssh.Session
+	stdin   io.WriteCloser
+	output  *io.PipeReader
+
+	// Closed once the command exited, with what ended it
+	exited  chan struct{}
+	waitErr error
+
+	// Released once, which lets the connection be closed as idle again
+	release sync.Once
+	m       *SSHTunnelManager
+	conn    *SSHConnection
+}
+
+// Open a shell in a container on a PTY of the connection of its target
+func (m *SSHTunnelManager) ExecContainer(req ContainerExecRequest) (*Terminal, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Typed into the PTY for sudo, only once sudo is known to ask for it; otherwise the shell
+	// in the container would read it as its first command line
+	var input []byte
+	if req.Privilege == PrivilegeSudoPassword {
+		ctx, cancel := withOperationTimeout(context.Background(), "checking sudo", commandTimeout)
+		defer cancel()
+		var err error
+		input, err = sudoPasswordInput(ctx, m, req.SSHTarget)
+		if err != nil {
+			return nil, err
+		}
+		defer wipeBytes(input)
+	}
+
+	command := req.DockerAccess.command(string(req.engine()), req.args()...)
+	return m.openTerminal(req.SSHTarget, command, input, req.TerminalSize.effective())
+}
+
+// Open a login shell on the host of the target, on a PTY of its connection
+func (m *SSHTunnelManager) OpenHostTerminal(req HostTerminalRequest) (*Terminal, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	return m.openTerminal(req.SSHTarget, RemoteCommand{}, nil, req.TerminalSize.effective())
+}
+
+// Start a command on a new PTY, or the login shell without one, and type the input into it before anything else
+func (m *SSHTunnelManager) openTerminal(target SSHTarget, command RemoteCommand, input []byte, size TerminalSize) (*Terminal, error) {
+	if target.transport() != TransportSSH {
+		return nil, &UnsupportedTransportError{Transport: target.transport(), Operation: "terminals"}
+	}
+
+	conn, client, err := m.usableConnection(target)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSH session: %w", err)
+	}
+
+	// The PTY would echo input typed ahead, such as a sudo password, before anything reads it.
+	// docker exec -it switches it to raw mode anyway, and the shell in the container echoes.
+	modes := ssh.TerminalModes{}
+	if input != nil {
+		modes[ssh.ECHO] = 0
+	}
+	if err := session.RequestPty("xterm-256color", size.Rows, size.Cols, modes); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to allocate a terminal: %w", err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	// A PTY merges stderr into its output already, servers without one still send it apart
+	output, writer := io.Pipe()
+	session.Stdout = writer
+	session.Stderr = writer
+
+	if command.String() == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command.String())
+	}
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+	if input != nil {
+		if _, err := stdin.Write(input); err != nil {
+			session.Close()
+			return nil, fmt.Errorf("failed to write to terminal: %w", err)
+		}
+	}
+
+	m.mutex.Lock()
+	conn.terminals++
+	m.mutex.Unlock()
+
+	terminal := &Terminal{session: session, stdin: stdin, output: output, exited: make(chan struct{}), m: m, conn: conn}
+	go func() {
+		// Wait returns once all output was copied, so readers get everything before EOF
+		terminal.waitErr = session.Wait()
+		writer.Close()
+		close(terminal.exited)
+	}()
+	return terminal, nil
+}
+
+func (t *Terminal) Read(p []byte) (int, error) {
+	return t.output.Read(p)
+}
+
+func (t *Terminal) Write(p []byte) (int, error) {
+	return t.stdin.Write(p)
+}
+
+func (t *Terminal) Resize(size TerminalSize) error {
+	if err := size.Validate(); err != nil {
+		return err
+	}
+	size = size.effective()
+	return t.session.WindowChange(size.Rows, size.Cols)
+}
+
+// Wait for the command to exit and return its exit status; -1 when the server gave none
+func (t *Terminal) Wait() (int, error) {
+	<-t.exited
+	err := t.waitErr
+	var exitErr *ssh.ExitError
+	var missing *ssh.ExitMissingError
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus(), nil
+	case errors.As(err, &missing):
+		return -1, nil
+	}
+	return -1, err
+}
+
+// Hang the command up. Closing the session closes the PTY, which sends it SIGHUP.
+func (t *Terminal) Close() error {
+	t.release.Do(func() {
+		t.m.mutex.Lock()
+		t.conn.terminals--
+		t.m.mutex.Unlock()
+	})
+	return t.session.Close()
+}
+
+// Terminals waiting for their WebSocket, by token. A token is handed out over the socket,
+// which only the extension reaches, and is what lets a WebSocket in on the published port.
+type terminalTokens struct {
+	mutex   sync.Mutex
+	pending map[string]pendingTerminal
+}
+
+type pendingTerminal struct {
+	path        string // Endpoint the token is for
+	open        func() (*Terminal, error)
+	idleTimeout time.Duration // Zero to never hang up for it
+	transcript  string        // File to record the output in, if any
+	expires     time.Time
+}
+
+func newTerminalTokens() *terminalTokens {
+	return &terminalTokens{pending: make(map[string]pendingTerminal)}
+}
+
+// Hand out a token that opens a terminal once, at its path
+func (t *terminalTokens) add(pending pendingTerminal) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	for key, expired := range t.pending {
+		if now.After(expired.expires) {
+			delete(t.pending, key)
+		}
+	}
+	pending.expires = now.Add(terminalTokenLifetime)
+	t.pending[token] = pending
+	return token, nil
+}
+
+// Take the terminal of a token, which is then spent
+func (t *terminalTokens) take(path, token string) (pendingTerminal, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	pending, exists := t.pending[token]
+	if !exists || pending.path != path || time.Now().After(pending.expires) {
+		return pendingTerminal{}, false
+	}
+	delete(t.pending, token)
+	return pending, true
+}
+
+// Control messages, sent as text frames; terminal data goes both ways as binary frames
+type terminalMessage struct {
+	Type     string `json:"type"` // resize from the UI; exit, idle or error from the backend
+	Cols     int    `json:"cols,omitempty"`
+	Rows     int    `json:"rows,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Pages allowed to open terminals: the UI as Docker Desktop loads it, and the dev server
+// of make run-client. Clients without an Origin are not browsers and need the token all the same.
+var terminalOrigins = map[string]bool{
+	"":                      true,
+	"file://":               true,
+	"http://localhost:3000": true,
+	"http://127.0.0.1:3000": true,
+}
+
+var terminalUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	Subprotocols:    []string{terminalSubprotocol},
+	CheckOrigin: func(r *http.Request) bool {
+		return terminalOrigins[r.Header.Get("Origin")]
+	},
+}
+
+// The token a WebSocket request offers as a subprotocol
+func terminalToken(r *http.Request) string {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, terminalTokenPrefix) {
+			return strings.TrimPrefix(protocol, terminalTokenPrefix)
+		}
+	}
+	return ""
+}
+
+// Connect a WebSocket to the terminal its token opens, until either side ends
+func (s *Server) serveTerminal(ctx echo.Context) error {
+	path := ctx.Path()
+	if !terminalUpgrader.CheckOrigin(ctx.Request()) {
+		return ctx.JSON(http.StatusForbidden, map[string]string{"error": "Terminals cannot be opened from this page"})
+	}
+	pending, found := s.terminals.take(path, terminalToken(ctx.Request()))
+	if !found {
+		return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "Unknown or expired terminal token"})
+	}
+
+	socket, err := terminalUpgrader.Upgrade(ctx.Response(), ctx.Request(), nil)
+	if err != nil {
+		// The upgrader answered the request already
+		logger.Warnf("Failed to open terminal WebSocket: %v", err)
+		return nil
+	}
+	defer socket.Close()
+
+	terminal, err := pending.open()
+	if err != nil {
+		logger.Errorf("Error opening terminal: %v", err)
+		writeTerminalMessage(socket, terminalMessage{Type: "error", Message: fmt.Sprintf("Failed to open terminal: %v", err)})
+		return nil
+	}
+	defer terminal.Close()
+
+	// What the terminal shows is recorded as it is sent; typed passwords are not echoed, so not recorded
+	output := io.Writer(io.Discard)
+	if pending.transcript != "" {
+		transcript, err := createTranscript(pending.transcript)
+		if err != nil {
+			logger.Errorf("Error recording terminal: %v", err)
+			writeTerminalMessage(socket, terminalMessage{Type: "error", Message: fmt.Sprintf("Failed to record transcript: %v", err)})
+		} else {
+			defer transcript.Close()
+			output = transcript
+		}
+	}
+
+	// Input or output, whichever came last
+	var lastActivity atomic.Int64
+	lastActivity.Store(time.Now().UnixNano())
+
+	// Input and resizes until the socket closes, which hangs the terminal up
+	go func() {
+		defer terminal.Close()
+		for {
+			kind, data, err := socket.ReadMessage()
+			if err != nil {
+				return
+			}
+			if kind == websocket.BinaryMessage {
+				lastActivity.Store(time.Now().UnixNano())
+				if _, err := terminal.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+			var message terminalMessage
+			if err := json.Unmarshal(data, &message); err != nil || message.Type != "resize" {
+				continue
+			}
+			if err := terminal.Resize(TerminalSize{Cols: message.Cols, Rows: message.Rows}); err != nil {
+				logger.Warnf("Failed to resize terminal: %v", err)
+			}
+		}
+	}()
+
+	// A shutdown hangs terminals up rather than waiting for them, and so does the idle timeout
+	var idle <-chan time.Time
+	if pending.idleTimeout > 0 {
+		ticker := time.NewTicker(idleCheckInterval(pending.idleTimeout))
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+	var idled atomic.Bool
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		for {
+			select {
+			case <-s.closing:
+				terminal.Close()
+				return
+			case <-idle:
+				if time.Since(time.Unix(0, lastActivity.Load())) >= pending.idleTimeout {
+					idled.Store(true)
+					terminal.Close()
+					return
+				}
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := terminal.Read(buffer)
+		if n > 0 {
+			lastActivity.Store(time.Now().UnixNano())
+			output.Write(buffer[:n])
+			if err := socket.WriteMessage(websocket.BinaryMessage, buffer[:n]); err != nil {
+				return nil
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if idled.Load() {
+		writeTerminalMessage(socket, terminalMessage{Type: "idle", Message: fmt.Sprintf("Closed after %v without input or output", pending.idleTimeout)})
+		socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		return nil
+	}
+	exitCode, err := terminal.Wait()
+	if err != nil {
+		writeTerminalMessage(socket, terminalMessage{Type: "error", Message: fmt.Sprintf("Terminal ended: %v", err)})
+		return nil
+	}
+	writeTerminalMessage(socket, terminalMessage{Type: "exit", ExitCode: &exitCode})
+	socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return nil
+}
+
+// Often enough to hang up within a few percent of the timeout
+func idleCheckInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 20
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+func writeTerminalMessage(socket *websocket.Conn, message terminalMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	socket.WriteMessage(websocket.TextMessage, data)
+}
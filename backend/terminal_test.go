@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+func TestContainerExecRequest(t *testing.T) {
+	target := engineTarget(EnginePodman)
+	tests := []struct {
+		req     ContainerExecRequest
+		command RemoteCommand
+		invalid bool
+	}{
+		{
+			req:     ContainerExecRequest{SSHTarget: target, ContainerId: "web"},
+			command: Command("podman", "exec", "-it", "web", "sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"),
+		},
+		{
+			req:     ContainerExecRequest{SSHTarget: target, ContainerId: "web", Shell: "/bin/ash", User: "1000:1000"},
+			command: Command("podman", "exec", "-it", "--user", "1000:1000", "web", "/bin/ash"),
+		},
+		{
+			req:     ContainerExecRequest{SSHTarget: SSHTarget{DockerAccess: DockerAccess{Engine: EnginePodman, Privilege: PrivilegeSudoPassword}}, ContainerId: "web", Shell: "bash"},
+			command: Command("sudo", "-k", "-S", "-p", "", "podman", "exec", "-it", "web", "bash"),
+		},
+		{req: ContainerExecRequest{SSHTarget: target, ContainerId: "web", Shell: "--privileged"}, invalid: true},
+		{req: ContainerExecRequest{SSHTarget: target, ContainerId: "web", Shell: "sh; reboot"}, invalid: true},
+		{req: ContainerExecRequest{SSHTarget: target, ContainerId: "web", User: "root:"}, invalid: true},
+		{req: ContainerExecRequest{SSHTarget: target, ContainerId: "web", TerminalSize: TerminalSize{Cols: 5000}}, invalid: true},
+	}
+	for _, test := range tests {
+		err := test.req.Validate()
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%+v passed validation", test.req)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", test.req, err)
+			continue
+		}
+		if command := test.req.DockerAccess.command("podman", test.req.args()...); command != test.command {
+			t.Errorf("command = %s, want %s", command, test.command)
+		}
+	}
+}
+
+// Open the WebSocket of a terminal handed out by POST /container/exec
+func dialContainerExec(t *testing.T, router *echo.Echo, req ContainerExecRequest) *websocket.Conn {
+	t.Helper()
+	var created TerminalResponse
+	if status := postJSON(t, router, "/container/exec", req, &created); status != http.StatusOK {
+		t.Fatalf("creating the exec answered %d", status)
+	}
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	socket, err := dialTerminal(server, created.Path, created.Token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spent once connected
+	if _, err := dialTerminal(server, created.Path, created.Token, nil); !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Errorf("reusing the token gave %v, want a refused handshake", err)
+	}
+	return socket
+}
+
+// Open the WebSocket of a terminal, offering its token as a subprotocol like the UI does
+func dialTerminal(server *httptest.Server, path, token string, header http.Header) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{Subprotocols: []string{terminalSubprotocol, terminalTokenPrefix + token}}
+	socket, response, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+	if err != nil {
+		if response != nil {
+			err = fmt.Errorf("%w: %s", err, response.Status)
+		}
+		return nil, err
+	}
+	if socket.Subprotocol() != terminalSubprotocol {
+		socket.Close()
+		return nil, fmt.Errorf("subprotocol %q, want %q", socket.Subprotocol(), terminalSubprotocol)
+	}
+	return socket, nil
+}
+
+// Read binary frames until the output holds want
+func readTerminal(t *testing.T, socket *websocket.Conn, want string) {
+	t.Helper()
+	socket.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var output strings.Builder
+	for !strings.Contains(output.String(), want) {
+		kind, data, err := socket.ReadMessage()
+		if err != nil {
+			t.Fatalf("terminal output %q, want %q: %v", output.String(), want, err)
+		}
+		if kind == websocket.BinaryMessage {
+			output.Write(data)
+		}
+	}
+}
+
+func TestContainerExecTerminal(t *testing.T) {
+	api := fakeDockerAPI{
+		"GET /containers/web/json":     {body: `{"Id":"0123456789abcdef","Name":"/web","State":{"Status":"running","Running":true}}`},
+		"GET /containers/stopped/json": {body: `{"Id":"fedcba9876543210","Name":"/stopped","State":{"Status":"exited"}}`},
+	}
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		Command("sudo", "-n", "docker", "exec", "-it", "--user", "app", "web", "bash").String(): {stdout: "app@web:/$ ", echo: true},
+	})
+	server := startSSHServer(t, executor, api)
+	manager := server.manager(t)
+	router := newTestRouter(manager)
+
+	req := ContainerExecRequest{SSHTarget: server.target(), ContainerId: "web", Shell: "bash", User: "app"}
+	socket := dialContainerExec(t, router, req)
+	readTerminal(t, socket, "app@web:/$ ")
+
+	if size := <-server.terminalSizes; size != (TerminalSize{Cols: defaultTerminalCols, Rows: defaultTerminalRows}) {
+		t.Errorf("terminal size = %+v, want the default", size)
+	}
+	if err := socket.WriteJSON(terminalMessage{Type: "resize", Cols: 120, Rows: 40}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case size := <-server.terminalSizes:
+		if size != (TerminalSize{Cols: 120, Rows: 40}) {
+			t.Errorf("resized to %+v, want 120x40", size)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("terminal was never resized")
+	}
+
+	if err := socket.WriteMessage(websocket.BinaryMessage, []byte("ls /\n")); err != nil {
+		t.Fatal(err)
+	}
+	readTerminal(t, socket, "ls /\n")
+
+	// The connection stays open while the terminal is, and is released once the socket closes
+	manager.mutex.Lock()
+	terminals := manager.activeConnections[connectionKey(req.SSHTarget)].terminals
+	manager.mutex.Unlock()
+	if terminals != 1 {
+		t.Errorf("terminals on the connection = %d, want 1", terminals)
+	}
+	socket.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		manager.mutex.Lock()
+		terminals = manager.activeConnections[connectionKey(req.SSHTarget)].terminals
+		manager.mutex.Unlock()
+		if terminals == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("terminal kept open after its socket closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := ContainerExecRequest{SSHTarget: server.target(), ContainerId: "stopped"}
+	if status := postJSON(t, router, "/container/exec", stopped, nil); status != http.StatusConflict {
+		t.Errorf("exec into a stopped container answered %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestContainerExecExit(t *testing.T) {
+	api := fakeDockerAPI{
+		"GET /containers/web/json": {body: `{"Id":"0123456789abcdef","Name":"/web","State":{"Status":"running","Running":true}}`},
+	}
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		Command("sudo", "-n", "docker", "exec", "-it", "web", "/bin/sh").String(): {stdout: "exit\r\n", status: 3},
+	})
+	server := startSSHServer(t, executor, api)
+	router := newTestRouter(server.manager(t))
+
+	socket := dialContainerExec(t, router, ContainerExecRequest{SSHTarget: server.target(), ContainerId: "web", Shell: "/bin/sh"})
+	readTerminal(t, socket, "exit\r\n")
+
+	socket.SetReadDeadline(time.Now().Add(5 * time.Second))
+	kind, data, err := socket.ReadMessage()
+	if err != nil || kind != websocket.TextMessage {
+		t.Fatalf("read %d %q (%v), want the exit message", kind, data, err)
+	}
+	var message terminalMessage
+	if err := json.Unmarshal(data, &message); err != nil || message.Type != "exit" || message.ExitCode == nil || *message.ExitCode != 3 {
+		t.Errorf("message = %s, want an exit with status 3", data)
+	}
+	if _, _, err := socket.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("socket ended with %v, want a normal close", err)
+	}
+}
+
+func TestHostTerminalRequest(t *testing.T) {
+	tests := []struct {
+		req     HostTerminalRequest
+		timeout time.Duration
+		invalid bool
+	}{
+		{req: HostTerminalRequest{}, timeout: defaultHostTerminalIdleTimeout},
+		{req: HostTerminalRequest{IdleTimeout: 15}, timeout: 15 * time.Minute},
+		{req: HostTerminalRequest{IdleTimeout: neverIdleTimeout}, timeout: 0},
+		{req: HostTerminalRequest{IdleTimeout: -5}, invalid: true},
+		{req: HostTerminalRequest{IdleTimeout: 24*60 + 1}, invalid: true},
+		{req: HostTerminalRequest{TerminalSize: TerminalSize{Rows: -1}}, invalid: true},
+	}
+	for _, test := range tests {
+		err := test.req.Validate()
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%+v passed validation", test.req)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", test.req, err)
+			continue
+		}
+		if timeout := test.req.idleTimeout(); timeout != test.timeout {
+			t.Errorf("idle timeout of %+v = %v, want %v", test.req, timeout, test.timeout)
+		}
+	}
+
+	name := transcriptName(SSHTarget{Hostname: "web1.example.com", Username: "deploy"}, time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC))
+	if name != "deploy-web1.example.com-20240501-101500.000.log" {
+		t.Errorf("transcript name = %s", name)
+	}
+}
+
+func TestHostTerminal(t *testing.T) {
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		"": {stdout: "tester@host:~$ ", echo: true},
+	})
+	server := startSSHServer(t, executor, nil)
+	srv := NewServer(server.manager(t))
+	srv.transcriptsDir = t.TempDir()
+	router := echo.New()
+	srv.Register(router)
+
+	var created TerminalResponse
+	req := HostTerminalRequest{SSHTarget: server.target(), Transcript: true}
+	if status := postJSON(t, router, "/host/terminal", req, &created); status != http.StatusOK {
+		t.Fatalf("creating the terminal answered %d", status)
+	}
+	if filepath.Dir(created.Transcript) != srv.transcriptsDir {
+		t.Errorf("transcript %q is outside %s", created.Transcript, srv.transcriptsDir)
+	}
+
+	listener := httptest.NewServer(router)
+	defer listener.Close()
+
+	// Other pages are turned away, even with a valid token
+	if _, err := dialTerminal(listener, created.Path, created.Token, http.Header{"Origin": {"https://attacker.example"}}); !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Errorf("opening from another page gave %v, want a refused handshake", err)
+	}
+	socket, err := dialTerminal(listener, created.Path, created.Token, http.Header{"Origin": {"file://"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readTerminal(t, socket, "tester@host:~$ ")
+	if err := socket.WriteMessage(websocket.BinaryMessage, []byte("uptime\n")); err != nil {
+		t.Fatal(err)
+	}
+	readTerminal(t, socket, "uptime\n")
+	socket.Close()
+
+	// The transcript is complete once the terminal hangs up
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorded, err := os.ReadFile(created.Transcript)
+		if err == nil && strings.Contains(string(recorded), "Transcript ended") {
+			if !strings.Contains(string(recorded), "tester@host:~$ uptime\n") {
+				t.Errorf("transcript = %q, want the prompt and the command", recorded)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transcript never finished: %q (%v)", recorded, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Only SSH has a host to log in to
+	tls := HostTerminalRequest{SSHTarget: SSHTarget{Transport: TransportTCPTLS, Hostname: "docker.example.com"}}
+	if status := postJSON(t, router, "/host/terminal", tls, nil); status == http.StatusOK {
+		t.Errorf("a host terminal over TCP+TLS answered %d", status)
+	}
+}
+
+func TestHostTerminalIdle(t *testing.T) {
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		"": {stdout: "tester@host:~$ ", echo: true},
+	})
+	server := startSSHServer(t, executor, nil)
+	manager := server.manager(t)
+	srv := NewServer(manager)
+	router := echo.New()
+	srv.Register(router)
+
+	req := HostTerminalRequest{SSHTarget: server.target()}
+	token, err := srv.terminals.add(pendingTerminal{
+		path:        "/host/terminal",
+		open:        func() (*Terminal, error) { return manager.OpenHostTerminal(req) },
+		idleTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := httptest.NewServer(router)
+	defer listener.Close()
+	socket, err := dialTerminal(listener, "/host/terminal", token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	readTerminal(t, socket, "tester@host:~$ ")
+
+	started := time.Now()
+	socket.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		kind, data, err := socket.ReadMessage()
+		if err != nil {
+			t.Fatalf("socket ended with %v before the idle message", err)
+		}
+		if kind != websocket.TextMessage {
+			continue
+		}
+		var message terminalMessage
+		if err := json.Unmarshal(data, &message); err != nil || message.Type != "idle" {
+			t.Fatalf("message = %s, want idle", data)
+		}
+		break
+	}
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond {
+		t.Errorf("hung up after %v, before the idle timeout", elapsed)
+	}
+	if _, _, err := socket.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("socket ended with %v, want a normal close", err)
+	}
+}
+
+func TestContainerExecSudoPasswordNotAsked(t *testing.T) {
+	// NOPASSWD: sudo would start docker exec at once and the shell would read the password
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		"sudo -k -n true": {},
+	})
+	server := startSSHServer(t, executor, nil)
+	manager := server.manager(t)
+	target := server.target()
+	target.Privilege = PrivilegeSudoPassword
+	if err := manager.OpenConnection(target); err != nil {
+		t.Fatal(err)
+	}
+	manager.mutex.Lock()
+	manager.sudoPasswords[connectionKey(target)] = []byte("secret")
+	manager.mutex.Unlock()
+
+	terminal, err := manager.ExecContainer(ContainerExecRequest{SSHTarget: target, ContainerId: "web", Shell: "bash"})
+	if err == nil {
+		terminal.Close()
+	}
+	var notAsked *SudoPasswordNotAskedError
+	if !errors.As(err, &notAsked) {
+		t.Errorf("error = %v, want sudo mode suggested", err)
+	}
+	for _, ran := range executor.commands() {
+		if strings.Contains(ran, "exec") {
+			t.Errorf("ran %q with the password typed into it", ran)
+		}
+	}
+}
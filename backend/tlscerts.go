@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Certificates of TCP+TLS environments, owned by the extension and readable by nobody else
+const tlsCertificatesDir = "/root/docker-extension/tls"
+
+// Files of a certificate bundle, named like the docker CLI expects them in DOCKER_CERT_PATH
+const (
+	tlsCAFile   = "ca.pem"
+	tlsCertFile = "cert.pem"
+	tlsKeyFile  = "key.pem"
+)
+
+// Summary of a stored bundle; the key never leaves the store
+type TLSCertificateInfo struct {
+	Name          string    `json:"name"`
+	Subject       string    `json:"subject"`
+	NotAfter      time.Time `json:"notAfter"`
+	CASubject     string    `json:"caSubject"`
+	CANotAfter    time.Time `json:"caNotAfter"`
+	ExpiresInDays int       `json:"expiresInDays"`
+}
+
+// Returned for a bundle name that is not in the store
+type TLSCertificatesNotFoundError struct {
+	Name string
+}
+
+func (e *TLSCertificatesNotFoundError) Error() string {
+	return fmt.Sprintf("no TLS certificates named %q are stored", e.Name)
+}
+
+// Stores the CA, client certificate and key of each TCP+TLS environment by name
+type TLSCertificateStore struct {
+	mutex sync.Mutex
+	dir   string
+}
+
+func NewTLSCertificateStore(dir string) *TLSCertificateStore {
+	return &TLSCertificateStore{dir: dir}
+}
+
+// Directory of a bundle; names are validated like object names so they cannot leave the store
+func (s *TLSCertificateStore) path(name string) (string, error) {
+	if err := ValidateIdentifier("TLS certificate bundle", name); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// Check that the PEMs form a usable bundle and store them, replacing a bundle of the same name
+func (s *TLSCertificateStore) Save(name string, ca, cert, key []byte) (TLSCertificateInfo, error) {
+	dir, err := s.path(name)
+	if err != nil {
+		return TLSCertificateInfo{}, err
+	}
+	if _, err := tls.X509KeyPair(cert, key); err != nil {
+		return TLSCertificateInfo{}, fmt.Errorf("invalid client certificate or key: %v", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(ca) {
+		return TLSCertificateInfo{}, fmt.Errorf("invalid CA certificate: no PEM certificate found")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return TLSCertificateInfo{}, err
+	}
+	files := map[string][]byte{tlsCAFile: ca, tlsCertFile: cert, tlsKeyFile: key}
+	for file, data := range files {
+		// Written aside and renamed, so a connection never reads half a bundle
+		temp := filepath.Join(dir, "."+file)
+		if err := os.WriteFile(temp, data, 0600); err != nil {
+			return TLSCertificateInfo{}, err
+		}
+		if err := os.Rename(temp, filepath.Join(dir, file)); err != nil {
+			return TLSCertificateInfo{}, err
+		}
+	}
+	logger.Infof("Stored TLS certificates %q", name)
+	return s.infoLocked(name)
+}
+
+// Summary of a stored bundle
+func (s *TLSCertificateStore) Info(name string) (TLSCertificateInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.infoLocked(name)
+}
+
+func (s *TLSCertificateStore) infoLocked(name string) (TLSCertificateInfo, error) {
+	info := TLSCertificateInfo{Name: name}
+	dir, err := s.path(name)
+	if err != nil {
+		return info, err
+	}
+
+	cert, err := readCertificate(filepath.Join(dir, tlsCertFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return info, &TLSCertificatesNotFoundError{Name: name}
+		}
+		return info, err
+	}
+	ca, err := readCertificate(filepath.Join(dir, tlsCAFile))
+	if err != nil {
+		return info, err
+	}
+
+	info.Subject = cert.Subject.String()
+	info.NotAfter = cert.NotAfter
+	info.CASubject = ca.Subject.String()
+	info.CANotAfter = ca.NotAfter
+	info.ExpiresInDays = int(time.Until(cert.NotAfter).Hours() / 24)
+	return info, nil
+}
+
+// Summaries of every stored bundle, by name
+func (s *TLSCertificateStore) List() ([]TLSCertificateInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TLSCertificateInfo{}, nil
+		}
+		return nil, err
+	}
+
+	list := []TLSCertificateInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := s.infoLocked(entry.Name())
+		if err != nil {
+			logger.Warnf("Skipping TLS certificates %q: %v", entry.Name(), err)
+			continue
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Delete a stored bundle
+func (s *TLSCertificateStore) Remove(name string) error {
+	dir, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return &TLSCertificatesNotFoundError{Name: name}
+	}
+	logger.Infof("Removing TLS certificates %q", name)
+	return os.RemoveAll(dir)
+}
+
+// Client configuration for mutual TLS with a daemon, trusting only the bundle's CA
+func (s *TLSCertificateStore) ClientConfig(name, serverName string) (*tls.Config, error) {
+	dir, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ca, err := os.ReadFile(filepath.Join(dir, tlsCAFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &TLSCertificatesNotFoundError{Name: name}
+		}
+		return nil, err
+	}
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dir, tlsCertFile), filepath.Join(dir, tlsKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificates %q: %v", name, err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca)
+	return &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{pair},
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// The first certificate of a PEM file
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM certificate in %s", filepath.Base(path))
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
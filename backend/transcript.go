@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Transcripts of host terminals, in the data volume of the extension
+const transcriptsDir = "/root/docker-extension/transcripts"
+
+// Largest transcript recorded; what a terminal shows past it is left out
+const maxTranscriptSize = 64 << 20
+
+// File name for a transcript of a terminal on the target, like deploy-web1.example.com-20240501-101500.000.log
+func transcriptName(target SSHTarget, started time.Time) string {
+	name := []byte(target.String())
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			name[i] = '-'
+		}
+	}
+	return fmt.Sprintf("%s-%s.log", name, started.UTC().Format("20060102-150405.000"))
+}
+
+// Output of a terminal as it was shown, escape sequences included, as script(1) records it
+type transcript struct {
+	file    *os.File
+	written int64
+	failed  bool
+}
+
+// Start a new transcript file, readable only by the backend
+func createTranscript(path string) (*transcript, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Recording terminal to %s", path)
+	fmt.Fprintf(file, "Transcript started on %s\n", time.Now().UTC().Format(time.RFC3339))
+	return &transcript{file: file}, nil
+}
+
+// Record output; a transcript that is full or failed never fails the terminal
+func (t *transcript) Write(p []byte) (int, error) {
+	if t.failed {
+		return len(p), nil
+	}
+	data := p
+	if t.written+int64(len(data)) > maxTranscriptSize {
+		data = data[:maxTranscriptSize-t.written]
+	}
+	n, err := t.file.Write(data)
+	t.written += int64(n)
+	if err != nil {
+		logger.Warnf("Stopped recording terminal to %s: %v", t.file.Name(), err)
+		t.failed = true
+	} else if t.written >= maxTranscriptSize {
+		logger.Warnf("Stopped recording terminal to %s, it reached %d bytes", t.file.Name(), maxTranscriptSize)
+		fmt.Fprintf(t.file, "\nTranscript cut off at %d bytes\n", maxTranscriptSize)
+		t.failed = true
+	}
+	return len(p), nil
+}
+
+func (t *transcript) Close() error {
+	if !t.failed {
+		fmt.Fprintf(t.file, "\nTranscript ended on %s\n", time.Now().UTC().Format(time.RFC3339))
+	}
+	return t.file.Close()
+}
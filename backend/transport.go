@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How an environment is reached
+type TransportKind string
+
+const (
+	TransportSSH    TransportKind = "ssh"     // Docker behind an SSH connection
+	TransportTCPTLS TransportKind = "tcp-tls" // Docker listening on TCP with mutual TLS
+)
+
+// Port the Docker daemon listens on for TLS by convention
+const defaultDockerTLSPort = 2376
+
+// The transport of the target, SSH unless another one was chosen
+func (t SSHTarget) transport() TransportKind {
+	if t.Transport == "" {
+		return TransportSSH
+	}
+	return t.Transport
+}
+
+// Whether a request leaves out fields the transport of the target needs
+func (t SSHTarget) missingFields() bool {
+	if t.transport() == TransportTCPTLS {
+		return t.Hostname == ""
+	}
+	return t.Hostname == "" || t.Username == ""
+}
+
+// Check a TCP+TLS target; none of the SSH settings apply to it
+func (t SSHTarget) validateTLS() error {
+	if t.Hostname == "" {
+		return fmt.Errorf("hostname is required")
+	}
+	if t.Port < 0 || t.Port > 65535 {
+		return fmt.Errorf("invalid port %d", t.Port)
+	}
+	if t.ConnectTimeout < 0 || t.connectTimeout() > maxConnectTimeout {
+		return fmt.Errorf("connect timeout must be between 1 and %d seconds", int(maxConnectTimeout.Seconds()))
+	}
+	if t.TLSCertificates == "" {
+		return fmt.Errorf("TLS certificates are required for a TCP+TLS environment")
+	}
+	if t.IdentityFile != "" || len(t.SSHOptions) > 0 || len(t.JumpHosts) > 0 {
+		return fmt.Errorf("identity files, SSH options and jump hosts only apply to SSH environments")
+	}
+	if t.engine() != EngineDocker || t.Privilege != PrivilegeAuto || t.DockerHost != "" {
+		return fmt.Errorf("a TCP+TLS environment talks to the Docker Engine API directly, without an engine or privilege mode")
+	}
+	return nil
+}
+
+// Returned for an operation that needs a transport the target does not use
+type UnsupportedTransportError struct {
+	Transport TransportKind
+	Operation string
+}
+
+func (e *UnsupportedTransportError) Error() string {
+	return fmt.Sprintf("%s is not possible over %s, it needs SSH", e.Operation, e.Transport)
+}
+
+// Health of a TCP+TLS connection, as reported by /tunnel/status
+type TLSStatus struct {
+	Version           string     `json:"version,omitempty"`
+	CipherSuite       string     `json:"cipherSuite,omitempty"`
+	ServerSubject     string     `json:"serverSubject,omitempty"`
+	ServerNotAfter    *time.Time `json:"serverNotAfter,omitempty"` // Unset until a handshake has been seen
+	ClientNotAfter    *time.Time `json:"clientNotAfter,omitempty"` // Unset when the client certificate cannot be read
+	APIVersion        string     `json:"apiVersion,omitempty"`
+	LastPing          time.Time  `json:"lastPing"`
+	LatencyMs         float64    `json:"latencyMs"`
+	CertificateExpiry string     `json:"certificateExpiry,omitempty"` // Warning once a certificate is about to expire
+}
+
+// Certificates expiring sooner than this are warned about
+const certificateExpiryWarning = 14 * 24 * time.Hour
+
+// Dials the daemon with mutual TLS, remembering the last handshake for the health report
+type tlsDialer struct {
+	address string
+	config  *tls.Config
+	timeout time.Duration
+
+	mutex sync.Mutex
+	state *tls.ConnectionState
+}
+
+func (d *tlsDialer) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: d.timeout}, Config: d.config}
+	conn, err := dialer.DialContext(ctx, "tcp", d.address)
+	if err != nil {
+		return nil, contextError(ctx, fmt.Errorf("failed to connect to %s: %w", d.address, err))
+	}
+
+	state := conn.(*tls.Conn).ConnectionState()
+	d.mutex.Lock()
+	d.state = &state
+	d.mutex.Unlock()
+	return conn, nil
+}
+
+// The last completed handshake, nil before the first one
+func (d *tlsDialer) connectionState() *tls.ConnectionState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.state
+}
+
+// Connect to a TCP+TLS daemon and check it answers; there is no session to keep, only health to watch
+func (m *SSHTunnelManager) openTLSConnection(target SSHTarget) error {
+	if err := target.Validate(m.keyDir); err != nil {
+		return err
+	}
+	config, err := m.tlsCertificates.ClientConfig(target.TLSCertificates, target.Hostname)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	key := connectionKey(target)
+	if conn, exists := m.activeConnections[key]; exists && conn.Active {
+		if conn.State.usable() {
+			conn.LastUsed = time.Now()
+			m.applyPolicyLocked(key, conn, target.ConnectionPolicy)
+			m.openConnections.Remember(target)
+			m.mutex.Unlock()
+			return nil
+		}
+		m.closeLocked(key, conn)
+		delete(m.activeConnections, key)
+	}
+
+	dialer := &tlsDialer{address: target.address(), config: config, timeout: target.connectTimeout()}
+	conn := &SSHConnection{
+		Target:    target,
+		LastUsed:  time.Now(),
+		Active:    true,
+		State:     StateConnecting,
+		since:     time.Now(),
+		connected: make(chan struct{}),
+		retry:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		docker:    newDockerClient(dialer.dial),
+		tlsDialer: dialer,
+
+		policy:        target.ConnectionPolicy,
+		policyChanged: make(chan struct{}, 1),
+	}
+	m.activeConnections[key] = conn
+	m.mutex.Unlock()
+
+	logger.Infof("Connecting to Docker at %s over TLS", key)
+	ctx, cancel := context.WithTimeout(context.Background(), target.connectTimeout())
+	health, err := m.checkTLS(ctx, conn)
+	cancel()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	defer close(conn.connected)
+
+	if err != nil {
+		conn.setStateLocked(StateFailed, fmt.Errorf("failed to reach Docker over TLS: %w", err))
+		m.publishLocked(EventFailed, key, conn)
+		m.closeLocked(key, conn)
+		if m.activeConnections[key] == conn {
+			delete(m.activeConnections, key)
+		}
+		return conn.lastErr
+	}
+	if !conn.Active {
+		return fmt.Errorf("connection to %s was closed while connecting", key)
+	}
+
+	conn.tls = health
+	conn.setStateLocked(StateReady, nil)
+	m.publishLocked(EventOpened, key, conn)
+	m.background(func() { m.superviseTLS(key, conn) })
+	m.openConnections.Remember(target)
+
+	logger.Infof("Successfully connected to Docker at %s over TLS", key)
+	return nil
+}
+
+// Ping the daemon and describe the TLS session it was reached over
+func (m *SSHTunnelManager) checkTLS(ctx context.Context, conn *SSHConnection) (*TLSStatus, error) {
+	started := time.Now()
+	if err := conn.docker.Ping(ctx); err != nil {
+		return nil, err
+	}
+
+	health := &TLSStatus{
+		LastPing:  time.Now(),
+		LatencyMs: float64(time.Since(started).Microseconds()) / 1000,
+	}
+	health.APIVersion, _ = conn.docker.apiVersion(ctx)
+
+	if state := conn.tlsDialer.connectionState(); state != nil {
+		health.Version = tls.VersionName(state.Version)
+		health.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		if len(state.PeerCertificates) > 0 {
+			health.ServerSubject = state.PeerCertificates[0].Subject.String()
+			health.ServerNotAfter = &state.PeerCertificates[0].NotAfter
+		}
+	}
+	if info, err := m.tlsCertificates.Info(conn.Target.TLSCertificates); err == nil {
+		health.ClientNotAfter = &info.NotAfter
+	}
+	health.CertificateExpiry = certificateExpiry(health.ServerNotAfter, health.ClientNotAfter, time.Now())
+	return health, nil
+}
+
+// Warning about whichever certificate expires first within certificateExpiryWarning of now,
+// the server's winning a tie
+func certificateExpiry(server, client *time.Time, now time.Time) string {
+	var warning string
+	var earliest time.Time
+	for _, cert := range []struct {
+		name     string
+		notAfter *time.Time
+	}{{"server", server}, {"client", client}} {
+		if cert.notAfter == nil || cert.notAfter.Sub(now) >= certificateExpiryWarning {
+			continue
+		}
+		if warning == "" || cert.notAfter.Before(earliest) {
+			earliest = *cert.notAfter
+			warning = fmt.Sprintf("the %s certificate expires on %s", cert.name, earliest.Format("2006-01-02"))
+		}
+	}
+	return warning
+}
+
+// Ping a TCP+TLS daemon on every keepalive tick. Requests dial on their own, so a daemon
+// that stops answering is only reported as degraded until it answers again.
+func (m *SSHTunnelManager) superviseTLS(key string, conn *SSHConnection) {
+	policy := m.policy(conn)
+	ticker := time.NewTicker(policy.keepaliveInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-conn.policyChanged:
+			policy = m.policy(conn)
+			ticker.Reset(policy.keepaliveInterval())
+			continue
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), policy.keepaliveInterval())
+		health, err := m.checkTLS(ctx, conn)
+		cancel()
+
+		m.mutex.Lock()
+		if !conn.Active {
+			m.mutex.Unlock()
+			return
+		}
+		switch {
+		case err != nil && conn.State == StateReady:
+			logger.Warnf("Docker at %s stopped answering: %v", key, err)
+			conn.setStateLocked(StateDegraded, err)
+			m.publishLocked(EventDegraded, key, conn)
+		case err != nil:
+			conn.lastErr = err
+		case conn.State == StateDegraded:
+			logger.Infof("Docker at %s answers again", key)
+			conn.tls = health
+			conn.setStateLocked(StateReady, nil)
+			m.publishLocked(EventRecovered, key, conn)
+		default:
+			conn.tls = health
+		}
+		m.mutex.Unlock()
+	}
+}
+
+// tcp-tls://host:port, how a TCP+TLS target is shown
+func (t SSHTarget) tlsString() string {
+	return "tcp-tls://" + net.JoinHostPort(t.Hostname, strconv.Itoa(t.port()))
+}
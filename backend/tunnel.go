@@ -0,0 +1,817 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// Directory holding the user's SSH keys, mounted read-only from the host
+	sshDir = "/root/.ssh"
+
+	defaultSSHPort = 22
+
+	// How long dialing and the SSH handshake may take, and the keepalive request sent to probe a connection
+	defaultConnectTimeout = 5 * time.Second
+	maxConnectTimeout     = 2 * time.Minute
+	keepaliveRequest      = "keepalive@openssh.com"
+)
+
+// Identities tried by default, in the same order as the OpenSSH client
+var defaultIdentityFiles = []string{"id_rsa", "id_ecdsa", "id_ed25519", "id_dsa"}
+
+// SSH options an environment may set, mapped onto the native client configuration
+var allowedSSHOptions = map[string]bool{
+	"Ciphers":           true,
+	"KexAlgorithms":     true,
+	"MACs":              true,
+	"HostKeyAlgorithms": true,
+}
+
+// Everything needed to reach an environment, over SSH unless it says otherwise
+type SSHTarget struct {
+	Transport        TransportKind     `json:"transport,omitempty"` // SSH when empty
+	Hostname         string            `json:"hostname"`
+	Username         string            `json:"username"`
+	Port             int               `json:"port,omitempty"`
+	IdentityFile     string            `json:"identityFile,omitempty"`   // Relative to ~/.ssh unless absolute
+	ConnectTimeout   int               `json:"connectTimeout,omitempty"` // Seconds
+	SSHOptions       map[string]string `json:"sshOptions,omitempty"`     // Only allowedSSHOptions
+	JumpHosts        []JumpHost        `json:"jumpHosts,omitempty"`      // Connected in order before the target
+	DockerAccess                       // How Docker is reached once connected
+	ConnectionPolicy                   // Idle timeout and keepalives, which may change while connected
+
+	TLSCertificates string `json:"tlsCertificates,omitempty"` // Stored bundle of a TCP+TLS target
+}
+
+// Port to connect to, falling back to the default of the transport
+func (t SSHTarget) port() int {
+	if t.Port != 0 {
+		return t.Port
+	}
+	if t.transport() == TransportTCPTLS {
+		return defaultDockerTLSPort
+	}
+	return defaultSSHPort
+}
+
+// host:port address to dial
+func (t SSHTarget) address() string {
+	return net.JoinHostPort(t.Hostname, strconv.Itoa(t.port()))
+}
+
+func (t SSHTarget) connectTimeout() time.Duration {
+	if t.ConnectTimeout == 0 {
+		return defaultConnectTimeout
+	}
+	return time.Duration(t.ConnectTimeout) * time.Second
+}
+
+// user@host, with the port only when it is not the default
+func (t SSHTarget) String() string {
+	if t.transport() == TransportTCPTLS {
+		return t.tlsString()
+	}
+	if t.port() == defaultSSHPort {
+		return fmt.Sprintf("%s@%s", t.Username, t.Hostname)
+	}
+	return fmt.Sprintf("%s@%s:%d", t.Username, t.Hostname, t.port())
+}
+
+// Check the target before anything is dialed; identity files must be inside keyDir
+func (t SSHTarget) Validate(keyDir string) error {
+	if err := t.ConnectionPolicy.Validate(); err != nil {
+		return err
+	}
+
+	switch t.transport() {
+	case TransportSSH:
+	case TransportTCPTLS:
+		return t.validateTLS()
+	default:
+		return fmt.Errorf("unknown transport %q", t.Transport)
+	}
+
+	if t.Hostname == "" || t.Username == "" {
+		return fmt.Errorf("hostname and username are required")
+	}
+	if t.Port < 0 || t.Port > 65535 {
+		return fmt.Errorf("invalid port %d", t.Port)
+	}
+	if t.ConnectTimeout < 0 || t.connectTimeout() > maxConnectTimeout {
+		return fmt.Errorf("connect timeout must be between 1 and %d seconds", int(maxConnectTimeout.Seconds()))
+	}
+	if t.IdentityFile != "" {
+		if _, err := resolveIdentityFile(keyDir, t.IdentityFile); err != nil {
+			return err
+		}
+	}
+	for option := range t.SSHOptions {
+		if !allowedSSHOptions[option] {
+			return fmt.Errorf("SSH option %q is not allowed", option)
+		}
+	}
+	if len(t.JumpHosts) > maxJumpHosts {
+		return fmt.Errorf("at most %d jump hosts are supported", maxJumpHosts)
+	}
+	for i, jump := range t.hops()[:len(t.JumpHosts)] {
+		if err := jump.Validate(keyDir); err != nil {
+			return fmt.Errorf("jump host %d: %v", i+1, err)
+		}
+	}
+	return t.DockerAccess.Validate()
+}
+
+// Resolve an identity file path, which must stay inside the mounted ~/.ssh
+func resolveIdentityFile(keyDir, identityFile string) (string, error) {
+	path := identityFile
+	switch {
+	case strings.HasPrefix(path, "~/.ssh/"):
+		path = filepath.Join(keyDir, strings.TrimPrefix(path, "~/.ssh/"))
+	case !filepath.IsAbs(path):
+		path = filepath.Join(keyDir, path)
+	}
+	path = filepath.Clean(path)
+
+	if rel, err := filepath.Rel(keyDir, path); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("identity file %q must be inside ~/.ssh", identityFile)
+	}
+	return path, nil
+}
+
+// Split a comma separated algorithm list from an SSH option
+func optionList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// SSH tunnel manager that maintains persistent connections
+type SSHTunnelManager struct {
+	activeConnections map[string]*SSHConnection
+	mutex             sync.Mutex
+	keyDir            string
+	sshConfigPath     string
+	hostKeys          *HostKeyStore
+	identities        *IdentityStore
+	events            *EventBroker
+	sudoPasswords     map[string][]byte // By connection key, only for this session
+	tlsCertificates   *TLSCertificateStore
+	openConnections   *OpenConnectionStore
+	forwards          map[int]*portForward // By local port
+
+	// Supervisors, client watchers and the cleanup routine, waited for on shutdown
+	routines sync.WaitGroup
+	stopping chan struct{}
+}
+
+// SSH connection information
+type SSHConnection struct {
+	Target   SSHTarget // Resolved against ~/.ssh/config
+	Client   *ssh.Client
+	LastUsed time.Time
+	Active   bool // Until the connection is closed; the client may be down meanwhile
+	State    ConnectionState
+
+	// Connections to the jump hosts, in chain order
+	jumpClients []*ssh.Client
+
+	since     time.Time
+	lastErr   error
+	attempts  int
+	nextRetry time.Time
+
+	// Closed once the first dial is over, successful or not
+	connected chan struct{}
+
+	// Wakes the supervisor up to retry without waiting for the backoff
+	retry chan struct{}
+
+	// Why a client of the chain ended, handed to the supervisor to reconnect right away
+	dropped chan error
+
+	// Idle timeout and keepalives in effect, and a wake-up for the supervisor when they change
+	policy        ConnectionPolicy
+	policyChanged chan struct{}
+
+	// Terminals open on the connection, which keep it from being closed as idle
+	terminals int
+
+	// Closed to stop the supervisor
+	done chan struct{}
+
+	// Engine API client over the connection, created on first use for the access it was asked with
+	docker       *DockerClient
+	dockerAccess DockerAccess
+
+	// Dialer and last health check of a TCP+TLS connection, which has no SSH client
+	tlsDialer *tlsDialer
+	tls       *TLSStatus
+}
+
+// Files the manager reads and writes; fixed in the extension container, temporary in tests
+type managerPaths struct {
+	keyDir          string
+	sshConfig       string
+	knownHosts      string
+	userKnownHosts  string
+	tlsCertificates string
+	openConnections string
+}
+
+var defaultManagerPaths = managerPaths{
+	keyDir:          sshDir,
+	sshConfig:       sshConfigFilePath,
+	knownHosts:      knownHostsFilePath,
+	userKnownHosts:  userKnownHostsFilePath,
+	tlsCertificates: tlsCertificatesDir,
+	openConnections: openConnectionsFilePath,
+}
+
+// Create a new SSH tunnel manager
+func NewSSHTunnelManager() (*SSHTunnelManager, error) {
+	return newSSHTunnelManager(defaultManagerPaths)
+}
+
+func newSSHTunnelManager(paths managerPaths) (*SSHTunnelManager, error) {
+	hostKeys, err := NewHostKeyStore(paths.knownHosts, paths.userKnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSHTunnelManager{
+		activeConnections: make(map[string]*SSHConnection),
+		keyDir:            paths.keyDir,
+		sshConfigPath:     paths.sshConfig,
+		hostKeys:          hostKeys,
+		identities:        NewIdentityStore(paths.keyDir),
+		events:            NewEventBroker(),
+		sudoPasswords:     make(map[string][]byte),
+		tlsCertificates:   NewTLSCertificateStore(paths.tlsCertificates),
+		openConnections:   NewOpenConnectionStore(paths.openConnections),
+		forwards:          make(map[int]*portForward),
+		stopping:          make(chan struct{}),
+	}, nil
+}
+
+// Generate connection key for mapping; targets only share a connection if every field matches
+func connectionKey(target SSHTarget) string {
+	if target.transport() == TransportTCPTLS {
+		key := target.tlsString() + "?tlsCertificates=" + target.TLSCertificates
+		if target.ConnectTimeout != 0 {
+			key += "&connectTimeout=" + strconv.Itoa(target.ConnectTimeout)
+		}
+		return key
+	}
+
+	key := fmt.Sprintf("%s@%s:%d", target.Username, target.Hostname, target.port())
+
+	var params []string
+	if target.IdentityFile != "" {
+		params = append(params, "identityFile="+target.IdentityFile)
+	}
+	if target.ConnectTimeout != 0 {
+		params = append(params, "connectTimeout="+strconv.Itoa(target.ConnectTimeout))
+	}
+
+	// Options are sorted so the key is stable, jump hosts keep their order
+	options := make([]string, 0, len(target.SSHOptions))
+	for option, value := range target.SSHOptions {
+		options = append(options, option+"="+value)
+	}
+	sort.Strings(options)
+	params = append(params, options...)
+
+	for _, jump := range target.JumpHosts {
+		params = append(params, "jumpHost="+jump.key())
+	}
+
+	if len(params) > 0 {
+		key += "?" + strings.Join(params, "&")
+	}
+	return key
+}
+
+// Build the client configuration for a target, along with the identities skipped because they are locked
+func (m *SSHTunnelManager) clientConfig(target SSHTarget) (*ssh.ClientConfig, []LockedIdentity, error) {
+	signers, locked, err := m.identities.Signers(target.IdentityFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(signers) == 0 {
+		if len(locked) > 0 {
+			return nil, nil, m.identities.RequirePassphrase(locked[0])
+		}
+		return nil, nil, fmt.Errorf("no usable SSH identity found in %s and no SSH agent available", m.keyDir)
+	}
+
+	config := &ssh.ClientConfig{
+		User:              target.Username,
+		Auth:              []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback:   m.hostKeys.Callback(),
+		HostKeyAlgorithms: m.hostKeys.KnownAlgorithms(target.address()),
+		Timeout:           target.connectTimeout(),
+	}
+
+	// Apply the allowlisted options on top of the defaults
+	names := make([]string, 0, len(target.SSHOptions))
+	for option := range target.SSHOptions {
+		names = append(names, option)
+	}
+	sort.Strings(names)
+	for _, option := range names {
+		list := optionList(target.SSHOptions[option])
+		switch option {
+		case "Ciphers":
+			config.Ciphers = list
+		case "KexAlgorithms":
+			config.KeyExchanges = list
+		case "MACs":
+			config.MACs = list
+		case "HostKeyAlgorithms":
+			config.HostKeyAlgorithms = list
+		default:
+			return nil, nil, fmt.Errorf("SSH option %q is not allowed", option)
+		}
+	}
+
+	return config, locked, nil
+}
+
+// Resolve host aliases against ~/.ssh/config, which is re-read so edits apply to the next connection
+func (m *SSHTunnelManager) ResolveTarget(target SSHTarget) (SSHTarget, error) {
+	if target.transport() != TransportSSH {
+		return target, nil
+	}
+	config, err := LoadSSHConfig(m.sshConfigPath)
+	if err != nil {
+		return target, fmt.Errorf("failed to read SSH config: %v", err)
+	}
+	return config.Resolve(target)
+}
+
+// Create and start a new SSH connection
+func (m *SSHTunnelManager) OpenConnection(target SSHTarget) error {
+	if target.transport() == TransportTCPTLS {
+		return m.openTLSConnection(target)
+	}
+
+	resolved, err := m.ResolveTarget(target)
+	if err != nil {
+		return err
+	}
+	if err := resolved.Validate(m.keyDir); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	key := connectionKey(target)
+
+	// Check if connection already exists
+	if conn, exists := m.activeConnections[key]; exists && conn.Active {
+		switch conn.State {
+		case StateReady, StateDegraded:
+			// Update last used time, and the policy in case the environment was edited
+			conn.LastUsed = time.Now()
+			m.applyPolicyLocked(key, conn, target.ConnectionPolicy)
+			m.openConnections.Remember(target)
+			m.mutex.Unlock()
+			logger.Infof("Reusing existing SSH connection for %s", key)
+			return nil
+
+		case StateConnecting:
+			// Someone else is dialing already, wait for the outcome
+			connected := conn.connected
+			m.mutex.Unlock()
+			<-connected
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			if conn.State.usable() {
+				return nil
+			}
+			return conn.lastErr
+
+		case StateReconnecting:
+			// Asking for the tunnel again skips the rest of the backoff
+			select {
+			case conn.retry <- struct{}{}:
+			default:
+			}
+			status := conn.statusLocked(key)
+			m.mutex.Unlock()
+			return &ConnectionNotReadyError{Target: status.Target, State: status.State, LastError: conn.lastErr}
+
+		case StateFailed:
+			// Start over from scratch
+			m.closeLocked(key, conn)
+			delete(m.activeConnections, key)
+		}
+	}
+
+	conn := &SSHConnection{
+		Target:    resolved,
+		LastUsed:  time.Now(),
+		Active:    true,
+		State:     StateConnecting,
+		since:     time.Now(),
+		connected: make(chan struct{}),
+		retry:     make(chan struct{}, 1),
+		dropped:   make(chan error, 1),
+		done:      make(chan struct{}),
+
+		policy:        target.ConnectionPolicy,
+		policyChanged: make(chan struct{}, 1),
+	}
+	m.activeConnections[key] = conn
+	m.mutex.Unlock()
+
+	// Dial without holding the mutex, other connections carry on meanwhile
+	logger.Infof("Starting new SSH connection for %s", key)
+	clients, err := m.dialChain(resolved)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	defer close(conn.connected)
+
+	if err != nil {
+		conn.setStateLocked(StateFailed, fmt.Errorf("failed to establish SSH connection: %w", err))
+		m.publishLocked(EventFailed, key, conn)
+		if conn.Active {
+			conn.Active = false
+			close(conn.done)
+		}
+		if m.activeConnections[key] == conn {
+			delete(m.activeConnections, key)
+		}
+		return conn.lastErr
+	}
+
+	if !conn.Active {
+		// Closed while dialing
+		closeClients(clients)
+		return fmt.Errorf("SSH connection for %s was closed while connecting", key)
+	}
+
+	conn.Client = clients[len(clients)-1]
+	conn.jumpClients = clients[:len(clients)-1]
+	conn.setStateLocked(StateReady, nil)
+	m.publishLocked(EventOpened, key, conn)
+	m.watchClients(conn, clients)
+	m.background(func() { m.supervise(key, conn) })
+	m.openConnections.Remember(target)
+
+	logger.Infof("Successfully established SSH connection for %s", key)
+	return nil
+}
+
+// Tear down a connection; the caller must hold the mutex
+func (m *SSHTunnelManager) closeLocked(key string, conn *SSHConnection) {
+	if !conn.Active {
+		return
+	}
+	conn.Active = false
+	close(conn.done)
+	m.closeForwardsLocked(conn)
+
+	if conn.docker != nil {
+		conn.docker.closeIdle()
+	}
+	if conn.Client != nil {
+		if err := conn.Client.Close(); err != nil {
+			logger.Warnf("Error closing SSH connection for %s: %v", key, err)
+		}
+	}
+	closeClients(conn.jumpClients)
+}
+
+// Every client of the connection, from the first jump host to the target; empty while it is down
+func (c *SSHConnection) clients() []*ssh.Client {
+	if c.Client == nil {
+		return nil
+	}
+	return append(append([]*ssh.Client{}, c.jumpClients...), c.Client)
+}
+
+// Close a specific SSH connection. It is forgotten even when it is not open, such as a
+// remembered one that failed to restore, so it is not restored on the next start either.
+func (m *SSHTunnelManager) CloseConnection(target SSHTarget) error {
+	key := connectionKey(target)
+	m.closeConnection(key)
+	m.openConnections.Forget(key)
+	return nil
+}
+
+func (m *SSHTunnelManager) closeConnection(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	conn, exists := m.activeConnections[key]
+	if !exists || !conn.Active {
+		return // Connection doesn't exist or is already closed
+	}
+
+	logger.Infof("Closing SSH connection for %s", key)
+	m.closeLocked(key, conn)
+	delete(m.activeConnections, key)
+	m.forgetSudoPasswordLocked(key)
+	m.publishLocked(EventClosed, key, conn)
+}
+
+// Close all active SSH connections; they are not restored on the next start
+func (m *SSHTunnelManager) CloseAllConnections() {
+	m.closeAll()
+	m.openConnections.ForgetAll()
+}
+
+// Close every connection, leaving them remembered
+func (m *SSHTunnelManager) closeAll() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, conn := range m.activeConnections {
+		logger.Infof("Closing SSH connection for %s", key)
+		m.closeLocked(key, conn)
+		m.publishLocked(EventClosed, key, conn)
+	}
+
+	// Clear the map
+	m.activeConnections = make(map[string]*SSHConnection)
+	for key := range m.sudoPasswords {
+		m.forgetSudoPasswordLocked(key)
+	}
+
+	// Keys unlocked with a passphrase only live as long as the session
+	m.identities.Wipe()
+}
+
+// Get a usable connection for a target, opening it when there is none yet
+func (m *SSHTunnelManager) usableConnection(target SSHTarget) (*SSHConnection, *ssh.Client, error) {
+	m.mutex.Lock()
+	key := connectionKey(target)
+	conn, exists := m.activeConnections[key]
+
+	if !exists || !conn.Active {
+		// No active connection, try to open one
+		m.mutex.Unlock()
+		if err := m.OpenConnection(target); err != nil {
+			return nil, nil, fmt.Errorf("failed to open connection: %w", err)
+		}
+		m.mutex.Lock()
+		conn = m.activeConnections[key]
+		if conn == nil {
+			m.mutex.Unlock()
+			return nil, nil, fmt.Errorf("connection to %s closed before it could be used", target)
+		}
+	}
+
+	// A connection the supervisor is bringing back is not reopened here
+	if !conn.State.usable() {
+		err := &ConnectionNotReadyError{Target: target.String(), State: conn.State, LastError: conn.lastErr, NextRetry: conn.nextRetry}
+		m.mutex.Unlock()
+		return nil, nil, err
+	}
+
+	// Update last used time
+	conn.LastUsed = time.Now()
+	client := conn.Client
+	m.mutex.Unlock()
+
+	return conn, client, nil
+}
+
+// Execute a command in a new session on an existing SSH connection.
+// The remote process is killed once ctx is done, which happens when the client goes away.
+func (m *SSHTunnelManager) ExecuteCommand(ctx context.Context, target SSHTarget, command RemoteCommand) ([]byte, error) {
+	return m.executeCommand(ctx, target, command, nil)
+}
+
+// Execute a command with the given bytes on its stdin
+func (m *SSHTunnelManager) executeCommand(ctx context.Context, target SSHTarget, command RemoteCommand, stdin []byte) ([]byte, error) {
+	var output bytes.Buffer
+	err := m.runCommand(ctx, target, command, stdin, &output, &output)
+
+	// The output is only complete once the command exited
+	var exitErr exitStatusError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+	return output.Bytes(), err
+}
+
+// Run a command with its stdout and stderr going to the given writers.
+// Only after the command exited are they done with; past a context error they may still be written to.
+func (m *SSHTunnelManager) runCommand(ctx context.Context, target SSHTarget, command RemoteCommand, stdin []byte, stdout, stderr io.Writer) error {
+	if target.transport() != TransportSSH {
+		return &UnsupportedTransportError{Transport: target.transport(), Operation: "running commands on the host"}
+	}
+
+	if _, exists := ctx.Deadline(); !exists {
+		var cancel context.CancelFunc
+		ctx, cancel = withOperationTimeout(ctx, "remote command", commandTimeout)
+		defer cancel()
+	}
+
+	_, client, err := m.usableConnection(target)
+	if err != nil {
+		return err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	// Unlike os/exec, a session copies stdout and stderr concurrently, so one writer for both needs a lock
+	if stdout != nil && stdout == stderr {
+		shared := &syncWriter{w: stdout}
+		stdout, stderr = shared, shared
+	}
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if stdin != nil {
+		session.Stdin = bytes.NewReader(stdin)
+	}
+	if err := session.Start(command.String()); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	finished := make(chan error, 1)
+	go func() {
+		finished <- session.Wait()
+	}()
+
+	select {
+	case err := <-finished:
+		// A non-zero exit status comes back as *ssh.ExitError
+		return err
+	case <-ctx.Done():
+		// Not every server honors signals, closing the session hangs the command up as well
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		return contextError(ctx, ctx.Err())
+	}
+}
+
+// Serializes the writes of concurrent copies into one writer
+type syncWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.w.Write(p)
+}
+
+// Check if connection is active
+func (m *SSHTunnelManager) IsConnectionActive(target SSHTarget) bool {
+	return m.CheckConnection(target) == nil
+}
+
+// Report why a connection cannot run commands, or nil when it can
+func (m *SSHTunnelManager) CheckConnection(target SSHTarget) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := connectionKey(target)
+	conn, exists := m.activeConnections[key]
+	if !exists || !conn.Active {
+		return fmt.Errorf("no active SSH connection for %s", target)
+	}
+	if !conn.State.usable() {
+		return &ConnectionNotReadyError{Target: target.String(), State: conn.State, LastError: conn.lastErr, NextRetry: conn.nextRetry}
+	}
+	return nil
+}
+
+// Get the host key store used to verify connections
+func (m *SSHTunnelManager) HostKeys() *HostKeyStore {
+	return m.hostKeys
+}
+
+// Get the store of the certificates TCP+TLS environments authenticate with
+func (m *SSHTunnelManager) TLSCertificates() *TLSCertificateStore {
+	return m.tlsCertificates
+}
+
+// Get the identity store that provides the keys to authenticate with
+func (m *SSHTunnelManager) Identities() *IdentityStore {
+	return m.identities
+}
+
+// Get the path of the SSH config host aliases are resolved against
+func (m *SSHTunnelManager) SSHConfigPath() string {
+	return m.sshConfigPath
+}
+
+// Get a list of all active connections
+func (m *SSHTunnelManager) GetActiveConnections() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var connections []string
+	for key, conn := range m.activeConnections {
+		if conn.Active && conn.State.usable() {
+			connections = append(connections, key)
+		}
+	}
+	return connections
+}
+
+// Clean up connections unused for longer than their policy allows
+func (m *SSHTunnelManager) CleanupIdleConnections() {
+	for _, key := range m.closeIdleConnections() {
+		m.openConnections.Forget(key)
+	}
+}
+
+// Close the idle connections and return their keys
+func (m *SSHTunnelManager) closeIdleConnections() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var closed []string
+	now := time.Now()
+	for key, conn := range m.activeConnections {
+		idleTimeout, expires := conn.policy.idleTimeout()
+		if conn.Active && expires && now.Sub(conn.LastUsed) > idleTimeout && !m.hasForwardsLocked(conn) && conn.terminals == 0 {
+			logger.Infof("Closing idle SSH connection for %s (idle for %v)", key, now.Sub(conn.LastUsed))
+			m.closeLocked(key, conn)
+			delete(m.activeConnections, key)
+			m.forgetSudoPasswordLocked(key)
+			m.publishLocked(EventIdleReaped, key, conn)
+			closed = append(closed, key)
+		}
+	}
+	return closed
+}
+
+// Start the background cleanup routine, which runs until shutdown
+func (m *SSHTunnelManager) StartCleanupRoutine(checkInterval time.Duration) {
+	m.background(func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stopping:
+				return
+			case <-ticker.C:
+				m.CleanupIdleConnections()
+			}
+		}
+	})
+}
+
+// Run a goroutine that shutdown waits for
+func (m *SSHTunnelManager) background(routine func()) {
+	m.routines.Add(1)
+	go func() {
+		defer m.routines.Done()
+		routine()
+	}()
+}
+
+// Close every connection and wait for the goroutines watching them to return, or for ctx to be done.
+// The connections stay remembered and are restored on the next start.
+func (m *SSHTunnelManager) Shutdown(ctx context.Context) error {
+	m.mutex.Lock()
+	select {
+	case <-m.stopping:
+	default:
+		close(m.stopping)
+	}
+	m.mutex.Unlock()
+
+	m.closeAll()
+
+	stopped := make(chan struct{})
+	go func() {
+		m.routines.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("connections still closing: %w", ctx.Err())
+	}
+}
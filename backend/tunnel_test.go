@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTunnelOverSSH(t *testing.T) {
+	executor := newFakeExecutor(t, map[string]scriptedCommand{
+		hostUsageCommand.String(): {stdout: hostUsageOutput},
+		Command("podman", "volume", "ls", "--format", "json").String(): {
+			stdout: `[{"Name":"data","Driver":"local","Mountpoint":"/var/lib/containers/storage/volumes/data/_data","Labels":{"app":"shop"}}]`,
+		},
+		Command("podman", "logs", "--tail", "2", "web").String(): {stdout: "listening\n", stderr: "warning: slow\n"},
+		Command("podman", "stop", "missing").String(): {
+			stderr: "Error: no container with name or ID \"missing\" found: no such container\n", status: 125,
+		},
+	})
+	api := fakeDockerAPI{
+		"GET /containers/json":                   {body: `[{"Id":"0123456789abcdef","Names":["/web"],"Image":"nginx","State":"running","Status":"Up 2 hours"}]`},
+		"GET /containers/0123456789abcdef/stats": {body: `{"memory_stats":{"usage":1048576,"limit":2097152}}`},
+	}
+	server := startSSHServer(t, executor, api)
+	manager := server.manager(t)
+	router := newTestRouter(manager)
+	target := server.target()
+
+	var opened map[string]interface{}
+	if status := postJSON(t, router, "/tunnel/open", target, &opened); status != http.StatusOK {
+		t.Fatalf("opening the tunnel answered %d: %v", status, opened)
+	}
+
+	var status map[string]interface{}
+	postJSON(t, router, "/tunnel/status", target, &status)
+	if status["active"] != true || status["state"] != string(StateReady) {
+		t.Errorf("status = %v, want an active ready tunnel", status)
+	}
+
+	// The Engine API over the forwarded socket, and host usage from a command
+	var resources ResourcesResponse
+	if code := postJSON(t, router, "/dashboard/resources", target, &resources); code != http.StatusOK {
+		t.Fatalf("resources answered %d", code)
+	}
+	if len(resources.Containers) != 1 || resources.Containers[0].Name != "web" || resources.Containers[0].MemPerc != "50.00%" {
+		t.Errorf("containers = %+v, want web at 50%% memory", resources.Containers)
+	}
+	if resources.System.CPUUsage != 50 || resources.System.MemoryUsage != 75 || resources.System.DiskUsage != 42 {
+		t.Errorf("system = %+v, want 50%% CPU, 75%% memory and 42%% disk", resources.System)
+	}
+
+	// Podman on the same connection, through its CLI
+	podman := target
+	podman.Engine = EnginePodman
+	var volumes []map[string]interface{}
+	if code := postJSON(t, router, "/volumes/list", podman, &volumes); code != http.StatusOK {
+		t.Fatalf("volumes answered %d", code)
+	}
+	want := []map[string]interface{}{{
+		"name": "data", "driver": "local", "mountpoint": "/var/lib/containers/storage/volumes/data/_data",
+		"created": "N/A", "size": "N/A", "labels": []interface{}{"app=shop"},
+	}}
+	if !reflect.DeepEqual(volumes, want) {
+		t.Errorf("volumes = %v\nwant      %v", volumes, want)
+	}
+
+	// Logs merge stdout and stderr, which arrive over the session concurrently
+	var logs ContainerLogsResponse
+	request := ContainerLogsRequest{SSHTarget: podman, ContainerId: "web", Tail: 2}
+	if code := postJSON(t, router, "/container/logs", request, &logs); code != http.StatusOK {
+		t.Fatalf("logs answered %d", code)
+	}
+	sort.Strings(logs.Logs)
+	if !reflect.DeepEqual(logs.Logs, []string{"listening", "warning: slow"}) {
+		t.Errorf("logs = %q, want both streams", logs.Logs)
+	}
+
+	// A real exit status comes back as an engine error
+	var stopped map[string]interface{}
+	if code := postJSON(t, router, "/container/stop", ContainerRequest{SSHTarget: podman, ContainerId: "missing"}, &stopped); code != http.StatusNotFound {
+		t.Errorf("stopping a missing container answered %d: %v", code, stopped)
+	}
+
+	if code := postJSON(t, router, "/tunnel/close", target, nil); code != http.StatusOK {
+		t.Errorf("closing the tunnel answered %d", code)
+	}
+	if _, exists := manager.Status(target); exists {
+		t.Errorf("connection still listed after closing it")
+	}
+
+	ran := executor.commands()
+	if len(ran) != 4 {
+		t.Errorf("commands run = %q, want host usage, volume ls, logs and stop", ran)
+	}
+}
+
+func TestTunnelUnknownHostKey(t *testing.T) {
+	server := startSSHServer(t, newFakeExecutor(t, nil), fakeDockerAPI{})
+	manager := server.manager(t)
+	if err := os.WriteFile(manager.hostKeys.path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	router := newTestRouter(manager)
+
+	var response struct {
+		Error   string         `json:"error"`
+		HostKey PendingHostKey `json:"hostKey"`
+	}
+	if code := postJSON(t, router, "/tunnel/open", server.target(), &response); code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d (%s)", code, http.StatusConflict, response.Error)
+	}
+	if !strings.HasPrefix(response.HostKey.Fingerprint, "SHA256:") {
+		t.Errorf("host key = %+v, want the fingerprint of the server key", response.HostKey)
+	}
+
+	// Once accepted, the same server can be connected to
+	accept := HostKeyRequest{Address: response.HostKey.Address, Fingerprint: response.HostKey.Fingerprint}
+	if code := postJSON(t, router, "/tunnel/hostkey/accept", accept, nil); code != http.StatusOK {
+		t.Fatalf("accepting the host key answered %d", code)
+	}
+	if code := postJSON(t, router, "/tunnel/open", server.target(), &response); code != http.StatusOK {
+		t.Errorf("opening after accepting answered %d: %s", code, response.Error)
+	}
+}
+
+func TestTunnelReconnectsWhenClientEnds(t *testing.T) {
+	server := startSSHServer(t, newFakeExecutor(t, nil), fakeDockerAPI{})
+	manager := server.manager(t)
+	target := server.target()
+
+	events, unsubscribe := manager.Events().Subscribe()
+	defer unsubscribe()
+
+	if err := manager.OpenConnection(target); err != nil {
+		t.Fatal(err)
+	}
+	server.dropConnections()
+
+	// Noticed from the client ending, long before keepalives would have gone unanswered
+	want := []TunnelEventType{EventOpened, EventBroken, EventReconnected}
+	deadline := time.After(defaultKeepaliveInterval)
+	for _, eventType := range want {
+		select {
+		case event := <-events:
+			if event.Type != eventType {
+				t.Fatalf("event = %s (%s), want %s", event.Type, event.Error, eventType)
+			}
+		case <-deadline:
+			t.Fatalf("no %s event before the first keepalive", eventType)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(manager.Statuses()) != 0 {
+		t.Errorf("connections left after shutdown: %+v", manager.Statuses())
+	}
+}
+
+func TestTunnelReconnectsWhenKeepalivesGoUnanswered(t *testing.T) {
+	server := startSSHServer(t, newFakeExecutor(t, nil), fakeDockerAPI{})
+	manager := server.manager(t)
+	target := server.target()
+	target.KeepaliveInterval = 1
+	target.KeepaliveCountMax = 2
+
+	events, unsubscribe := manager.Events().Subscribe()
+	defer unsubscribe()
+
+	if err := manager.OpenConnection(target); err != nil {
+		t.Fatal(err)
+	}
+
+	// The TCP connection stays up, only the replies stop
+	server.silent.Store(true)
+	want := []TunnelEventType{EventOpened, EventDegraded, EventBroken}
+	deadline := time.After(10 * time.Second)
+	for _, eventType := range want {
+		select {
+		case event := <-events:
+			if event.Type != eventType {
+				t.Fatalf("event = %s (%s), want %s", event.Type, event.Error, eventType)
+			}
+		case <-deadline:
+			t.Fatalf("no %s event while keepalives went unanswered", eventType)
+		}
+	}
+
+	// Closing is not held up by a probe waiting for its reply
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTargetIdentityFileInKeyDir(t *testing.T) {
+	keyDir := t.TempDir()
+	target := SSHTarget{Hostname: "web1.example.com", Username: "deploy", IdentityFile: filepath.Join(keyDir, "id_deploy")}
+
+	// Validated against the directory the manager dials with, not the default ~/.ssh
+	if err := target.Validate(keyDir); err != nil {
+		t.Errorf("identity file inside the key directory: %v", err)
+	}
+	if err := target.Validate(sshDir); err == nil {
+		t.Error("identity file outside ~/.ssh passed validation")
+	}
+	target.JumpHosts = []JumpHost{{Hostname: "bastion.example.com", Username: "deploy", IdentityFile: "../id_bastion"}}
+	if err := target.Validate(keyDir); err == nil {
+		t.Error("jump host identity file outside the key directory passed validation")
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	soon, sooner, later := now.AddDate(0, 0, 10), now.AddDate(0, 0, 5), now.AddDate(1, 0, 0)
+
+	tests := []struct {
+		name           string
+		server, client *time.Time
+		want           string
+	}{
+		{"neither close", &later, &later, ""},
+		{"unknown certificates", nil, nil, ""},
+		{"server first", &sooner, &soon, "the server certificate expires on 2024-01-06"},
+		{"client first", &soon, &sooner, "the client certificate expires on 2024-01-06"},
+		{"only the client close", &later, &soon, "the client certificate expires on 2024-01-11"},
+		{"same day", &soon, &soon, "the server certificate expires on 2024-01-11"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := certificateExpiry(test.server, test.client, now); got != test.want {
+				t.Errorf("expiry = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
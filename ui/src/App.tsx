@@ -21,6 +21,14 @@ import {
   CircularProgress,
   Alert,
   Button,
+  Dialog,
+  DialogActions,
+  DialogContent,
+  DialogContentText,
+  DialogTitle,
+  TextField,
+  FormControlLabel,
+  Switch,
   useTheme
 } from '@mui/material';
 
@@ -39,6 +47,8 @@ import Images from './pages/docker/Images';
 import Volumes from './pages/docker/Volumes';
 import Networks from './pages/docker/Networks';
 import Environments from './pages/settings/Environments';
+import ConfirmationDialog from './components/ConfirmationDialog';
+import Terminal, { TerminalSession, TerminalSize } from './components/Terminal';
 
 // Note: This line relies on Docker Desktop's presence as a host application.
 const client = createDockerDesktopClient();
@@ -47,14 +57,65 @@ function useDockerDesktopClient() {
   return client;
 }
 
+// Intermediate host an environment is reached through, in chain order
+export interface JumpHost {
+  hostname: string;
+  username: string;
+  port?: number;
+  identityFile?: string; // Relative to ~/.ssh
+}
+
 // Environment interface
 export interface Environment {
   id: string;
   name: string;
+  transport?: Transport; // SSH when unset
   hostname: string;
-  username: string;
+  username: string; // Unused over TCP+TLS
+  port?: number;
+  identityFile?: string; // Relative to ~/.ssh
+  connectTimeout?: number; // Seconds
+  sshOptions?: Record<string, string>;
+  jumpHosts?: JumpHost[];
+  engine?: ContainerEngine; // Docker when unset
+  privilegeMode?: PrivilegeMode; // Automatic when unset
+  dockerHost?: string; // Rootless only, unix:// or tcp://
+  tlsCertificates?: string; // Certificates stored by the backend for TCP+TLS
+  idleTimeout?: number; // Minutes, -1 never closes the connection
+  keepaliveInterval?: number; // Seconds
+  keepaliveCountMax?: number; // Missed keepalives before reconnecting
 }
 
+// How an environment is reached
+export type Transport = 'ssh' | 'tcp-tls';
+
+// Container engine running on the remote host
+export type ContainerEngine = 'docker' | 'podman' | 'nerdctl';
+
+// How the SSH user gets access to the Docker daemon
+export type PrivilegeMode = 'docker-group' | 'sudo' | 'sudo-password' | 'rootless';
+
+// Connection fields the backend needs to reach an environment
+export type ConnectionParams = Omit<Environment, 'id' | 'name'>;
+
+export const connectionParams = (env: Environment): ConnectionParams => ({
+  transport: env.transport,
+  hostname: env.hostname,
+  username: env.username,
+  port: env.port,
+  identityFile: env.identityFile,
+  connectTimeout: env.connectTimeout,
+  sshOptions: env.sshOptions,
+  jumpHosts: env.jumpHosts,
+  engine: env.engine,
+  privilegeMode: env.privilegeMode,
+  dockerHost: env.dockerHost,
+  tlsCertificates: env.tlsCertificates,
+  idleTimeout: env.idleTimeout,
+  keepaliveInterval: env.keepaliveInterval,
+  keepaliveCountMax: env.keepaliveCountMax,
+});
+
 // Settings interface
 export interface ExtensionSettings {
   environments: Environment[];
@@ -62,6 +123,41 @@ export interface ExtensionSettings {
   autoConnect?: boolean;
 }
 
+// Host key awaiting a trust decision, as returned by /tunnel/hostkey
+export interface PendingHostKey {
+  address: string;
+  keyType: string;
+  fingerprint: string;
+  seenAt: string;
+}
+
+// Identity file waiting for a passphrase, as returned by /tunnel/unlock
+export interface LockedIdentity {
+  identityFile: string;
+  fingerprint?: string;
+  seenAt: string;
+}
+
+// docker CLI context reaching an environment through a local port
+export interface DockerContext {
+  name: string;
+  host: string;
+  createCommand: string;
+  importCommand: string;
+}
+
+// Health of the SSH connection as tracked by the backend supervisor
+export type TunnelState = 'connecting' | 'ready' | 'degraded' | 'reconnecting' | 'failed';
+
+// Tunnel state transition pushed by the backend, one per line of `/service -events`
+interface TunnelEvent {
+  type: 'snapshot' | 'opened' | 'closed' | 'idle-reaped' | 'degraded' | 'recovered' | 'broken' | 'reconnected' | 'failed';
+  connection?: string;
+  state?: TunnelState;
+  error?: string;
+  tunnels?: { connection: string; state: TunnelState; lastError?: string }[];
+}
+
 // Create a type for pages
 type PageKey =
   | 'dashboard'
@@ -93,6 +189,7 @@ export function App() {
 
   // New state for SSH tunnel management
   const [isTunnelActive, setIsTunnelActive] = useState(false);
+  const [tunnelState, setTunnelState] = useState<TunnelState | undefined>(undefined);
   const [tunnelError, setTunnelError] = useState('');
   const [isTunnelLoading, setIsTunnelLoading] = useState(false);
   const visibilityRef = useRef(true);
@@ -100,6 +197,25 @@ export function App() {
   // New state for logs modal context
   const [isLogsOpen, setIsLogsOpen] = useState(false);
 
+  // Unknown host key the user has to accept or reject before connecting
+  const [pendingHostKey, setPendingHostKey] = useState<{ env: Environment; hostKey: PendingHostKey } | null>(null);
+
+  // Identity file whose passphrase is needed before connecting
+  const [pendingUnlock, setPendingUnlock] = useState<{ env: Environment; identity: LockedIdentity } | null>(null);
+  const [passphrase, setPassphrase] = useState('');
+
+  // Environment whose sudo password is needed to reach Docker
+  const [pendingSudo, setPendingSudo] = useState<Environment | null>(null);
+  const [sudoPassword, setSudoPassword] = useState('');
+
+  // Docker context for the CLI of this machine, reaching the active environment through the tunnel
+  const [dockerContext, setDockerContext] = useState<DockerContext | null>(null);
+
+  // Shell on the host of the environment: its options, then the open terminal
+  const [isHostTerminalSetup, setIsHostTerminalSetup] = useState(false);
+  const [hostTerminalOptions, setHostTerminalOptions] = useState({ idleTimeout: 0, transcript: false });
+  const [hostTerminalEnv, setHostTerminalEnv] = useState<Environment | null>(null);
+
   // Navigation items
   const navItems: NavItem[] = [
     { key: 'dashboard', label: 'Dashboard', icon: <DashboardIcon />, category: 'docker' },
@@ -218,6 +334,7 @@ export function App() {
   interface TunnelResponse {
     success?: string;
     error?: string;
+    sudoPasswordRequired?: boolean;
   }
 
   // SSH Tunnel management functions
@@ -227,19 +344,41 @@ export function App() {
     setIsTunnelLoading(true);
     try {
       setTunnelError('');
-      const response = await ddClient.extension.vm?.service?.post('/tunnel/open', {
-        hostname: env.hostname,
-        username: env.username
-      }) as TunnelResponse;
+      const response = await ddClient.extension.vm?.service?.post('/tunnel/open', connectionParams(env)) as TunnelResponse;
 
       if (response && response.success === "true") {
         setIsTunnelActive(true);
-        console.log(`SSH tunnel opened for ${env.username}@${env.hostname}`);
+        setTunnelState('ready');
+        console.log(`SSH tunnel opened for ${env.username}@${env.hostname}${env.port ? `:${env.port}` : ''}`);
+
+        // Docker is only reachable once the sudo password was given for this session
+        if (response.sudoPasswordRequired) {
+          setSudoPassword('');
+          setPendingSudo(env);
+        }
       } else {
         throw new Error((response && response.error) || 'Unknown error opening SSH tunnel');
       }
     } catch (err: any) {
       console.error('Failed to open SSH tunnel:', err);
+      setIsTunnelActive(false);
+      setTunnelState(undefined);
+
+      // An unknown host key is not an error yet, ask the user to verify it
+      const hostKey = await findPendingHostKey(env);
+      if (hostKey) {
+        setPendingHostKey({ env, hostKey });
+        return;
+      }
+
+      // Neither is a key protected by a passphrase, the user has to unlock it
+      const identity = await findLockedIdentity(env);
+      if (identity) {
+        setPassphrase('');
+        setPendingUnlock({ env, identity });
+        return;
+      }
+
       setTunnelError(`Failed to open SSH tunnel: ${err.message || 'Unknown error'}`);
       ddClient.desktopUI.toast.error('Failed to open SSH tunnel: ' + (err.message || 'Unknown error'));
       setIsTunnelActive(false);
@@ -248,42 +387,219 @@ export function App() {
     }
   };
 
+  // Address the backend records host keys under, in known_hosts notation
+  const hostKeyAddress = (host: { hostname: string; port?: number }): string =>
+    !host.port || host.port === 22 ? host.hostname : `[${host.hostname}]:${host.port}`;
+
+  const findPendingHostKey = async (env: Environment): Promise<PendingHostKey | undefined> => {
+    try {
+      const response = await ddClient.extension.vm?.service?.get('/tunnel/hostkey') as { pending?: PendingHostKey[] };
+      // Any host of the chain may be the unknown one
+      const addresses = [...(env.jumpHosts || []), env].map(hostKeyAddress);
+      const pending = response?.pending || [];
+      const match = pending.find(key => addresses.includes(key.address));
+      if (match) return match;
+
+      // ~/.ssh/config aliases resolve to other hostnames, so take a key seen by this attempt
+      const recent = pending.filter(key => Date.now() - new Date(key.seenAt).getTime() < 30000);
+      return recent.sort((a, b) => b.seenAt.localeCompare(a.seenAt))[0];
+    } catch (err: any) {
+      console.error('Failed to load pending host keys:', err);
+      return undefined;
+    }
+  };
+
+  const findLockedIdentity = async (env: Environment): Promise<LockedIdentity | undefined> => {
+    try {
+      const response = await ddClient.extension.vm?.service?.get('/tunnel/unlock') as { locked?: LockedIdentity[] };
+      const locked = response?.locked || [];
+      const identityFiles = [...(env.jumpHosts || []), env]
+        .map(host => host.identityFile)
+        .filter((identityFile): identityFile is string => !!identityFile);
+      const match = locked.find(identity => identityFiles.includes(identity.identityFile));
+      if (match) return match;
+
+      // Default identities are not named on the environment, so take one seen by this attempt
+      const recent = locked.filter(identity => Date.now() - new Date(identity.seenAt).getTime() < 30000);
+      return recent.sort((a, b) => b.seenAt.localeCompare(a.seenAt))[0];
+    } catch (err: any) {
+      console.error('Failed to load locked identities:', err);
+      return undefined;
+    }
+  };
+
+  const unlockIdentity = async () => {
+    if (!pendingUnlock) return;
+
+    const { env, identity } = pendingUnlock;
+    try {
+      await ddClient.extension.vm?.service?.post('/tunnel/unlock', {
+        identityFile: identity.identityFile,
+        passphrase
+      });
+    } catch (err: any) {
+      console.error('Failed to unlock identity:', err);
+      ddClient.desktopUI.toast.error('Failed to unlock identity: ' + (err.message || 'Unknown error'));
+      return;
+    } finally {
+      setPassphrase('');
+    }
+
+    setPendingUnlock(null);
+    await openTunnel(env);
+  };
+
+  const cancelUnlock = () => {
+    if (pendingUnlock) {
+      setTunnelError(`Identity ${pendingUnlock.identity.identityFile} needs a passphrase`);
+    }
+    setPassphrase('');
+    setPendingUnlock(null);
+  };
+
+  const submitSudoPassword = async () => {
+    if (!pendingSudo) return;
+
+    try {
+      await ddClient.extension.vm?.service?.post('/tunnel/sudo', {
+        ...connectionParams(pendingSudo),
+        password: sudoPassword
+      });
+    } catch (err: any) {
+      console.error('Failed to set sudo password:', err);
+      ddClient.desktopUI.toast.error('Failed to set sudo password: ' + (err.message || 'Unknown error'));
+      return;
+    } finally {
+      setSudoPassword('');
+    }
+
+    setPendingSudo(null);
+  };
+
+  const cancelSudoPassword = () => {
+    if (pendingSudo) {
+      setTunnelError(`Docker on ${pendingSudo.hostname} needs the sudo password`);
+    }
+    setSudoPassword('');
+    setPendingSudo(null);
+  };
+
+  const resolveHostKey = async (accept: boolean) => {
+    if (!pendingHostKey) return;
+
+    const { env, hostKey } = pendingHostKey;
+    setPendingHostKey(null);
+    try {
+      await ddClient.extension.vm?.service?.post(accept ? '/tunnel/hostkey/accept' : '/tunnel/hostkey/reject', {
+        address: hostKey.address,
+        fingerprint: hostKey.fingerprint
+      });
+    } catch (err: any) {
+      console.error('Failed to resolve host key:', err);
+      ddClient.desktopUI.toast.error('Failed to update host key: ' + (err.message || 'Unknown error'));
+      return;
+    }
+
+    if (accept) {
+      await openTunnel(env);
+    } else {
+      setTunnelError(`Host key for ${hostKey.address} was rejected`);
+    }
+  };
+
   const closeTunnel = async (env: Environment) => {
     if (!env) return;
 
     setIsTunnelLoading(true);
     try {
-      const response = await ddClient.extension.vm?.service?.post('/tunnel/close', {
-        hostname: env.hostname,
-        username: env.username
-      }) as TunnelResponse;
+      const response = await ddClient.extension.vm?.service?.post('/tunnel/close', connectionParams(env)) as TunnelResponse;
 
       if (response && response.success === "true") {
         setIsTunnelActive(false);
-        console.log(`SSH tunnel closed for ${env.username}@${env.hostname}`);
+        setTunnelState(undefined);
+        console.log(`SSH tunnel closed for ${env.username}@${env.hostname}${env.port ? `:${env.port}` : ''}`);
       }
     } catch (err: any) {
       console.error('Failed to close SSH tunnel:', err);
       // Even if we fail to close it cleanly, consider it closed from the UI perspective
       setIsTunnelActive(false);
+      setTunnelState(undefined);
     } finally {
       setIsTunnelLoading(false);
     }
   };
 
+  // Forward a local port to Docker on the environment and show how to point the docker CLI at it
+  const openDockerEndpoint = async (env: Environment) => {
+    try {
+      const response = await ddClient.extension.vm?.service?.post('/forwards/docker', {
+        ...connectionParams(env),
+        contextName: 'remote-' + env.name.toLowerCase().replace(/[^a-z0-9_.+-]/g, '-'),
+      });
+
+      if (response && typeof response === 'object' && 'error' in response) {
+        throw new Error((response as { error: string }).error);
+      }
+      setDockerContext((response as { context: DockerContext }).context);
+    } catch (err: any) {
+      console.error('Failed to open Docker endpoint:', err);
+      ddClient.desktopUI.toast.error('Failed to open Docker endpoint: ' + (err.message || 'Unknown error'));
+    }
+  };
+
+  // Ask the backend for a login shell on the host, which the terminal then connects to
+  const createHostTerminalSession = async (env: Environment, size: TerminalSize): Promise<TerminalSession> => {
+    if (!ddClient.extension?.vm?.service) {
+      throw new Error('Docker Desktop service is not available');
+    }
+    const response = await ddClient.extension.vm.service.post('/host/terminal', {
+      ...connectionParams(env),
+      idleTimeout: hostTerminalOptions.idleTimeout,
+      transcript: hostTerminalOptions.transcript,
+      ...size,
+    }) as TerminalSession & { transcript?: string; error?: string };
+    if (response && response.error) {
+      throw new Error(response.error);
+    }
+    if (response.transcript) {
+      ddClient.desktopUI.toast.success('Recording to ' + response.transcript);
+    }
+    return response;
+  };
+
+  const openHostTerminal = () => {
+    setHostTerminalEnv(getActiveEnvironment() || null);
+    setIsHostTerminalSetup(false);
+  };
+
+  const copyCommand = async (command: string) => {
+    await navigator.clipboard.writeText(command);
+    ddClient.desktopUI.toast.success('Command copied to the clipboard');
+  };
+
   interface TunnelStatusResponse {
     active: string | boolean;
+    state?: TunnelState;
+    error?: string;
+    tls?: { certificateExpiry?: string }; // TCP+TLS only
   }
 
   const checkTunnelStatus = async (env: Environment) => {
     if (!env) return;
 
     try {
-      const response = await ddClient.extension.vm?.service?.get(`/tunnel/status?username=${env.username}&hostname=${env.hostname}`);
+      const response = await ddClient.extension.vm?.service?.post('/tunnel/status', connectionParams(env));
 
       if (response && typeof response === 'object') {
         const typedResponse = response as TunnelStatusResponse;
         setIsTunnelActive(typedResponse.active === true);
+        setTunnelState(typedResponse.state);
+        if (typedResponse.state === 'failed' && typedResponse.error) {
+          setTunnelError(typedResponse.error);
+        }
+        if (typedResponse.tls?.certificateExpiry) {
+          console.warn(`TLS certificate of ${env.name} is about to expire: ${typedResponse.tls.certificateExpiry}`);
+        }
       }
     } catch (err: any) {
       console.error('Failed to check SSH tunnel status:', err);
@@ -334,6 +650,68 @@ export function App() {
     setActiveEnvironment(envId === "none" ? undefined : envId);
   };
 
+  // Connection keys of the backend start with user@host:port, or tcp-tls://host:port, followed by any other parameters
+  const isTunnelFor = (env: Environment, connection?: string): boolean => {
+    const base = env.transport === 'tcp-tls'
+      ? `tcp-tls://${env.hostname}:${env.port || 2376}`
+      : `${env.username}@${env.hostname}:${env.port || 22}`;
+    return !!connection && (connection === base || connection.startsWith(`${base}?`));
+  };
+
+  const applyTunnelState = (state?: TunnelState, error?: string) => {
+    setTunnelState(state);
+    setIsTunnelActive(state === 'ready' || state === 'degraded');
+    if (state === 'failed' && error) {
+      setTunnelError(error);
+    }
+  };
+
+  const handleTunnelEvent = (env: Environment, event: TunnelEvent) => {
+    if (event.type === 'snapshot') {
+      const tunnel = event.tunnels?.find(t => isTunnelFor(env, t.connection));
+      applyTunnelState(tunnel?.state, tunnel?.lastError);
+      return;
+    }
+    if (!isTunnelFor(env, event.connection)) return;
+
+    console.log(`Tunnel ${event.type}: ${event.connection}`);
+    if (event.type === 'closed' || event.type === 'idle-reaped') {
+      applyTunnelState(undefined);
+      return;
+    }
+    applyTunnelState(event.state, event.error);
+  };
+
+  // Follow tunnel state changes as the backend pushes them instead of polling for them
+  useEffect(() => {
+    const env = getActiveEnvironment();
+    if (!env) return;
+
+    const events = ddClient.extension.vm?.cli.exec('/service', ['-events'], {
+      stream: {
+        onOutput(data) {
+          if (!data.stdout) return;
+          try {
+            handleTunnelEvent(env, JSON.parse(data.stdout) as TunnelEvent);
+          } catch (err: any) {
+            console.error('Invalid tunnel event:', data.stdout, err);
+          }
+        },
+        onError(error) {
+          console.error('Tunnel event stream failed:', error);
+        },
+        onClose(exitCode) {
+          console.log(`Tunnel event stream closed with exit code ${exitCode}`);
+        },
+        splitOutputLines: true,
+      },
+    });
+
+    return () => {
+      events?.close();
+    };
+  }, [settings.activeEnvironmentId, settings.environments]);
+
   // Add cleanup on unmount
   useEffect(() => {
     return () => {
@@ -345,6 +723,25 @@ export function App() {
     };
   }, []);
 
+  // The supervisor may be bringing the connection back while it looks down
+  const tunnelIndicatorColor = (): string => {
+    if (tunnelState === 'degraded' || tunnelState === 'reconnecting') return 'warning.main';
+    return isTunnelActive ? 'success.main' : 'error.main';
+  };
+
+  const tunnelIndicatorLabel = (): string => {
+    switch (tunnelState) {
+      case 'degraded':
+        return 'SSH Degraded';
+      case 'reconnecting':
+        return 'SSH Reconnecting...';
+      case 'failed':
+        return 'SSH Failed';
+      default:
+        return isTunnelActive ? 'SSH Connected' : 'SSH Disconnected';
+    }
+  };
+
   // Render current page
   const renderPage = () => {
     const activeEnvironment = getActiveEnvironment();
@@ -470,7 +867,7 @@ export function App() {
               alignItems: 'center',
               mr: 2,
               typography: 'body2',
-              color: isTunnelActive ? 'success.main' : 'error.main',
+              color: tunnelIndicatorColor(),
               fontSize: '0.75rem',
               whiteSpace: 'nowrap'
             }}>
@@ -481,11 +878,11 @@ export function App() {
                   width: 8,
                   height: 8,
                   borderRadius: '50%',
-                  bgcolor: isTunnelActive ? 'success.main' : 'error.main',
+                  bgcolor: tunnelIndicatorColor(),
                   mr: 1
                 }}
               />
-              {isTunnelActive ? 'SSH Connected' : 'SSH Disconnected'}
+              {tunnelIndicatorLabel()}
               {isTunnelActive && (
                 <Button
                   size="small"
@@ -501,6 +898,33 @@ export function App() {
                   {isTunnelLoading ? 'Disconnecting...' : 'Disconnect'}
                 </Button>
               )}
+              {isTunnelActive && (getActiveEnvironment()?.engine || 'docker') === 'docker' && (
+                <Button
+                  size="small"
+                  color="primary"
+                  variant="text"
+                  onClick={() => {
+                    const env = getActiveEnvironment();
+                    if (env) openDockerEndpoint(env);
+                  }}
+                  disabled={isTunnelLoading || isLogsOpen}
+                  sx={{ ml: 1, py: 0, minWidth: 'auto' }}
+                >
+                  Docker CLI
+                </Button>
+              )}
+              {isTunnelActive && (getActiveEnvironment()?.transport || 'ssh') === 'ssh' && (
+                <Button
+                  size="small"
+                  color="primary"
+                  variant="text"
+                  onClick={() => setIsHostTerminalSetup(true)}
+                  disabled={isTunnelLoading || isLogsOpen}
+                  sx={{ ml: 1, py: 0, minWidth: 'auto' }}
+                >
+                  Host Terminal
+                </Button>
+              )}
               {!isTunnelActive && (
                 <Button
                   size="small"
@@ -683,6 +1107,183 @@ export function App() {
         {/* Render the current page */}
         {renderPage()}
       </Box>
+
+      {/* Host key verification */}
+      <ConfirmationDialog
+        open={!!pendingHostKey}
+        title="Unknown Host Key"
+        message={pendingHostKey
+          ? `The authenticity of host ${pendingHostKey.hostKey.address} can't be established. Verify that its ${pendingHostKey.hostKey.keyType} key fingerprint below is correct before trusting it.`
+          : ''}
+        resourceName={pendingHostKey?.hostKey.fingerprint}
+        confirmText="Trust and Connect"
+        cancelText="Reject"
+        confirmColor="warning"
+        onConfirm={() => resolveHostKey(true)}
+        onCancel={() => resolveHostKey(false)}
+      />
+
+      {/* Passphrase for a locked identity */}
+      <Dialog open={!!pendingUnlock} onClose={cancelUnlock}>
+        <DialogTitle>Passphrase Required</DialogTitle>
+        <DialogContent>
+          <DialogContentText sx={{ mb: 2 }}>
+            {pendingUnlock
+              ? `Enter the passphrase for ~/.ssh/${pendingUnlock.identity.identityFile}. The decrypted key is kept in memory until all connections are closed; the passphrase is not stored.`
+              : ''}
+          </DialogContentText>
+          <TextField
+            label="Passphrase"
+            type="password"
+            fullWidth
+            autoFocus
+            value={passphrase}
+            onChange={(e) => setPassphrase(e.target.value)}
+            onKeyDown={(e) => {
+              if (e.key === 'Enter' && passphrase) unlockIdentity();
+            }}
+            helperText={pendingUnlock?.identity.fingerprint}
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={cancelUnlock} variant="outlined">
+            Cancel
+          </Button>
+          <Button onClick={unlockIdentity} variant="contained" disabled={!passphrase}>
+            Unlock and Connect
+          </Button>
+        </DialogActions>
+      </Dialog>
+
+      {/* Docker context for the local CLI */}
+      <Dialog open={!!dockerContext} onClose={() => setDockerContext(null)} maxWidth="md" fullWidth>
+        <DialogTitle>Use from the Docker CLI</DialogTitle>
+        <DialogContent>
+          <DialogContentText sx={{ mb: 2 }}>
+            {dockerContext
+              ? `Docker on this environment listens on ${dockerContext.host} while the connection is open. Create the context once, then run commands like docker --context ${dockerContext.name} ps.`
+              : ''}
+          </DialogContentText>
+          <Alert severity="warning" sx={{ mb: 2 }}>
+            The endpoint has no authentication. While it is open, any process or user on this machine can use it,
+            and access to Docker amounts to root on the remote host. Disconnecting the environment closes it.
+          </Alert>
+          {dockerContext && [
+            { label: 'Create the context', command: dockerContext.createCommand },
+            { label: 'Or import it', command: dockerContext.importCommand },
+          ].map(({ label, command }) => (
+            <TextField
+              key={label}
+              label={label}
+              value={command}
+              fullWidth
+              multiline
+              maxRows={4}
+              InputProps={{ readOnly: true, sx: { fontFamily: 'monospace', fontSize: '0.8rem' } }}
+              onClick={() => copyCommand(command)}
+              helperText="Click to copy"
+              sx={{ mb: 2 }}
+            />
+          ))}
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={() => setDockerContext(null)} variant="outlined">
+            Close
+          </Button>
+        </DialogActions>
+      </Dialog>
+
+      {/* Options of a shell on the host */}
+      <Dialog open={isHostTerminalSetup} onClose={() => setIsHostTerminalSetup(false)} maxWidth="xs" fullWidth>
+        <DialogTitle>Open Host Terminal</DialogTitle>
+        <DialogContent>
+          <TextField
+            select
+            margin="dense"
+            label="Close when idle for"
+            fullWidth
+            value={hostTerminalOptions.idleTimeout}
+            onChange={(e) => setHostTerminalOptions({ ...hostTerminalOptions, idleTimeout: Number(e.target.value) })}
+            helperText="Without input or output"
+          >
+            <MenuItem value={0}>30 minutes (default)</MenuItem>
+            <MenuItem value={15}>15 minutes</MenuItem>
+            <MenuItem value={60}>1 hour</MenuItem>
+            <MenuItem value={240}>4 hours</MenuItem>
+            <MenuItem value={-1}>Never</MenuItem>
+          </TextField>
+          <FormControlLabel
+            control={
+              <Switch
+                checked={hostTerminalOptions.transcript}
+                onChange={(e) => setHostTerminalOptions({ ...hostTerminalOptions, transcript: e.target.checked })}
+              />
+            }
+            label="Record a transcript in the extension's data volume"
+            sx={{ mt: 1 }}
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={() => setIsHostTerminalSetup(false)}>Cancel</Button>
+          <Button onClick={openHostTerminal} variant="contained">
+            Open
+          </Button>
+        </DialogActions>
+      </Dialog>
+
+      {/* Shell on the host */}
+      <Drawer
+        anchor="bottom"
+        open={!!hostTerminalEnv}
+        onClose={() => setHostTerminalEnv(null)}
+        sx={{
+          '& .MuiDrawer-paper': {
+            height: '70%',
+            boxShadow: 3,
+            borderTopLeftRadius: 8,
+            borderTopRightRadius: 8,
+          },
+        }}
+      >
+        {hostTerminalEnv && (
+          <Terminal
+            title={`${hostTerminalEnv.username}@${hostTerminalEnv.hostname}`}
+            createSession={(size) => createHostTerminalSession(hostTerminalEnv, size)}
+            onClose={() => setHostTerminalEnv(null)}
+          />
+        )}
+      </Drawer>
+
+      {/* Sudo password for Docker access */}
+      <Dialog open={!!pendingSudo} onClose={cancelSudoPassword}>
+        <DialogTitle>Sudo Password Required</DialogTitle>
+        <DialogContent>
+          <DialogContentText sx={{ mb: 2 }}>
+            {pendingSudo
+              ? `Enter the sudo password of ${pendingSudo.username}@${pendingSudo.hostname} to access Docker. It is kept in memory until the connection is closed and is not stored.`
+              : ''}
+          </DialogContentText>
+          <TextField
+            label="Sudo Password"
+            type="password"
+            fullWidth
+            autoFocus
+            value={sudoPassword}
+            onChange={(e) => setSudoPassword(e.target.value)}
+            onKeyDown={(e) => {
+              if (e.key === 'Enter' && sudoPassword) submitSudoPassword();
+            }}
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={cancelSudoPassword} variant="outlined">
+            Cancel
+          </Button>
+          <Button onClick={submitSudoPassword} variant="contained" disabled={!sudoPassword}>
+            Continue
+          </Button>
+        </DialogActions>
+      </Dialog>
     </Box>
   );
 }
\ No newline at end of file
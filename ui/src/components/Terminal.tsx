@@ -0,0 +1,320 @@
+import React, { useState, useEffect, useRef } from 'react';
+import {
+  Alert,
+  Box,
+  Button,
+  Chip,
+  IconButton,
+  Tooltip,
+  Typography,
+} from '@mui/material';
+import CloseIcon from '@mui/icons-material/Close';
+
+// Where the backend serves the WebSocket of a terminal; the token lets it in once
+export interface TerminalSession {
+  token: string;
+  port: number; // Published on localhost
+  path: string;
+}
+
+export interface TerminalSize {
+  cols: number;
+  rows: number;
+}
+
+// Control messages are text frames, terminal data goes both ways as binary frames
+interface TerminalMessage {
+  type: 'resize' | 'exit' | 'idle' | 'error';
+  cols?: number;
+  rows?: number;
+  exitCode?: number;
+  message?: string;
+}
+
+interface TerminalProps {
+  title: string;
+  // Asks the backend for a session of the given size
+  createSession: (size: TerminalSize) => Promise<TerminalSession>;
+  onClose: () => void;
+}
+
+// Subprotocol the backend answers terminal WebSockets with
+const TERMINAL_PROTOCOL = 'remote-docker.terminal';
+
+// Lines kept for scrolling back
+const MAX_LINES = 5000;
+
+// Escape sequences the view does not render: CSI, OSC and two-character escapes
+// eslint-disable-next-line no-control-regex
+const ESCAPE_SEQUENCE = /\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]/g;
+
+// What a key sends to the terminal, as xterm does
+const keyInput = (event: React.KeyboardEvent): string | null => {
+  if (event.ctrlKey && !event.altKey && event.key.length === 1) {
+    const code = event.key.toUpperCase().charCodeAt(0);
+    if (code >= 64 && code <= 95) {
+      return String.fromCharCode(code - 64);
+    }
+  }
+  switch (event.key) {
+    case 'Enter': return '\r';
+    case 'Backspace': return '\x7f';
+    case 'Tab': return '\t';
+    case 'Escape': return '\x1b';
+    case 'ArrowUp': return '\x1b[A';
+    case 'ArrowDown': return '\x1b[B';
+    case 'ArrowRight': return '\x1b[C';
+    case 'ArrowLeft': return '\x1b[D';
+    case 'Home': return '\x1b[H';
+    case 'End': return '\x1b[F';
+    case 'Delete': return '\x1b[3~';
+    case 'PageUp': return '\x1b[5~';
+    case 'PageDown': return '\x1b[6~';
+  }
+  if (event.key.length === 1 && !event.metaKey) {
+    return event.altKey ? '\x1b' + event.key : event.key;
+  }
+  return null;
+};
+
+/**
+ * A line-oriented terminal: output is shown with escape sequences left out, carriage
+ * returns and backspaces applied, which is enough for shells but not for full-screen programs.
+ */
+const Terminal: React.FC<TerminalProps> = ({ title, createSession, onClose }) => {
+  const [lines, setLines] = useState<string[]>(['']);
+  const [state, setState] = useState<'connecting' | 'open' | 'closed'>('connecting');
+  const [error, setError] = useState('');
+  const [exitCode, setExitCode] = useState<number | null>(null);
+  const [notice, setNotice] = useState('');
+
+  const socketRef = useRef<WebSocket | null>(null);
+  const screenRef = useRef<HTMLDivElement | null>(null);
+  const measureRef = useRef<HTMLSpanElement | null>(null);
+  // Column of the cursor on the last line
+  const cursorRef = useRef(0);
+  const decoderRef = useRef(new TextDecoder());
+
+  // Characters that fit the screen, measured on a single character
+  const measure = (): TerminalSize => {
+    const screen = screenRef.current;
+    const glyph = measureRef.current?.getBoundingClientRect();
+    if (!screen || !glyph || glyph.width === 0 || glyph.height === 0) {
+      return { cols: 80, rows: 24 };
+    }
+    return {
+      cols: Math.max(20, Math.min(1000, Math.floor((screen.clientWidth - 16) / glyph.width))),
+      rows: Math.max(5, Math.min(1000, Math.floor((screen.clientHeight - 16) / glyph.height))),
+    };
+  };
+
+  const write = (text: string) => {
+    const output = text.replace(ESCAPE_SEQUENCE, '');
+    setLines((old) => {
+      const next = old.slice();
+      let line = next.pop() || '';
+      let cursor = cursorRef.current;
+      for (const ch of output) {
+        if (ch === '\n') {
+          next.push(line);
+          line = '';
+          cursor = 0;
+        } else if (ch === '\r') {
+          cursor = 0;
+        } else if (ch === '\b') {
+          cursor = Math.max(0, cursor - 1);
+        } else if (ch >= ' ' || ch === '\t') {
+          line = line.slice(0, cursor) + ch + line.slice(cursor + 1);
+          cursor++;
+        }
+      }
+      cursorRef.current = cursor;
+      next.push(line);
+      return next.length > MAX_LINES ? next.slice(next.length - MAX_LINES) : next;
+    });
+  };
+
+  const send = (data: string) => {
+    const socket = socketRef.current;
+    if (socket && socket.readyState === WebSocket.OPEN) {
+      socket.send(new TextEncoder().encode(data));
+    }
+  };
+
+  const connect = async () => {
+    setState('connecting');
+    setError('');
+    setExitCode(null);
+    setNotice('');
+    setLines(['']);
+    cursorRef.current = 0;
+    decoderRef.current = new TextDecoder();
+
+    let session: TerminalSession;
+    try {
+      session = await createSession(measure());
+    } catch (err: any) {
+      setError(err.message || 'Failed to open terminal');
+      setState('closed');
+      return;
+    }
+
+    // The token goes in a subprotocol, not the URL, which the backend's request log records
+    const socket = new WebSocket(`ws://localhost:${session.port}${session.path}`, [TERMINAL_PROTOCOL, `token.${session.token}`]);
+    socket.binaryType = 'arraybuffer';
+    socketRef.current = socket;
+
+    socket.onopen = () => {
+      setState('open');
+      screenRef.current?.focus();
+    };
+    socket.onmessage = (event) => {
+      if (typeof event.data !== 'string') {
+        write(decoderRef.current.decode(new Uint8Array(event.data), { stream: true }));
+        return;
+      }
+      const message = JSON.parse(event.data) as TerminalMessage;
+      if (message.type === 'exit') {
+        setExitCode(message.exitCode ?? null);
+      } else if (message.type === 'idle') {
+        setNotice(message.message || 'Closed for being idle');
+      } else if (message.type === 'error') {
+        setError(message.message || 'Terminal failed');
+      }
+    };
+    socket.onerror = () => {
+      setError('Lost the connection to the terminal');
+    };
+    socket.onclose = () => {
+      setState('closed');
+    };
+  };
+
+  useEffect(() => {
+    connect();
+    return () => {
+      socketRef.current?.close();
+    };
+  }, []);
+
+  // Follow the size of the screen
+  useEffect(() => {
+    const screen = screenRef.current;
+    if (!screen) {
+      return;
+    }
+    let last = '';
+    const observer = new ResizeObserver(() => {
+      const size = measure();
+      const key = `${size.cols}x${size.rows}`;
+      const socket = socketRef.current;
+      if (key !== last && socket && socket.readyState === WebSocket.OPEN) {
+        last = key;
+        socket.send(JSON.stringify({ type: 'resize', ...size } as TerminalMessage));
+      }
+    });
+    observer.observe(screen);
+    return () => observer.disconnect();
+  }, [state]);
+
+  // Keep the newest output in view
+  useEffect(() => {
+    const screen = screenRef.current;
+    if (screen) {
+      screen.scrollTop = screen.scrollHeight;
+    }
+  }, [lines]);
+
+  const handleKeyDown = (event: React.KeyboardEvent) => {
+    // Copying a selection is left to the browser
+    if ((event.ctrlKey || event.metaKey) && event.key === 'c' && window.getSelection()?.toString()) {
+      return;
+    }
+    if (event.metaKey && event.key === 'v') {
+      return;
+    }
+    const input = keyInput(event);
+    if (input !== null) {
+      event.preventDefault();
+      send(input);
+    }
+  };
+
+  const handlePaste = (event: React.ClipboardEvent) => {
+    event.preventDefault();
+    send(event.clipboardData.getData('text'));
+  };
+
+  return (
+    <Box sx={{ display: 'flex', flexDirection: 'column', height: '100%' }}>
+      <Box
+        sx={{
+          display: 'flex',
+          justifyContent: 'space-between',
+          alignItems: 'center',
+          p: 1,
+          borderBottom: 1,
+          borderColor: 'divider',
+        }}
+      >
+        <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+          <Typography sx={{ fontSize: '1rem' }}>{title}</Typography>
+          <Chip
+            label={state === 'closed' && exitCode !== null ? `Exited (${exitCode})` : state}
+            color={state === 'open' ? 'success' : state === 'connecting' ? 'warning' : 'default'}
+            size="small"
+            variant="outlined"
+          />
+        </Box>
+        <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+          {state === 'closed' && (
+            <Button size="small" onClick={connect}>Reconnect</Button>
+          )}
+          <Tooltip title="Close terminal">
+            <IconButton onClick={onClose} edge="end" size="small">
+              <CloseIcon fontSize="small" />
+            </IconButton>
+          </Tooltip>
+        </Box>
+      </Box>
+
+      {error && (
+        <Alert severity="error" sx={{ m: 1 }}>
+          {error}
+        </Alert>
+      )}
+      {notice && (
+        <Alert severity="info" sx={{ m: 1 }}>
+          {notice}
+        </Alert>
+      )}
+
+      <Box
+        ref={screenRef}
+        tabIndex={0}
+        onKeyDown={handleKeyDown}
+        onPaste={handlePaste}
+        sx={{
+          flex: 1,
+          overflow: 'auto',
+          p: 1,
+          bgcolor: '#1e1e1e',
+          color: '#d4d4d4',
+          fontFamily: 'monospace',
+          fontSize: '0.85rem',
+          lineHeight: 1.4,
+          whiteSpace: 'pre-wrap',
+          wordBreak: 'break-all',
+          outline: 'none',
+          cursor: 'text',
+        }}
+      >
+        <span ref={measureRef} style={{ position: 'absolute', visibility: 'hidden' }}>W</span>
+        {lines.join('\n')}
+        {state === 'open' && <span style={{ backgroundColor: '#d4d4d4' }}>&nbsp;</span>}
+      </Box>
+    </Box>
+  );
+};
+
+export default Terminal;
@@ -46,7 +46,7 @@ import InfoIcon from '@mui/icons-material/Info';
 import DeveloperBoardIcon from '@mui/icons-material/DeveloperBoard';
 import AppsIcon from '@mui/icons-material/Apps';
 
-import { Environment, ExtensionSettings } from '../App';
+import { ConnectionParams, connectionParams, Environment, ExtensionSettings } from '../App';
 import AutoRefreshControls from '../components/AutoRefreshControls';
 
 // Type definitions for the dashboard API responses
@@ -124,10 +124,7 @@ interface EventsResponse {
   events: DockerEvent[];
 }
 
-interface DashboardRequest {
-  hostname: string;
-  username: string;
-}
+type DashboardRequest = ConnectionParams;
 
 interface DashboardProps {
   activeEnvironment?: Environment;
@@ -268,8 +265,7 @@ const Dashboard: React.FC<DashboardProps> = ({
 
       // Prepare request payload
       const requestPayload: DashboardRequest = {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
+        ...connectionParams(activeEnvironment),
       };
 
       // Load overview data
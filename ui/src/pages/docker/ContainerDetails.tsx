@@ -0,0 +1,410 @@
+import React, { useState, useEffect } from 'react';
+import { createDockerDesktopClient } from '@docker/extension-api-client';
+import {
+  Alert,
+  Box,
+  Chip,
+  CircularProgress,
+  FormControlLabel,
+  IconButton,
+  Switch,
+  Table,
+  TableBody,
+  TableCell,
+  TableHead,
+  TableRow,
+  Tooltip,
+  Typography,
+} from '@mui/material';
+import CloseIcon from '@mui/icons-material/Close';
+import RefreshIcon from '@mui/icons-material/Refresh';
+import { connectionParams, Environment } from '../../App';
+
+// Configuration and state of a container, as /container/inspect returns it
+export interface ContainerInspection {
+  id: string;
+  name: string;
+  image: string;
+  imageId: string;
+  created: string;
+  hostname: string;
+  user: string;
+  workingDir: string;
+  entrypoint: string[] | null;
+  command: string[] | null;
+  tty: boolean;
+  privileged: boolean;
+  state: {
+    status: string;
+    running: boolean;
+    paused: boolean;
+    restarting: boolean;
+    oomKilled: boolean;
+    dead: boolean;
+    pid: number;
+    exitCode: number;
+    error: string;
+    startedAt: string;
+    finishedAt: string;
+    health: {
+      status: string;
+      failingStreak: number;
+      log: { start: string; end: string; exitCode: number; output: string }[];
+    } | null;
+  };
+  restartPolicy: { name: string; maximumRetryCount: number };
+  restartCount: number;
+  env: { name: string; value: string; masked: boolean }[];
+  labels: Record<string, string>;
+  mounts: { type: string; name: string; source: string; destination: string; mode: string; readOnly: boolean }[];
+  networkMode: string;
+  networks: { name: string; ipAddress: string; gateway: string; macAddress: string; aliases: string[] | null }[];
+  ports: { containerPort: number; protocol: string; hostIp?: string; hostPort?: number }[];
+  resources: {
+    cpus: number;
+    cpuShares: number;
+    cpuSet: string;
+    memory: number;
+    memoryReservation: number;
+    memorySwap: number;
+    pidsLimit: number;
+  };
+}
+
+interface ContainerInspectResponse {
+  success?: string;
+  container: ContainerInspection;
+  error?: string;
+}
+
+interface ContainerDetailsProps {
+  activeEnvironment?: Environment;
+  containerId: string;
+  containerName: string;
+  onClose: () => void;
+}
+
+const client = createDockerDesktopClient();
+
+function useDockerDesktopClient() {
+  return client;
+}
+
+const formatBytes = (bytes: number): string => {
+  const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+  let i = 0;
+  let formattedSize = bytes;
+
+  while (formattedSize >= 1024 && i < units.length - 1) {
+    formattedSize /= 1024;
+    i++;
+  }
+
+  return `${formattedSize.toFixed(2)} ${units[i]}`;
+};
+
+// Zero means no limit for every resource
+const formatLimit = (value: number, format: (value: number) => string = String): string =>
+  value > 0 ? format(value) : 'Unlimited';
+
+// Engines report times that never happened as the zero time
+const formatTime = (time: string): string =>
+  !time || time.startsWith('0001-01-01') ? '-' : new Date(time).toLocaleString();
+
+const healthColor = (status: string): 'success' | 'warning' | 'error' | 'default' => {
+  switch (status) {
+    case 'healthy':
+      return 'success';
+    case 'starting':
+      return 'warning';
+    case 'unhealthy':
+      return 'error';
+    default:
+      return 'default';
+  }
+};
+
+const ContainerDetails: React.FC<ContainerDetailsProps> = ({
+                                                             activeEnvironment,
+                                                             containerId,
+                                                             containerName,
+                                                             onClose,
+                                                           }) => {
+  const ddClient = useDockerDesktopClient();
+
+  const [container, setContainer] = useState<ContainerInspection | null>(null);
+  const [error, setError] = useState('');
+  const [isLoading, setIsLoading] = useState(true);
+  // Env values that look like secrets are masked unless asked for
+  const [revealSecrets, setRevealSecrets] = useState(false);
+
+  useEffect(() => {
+    fetchDetails();
+  }, [activeEnvironment, containerId, revealSecrets]);
+
+  const fetchDetails = async () => {
+    if (!activeEnvironment) {
+      setError('No environment selected');
+      setIsLoading(false);
+      return;
+    }
+
+    setIsLoading(true);
+    try {
+      if (!ddClient.extension?.vm?.service) {
+        throw new Error('Docker Desktop service not available');
+      }
+
+      const response = await ddClient.extension.vm.service.post('/container/inspect', {
+        ...connectionParams(activeEnvironment),
+        containerId,
+        revealSecrets,
+      }) as ContainerInspectResponse;
+
+      if (response && typeof response === 'object' && 'error' in response) {
+        throw new Error(response.error);
+      }
+
+      setContainer(response.container);
+      setError('');
+    } catch (err: any) {
+      console.error('Failed to inspect container:', err);
+      setError(err.message || 'Failed to inspect container');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const renderSection = (title: string, content: React.ReactNode) => (
+    <Box sx={{ mb: 3 }}>
+      <Typography variant="subtitle1" sx={{ fontWeight: 'bold', mb: 1 }}>
+        {title}
+      </Typography>
+      {content}
+    </Box>
+  );
+
+  // Two columns of names and values
+  const renderFields = (fields: [string, React.ReactNode][]) => (
+    <Table size="small">
+      <TableBody>
+        {fields.map(([name, value]) => (
+          <TableRow key={name}>
+            <TableCell width="30%" sx={{ color: 'text.secondary' }}>{name}</TableCell>
+            <TableCell sx={{ wordBreak: 'break-all' }}>{value}</TableCell>
+          </TableRow>
+        ))}
+      </TableBody>
+    </Table>
+  );
+
+  const renderEmpty = (message: string) => (
+    <Typography variant="body2" color="text.secondary">{message}</Typography>
+  );
+
+  const renderDetails = (c: ContainerInspection) => {
+    const health = c.state.health;
+    const restartPolicy = c.restartPolicy.name === 'on-failure' && c.restartPolicy.maximumRetryCount > 0
+      ? `on-failure (at most ${c.restartPolicy.maximumRetryCount} times)`
+      : c.restartPolicy.name;
+
+    return (
+      <>
+        {renderSection('State', renderFields([
+          ['Status', <Chip label={c.state.status} size="small" variant="outlined" />],
+          ['Health', health
+            ? <Chip label={`${health.status}${health.failingStreak > 0 ? ` (${health.failingStreak} failing)` : ''}`} color={healthColor(health.status)} size="small" />
+            : 'No health check'],
+          ['Exit code', c.state.running ? '-' : String(c.state.exitCode)],
+          ['Killed for lack of memory', c.state.oomKilled ? <Chip label="OOMKilled" color="error" size="small" /> : 'No'],
+          ['Restart count', String(c.restartCount)],
+          ['Restart policy', restartPolicy],
+          ['Started', formatTime(c.state.startedAt)],
+          ['Finished', c.state.running ? '-' : formatTime(c.state.finishedAt)],
+          ...(c.state.error ? [['Error', c.state.error] as [string, React.ReactNode]] : []),
+        ]))}
+
+        {health && health.log.length > 0 && renderSection('Health checks', (
+          <Table size="small">
+            <TableHead>
+              <TableRow>
+                <TableCell>Started</TableCell>
+                <TableCell>Exit code</TableCell>
+                <TableCell>Output</TableCell>
+              </TableRow>
+            </TableHead>
+            <TableBody>
+              {health.log.map((probe, index) => (
+                <TableRow key={index}>
+                  <TableCell>{formatTime(probe.start)}</TableCell>
+                  <TableCell>{probe.exitCode}</TableCell>
+                  <TableCell sx={{ fontFamily: 'monospace', whiteSpace: 'pre-wrap' }}>{probe.output.trim()}</TableCell>
+                </TableRow>
+              ))}
+            </TableBody>
+          </Table>
+        ))}
+
+        {renderSection('Configuration', renderFields([
+          ['Image', c.image],
+          ['Image ID', <span style={{ fontFamily: 'monospace' }}>{c.imageId}</span>],
+          ['Created', formatTime(c.created)],
+          ['Entrypoint', <span style={{ fontFamily: 'monospace' }}>{(c.entrypoint || []).join(' ') || '-'}</span>],
+          ['Command', <span style={{ fontFamily: 'monospace' }}>{(c.command || []).join(' ') || '-'}</span>],
+          ['Working directory', c.workingDir || '-'],
+          ['User', c.user || '-'],
+          ['Hostname', c.hostname || '-'],
+          ['Privileged', c.privileged ? 'Yes' : 'No'],
+        ]))}
+
+        {renderSection('Resource limits', renderFields([
+          ['CPUs', formatLimit(c.resources.cpus, (cpus) => cpus.toFixed(2))],
+          ['CPU shares', c.resources.cpuShares > 0 ? String(c.resources.cpuShares) : 'Default'],
+          ['CPU set', c.resources.cpuSet || 'Any'],
+          ['Memory', formatLimit(c.resources.memory, formatBytes)],
+          ['Memory reservation', formatLimit(c.resources.memoryReservation, formatBytes)],
+          ['Memory and swap', formatLimit(c.resources.memorySwap, formatBytes)],
+          ['Processes', formatLimit(c.resources.pidsLimit)],
+        ]))}
+
+        {renderSection('Environment', (
+          <>
+            <FormControlLabel
+              control={
+                <Switch
+                  checked={revealSecrets}
+                  onChange={(e) => setRevealSecrets(e.target.checked)}
+                  size="small"
+                />
+              }
+              label="Reveal secrets"
+              sx={{ mb: 1 }}
+            />
+            {c.env.length === 0 ? renderEmpty('No environment variables') : (
+              <Table size="small">
+                <TableBody>
+                  {c.env.map((variable, index) => (
+                    <TableRow key={index}>
+                      <TableCell width="30%" sx={{ fontFamily: 'monospace' }}>{variable.name}</TableCell>
+                      <TableCell sx={{ fontFamily: 'monospace', wordBreak: 'break-all' }}>
+                        {variable.value}
+                        {variable.masked && <Chip label="masked" size="small" sx={{ ml: 1 }} />}
+                      </TableCell>
+                    </TableRow>
+                  ))}
+                </TableBody>
+              </Table>
+            )}
+          </>
+        ))}
+
+        {renderSection('Mounts', c.mounts.length === 0 ? renderEmpty('No mounts') : (
+          <Table size="small">
+            <TableHead>
+              <TableRow>
+                <TableCell>Type</TableCell>
+                <TableCell>Source</TableCell>
+                <TableCell>Destination</TableCell>
+                <TableCell>Access</TableCell>
+              </TableRow>
+            </TableHead>
+            <TableBody>
+              {c.mounts.map((mount, index) => (
+                <TableRow key={index}>
+                  <TableCell>{mount.type}</TableCell>
+                  <TableCell sx={{ wordBreak: 'break-all' }}>{mount.name || mount.source}</TableCell>
+                  <TableCell sx={{ wordBreak: 'break-all' }}>{mount.destination}</TableCell>
+                  <TableCell>{mount.readOnly ? 'Read-only' : 'Read-write'}</TableCell>
+                </TableRow>
+              ))}
+            </TableBody>
+          </Table>
+        ))}
+
+        {renderSection(`Networks (${c.networkMode || 'default'})`, c.networks.length === 0 ? renderEmpty('No networks') : (
+          <Table size="small">
+            <TableHead>
+              <TableRow>
+                <TableCell>Network</TableCell>
+                <TableCell>IP address</TableCell>
+                <TableCell>Gateway</TableCell>
+                <TableCell>MAC address</TableCell>
+                <TableCell>Aliases</TableCell>
+              </TableRow>
+            </TableHead>
+            <TableBody>
+              {c.networks.map((network) => (
+                <TableRow key={network.name}>
+                  <TableCell>{network.name}</TableCell>
+                  <TableCell>{network.ipAddress || '-'}</TableCell>
+                  <TableCell>{network.gateway || '-'}</TableCell>
+                  <TableCell sx={{ fontFamily: 'monospace' }}>{network.macAddress || '-'}</TableCell>
+                  <TableCell>{(network.aliases || []).join(', ') || '-'}</TableCell>
+                </TableRow>
+              ))}
+            </TableBody>
+          </Table>
+        ))}
+
+        {renderSection('Ports', c.ports.length === 0 ? renderEmpty('No exposed ports') : renderFields(
+          c.ports.map((port) => [
+            `${port.containerPort}/${port.protocol}`,
+            port.hostPort ? `${port.hostIp || '0.0.0.0'}:${port.hostPort}` : 'Not published',
+          ] as [string, React.ReactNode])
+        ))}
+
+        {renderSection('Labels', Object.keys(c.labels).length === 0 ? renderEmpty('No labels') : renderFields(
+          Object.keys(c.labels).sort().map((key) => [key, c.labels[key]] as [string, React.ReactNode])
+        ))}
+      </>
+    );
+  };
+
+  return (
+    <Box sx={{ display: 'flex', flexDirection: 'column', height: '100%' }}>
+      {/* Header with controls */}
+      <Box
+        sx={{
+          display: 'flex',
+          justifyContent: 'space-between',
+          alignItems: 'center',
+          p: 1,
+          borderBottom: 1,
+          borderColor: 'divider',
+        }}
+      >
+        <Typography sx={{ fontSize: '1rem' }}>
+          {containerName} ({containerId.substring(0, 12)})
+        </Typography>
+        <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+          <Tooltip title="Reload details">
+            <IconButton onClick={fetchDetails} disabled={isLoading} size="small">
+              <RefreshIcon fontSize="small" />
+            </IconButton>
+          </Tooltip>
+          <Tooltip title="Close details">
+            <IconButton onClick={onClose} edge="end" size="small">
+              <CloseIcon fontSize="small" />
+            </IconButton>
+          </Tooltip>
+        </Box>
+      </Box>
+
+      {error && (
+        <Alert severity="error" sx={{ m: 1 }}>
+          {error}
+        </Alert>
+      )}
+
+      <Box sx={{ flex: 1, overflow: 'auto', p: 2 }}>
+        {isLoading && !container ? (
+          <Box sx={{ display: 'flex', justifyContent: 'center', p: 4 }}>
+            <CircularProgress />
+          </Box>
+        ) : container && renderDetails(container)}
+      </Box>
+    </Box>
+  );
+};
+
+export default ContainerDetails;
@@ -16,7 +16,7 @@ import CloseIcon from '@mui/icons-material/Close';
 import RefreshIcon from '@mui/icons-material/Refresh';
 import AddIcon from '@mui/icons-material/Add';
 import RemoveIcon from '@mui/icons-material/Remove';
-import { Environment } from '../../App';
+import { connectionParams, Environment } from '../../App';
 
 interface ErrorResponse {
   error: string;
@@ -229,8 +229,7 @@ const ContainerLogs: React.FC<ContainerLogsProps> = ({
       // Decide which endpoint to call
       let endpoint = '';
       let payload: any = {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username
+        ...connectionParams(activeEnvironment)
       };
 
       if (logsType === 'container') {
@@ -10,31 +10,48 @@ import {
   TableCell,
   TableContainer,
   TableHead,
+  TablePagination,
   TableRow,
   Typography,
   IconButton,
   Tooltip,
   Chip,
   Drawer,
-  Stack, Collapse
+  Stack, Collapse,
+  Button,
+  Checkbox,
+  Dialog,
+  DialogActions,
+  DialogContent,
+  DialogTitle,
+  Menu,
+  MenuItem,
+  TextField
 } from '@mui/material';
 import PlayArrowIcon from '@mui/icons-material/PlayArrow';
 import StopIcon from '@mui/icons-material/Stop';
+import MoreVertIcon from '@mui/icons-material/MoreVert';
 import VisibilityIcon from '@mui/icons-material/Visibility';
+import InfoIcon from '@mui/icons-material/InfoOutlined';
 import KeyboardArrowDownIcon from '@mui/icons-material/KeyboardArrowDown';
 import KeyboardArrowUpIcon from '@mui/icons-material/KeyboardArrowUp';
 import PortIcon from '@mui/icons-material/Devices';
-import { Environment, ExtensionSettings } from '../../App';
+import ForwardIcon from '@mui/icons-material/SettingsEthernet';
+import { connectionParams, Environment, ExtensionSettings } from '../../App';
 import AutoRefreshControls from '../../components/AutoRefreshControls';
 import ContainerLogs from './ContainerLogs';
+import ContainerDetails from './ContainerDetails';
 import ConfirmationDialog from '../../components/ConfirmationDialog';
+import Terminal, { TerminalSession, TerminalSize } from '../../components/Terminal';
 
 // Extended Container interface with ports
 export interface DockerContainer {
   id: string;
   name: string;
   image: string;
+  state?: string; // running, exited, paused, dead, ...
   status: string;
+  created?: number; // Unix seconds
   ports: string;
   labels?: string; // raw label string from Docker, optional
   composeProject?: string; // if container belongs to a compose project
@@ -51,8 +68,22 @@ export interface ComposeGroup {
 export interface ContainersResponse {
   composeGroups: ComposeGroup[];
   ungrouped: DockerContainer[];
+  total: number; // Matching containers on every page
+  page: number;
+  pageSize: number;
 }
 
+// Filters of the container list, applied by the backend
+interface ContainerFilters {
+  status: string; // One state, or every state when empty
+  name: string; // Part of the name, or a glob like web-*
+  image: string;
+  composeProject: string;
+  labels: string; // Comma separated key or key=value
+}
+
+const containerStates = ['running', 'exited', 'paused', 'restarting', 'created', 'dead'];
+
 
 // Parsed port binding type
 interface PortBinding {
@@ -61,6 +92,59 @@ interface PortBinding {
   protocol: string;
 }
 
+// A local port forwarded over the tunnel, as returned by /forwards
+interface PortForward {
+  localPort: number;
+  connection: string;
+  target: string;
+  remoteHost: string;
+  remotePort: number;
+  containerId?: string;
+  state: 'active' | 'waiting';
+  streams: number;
+  lastError?: string;
+}
+
+// Lifecycle actions of the /container endpoints; all but rename also run in bulk
+type ContainerAction = 'start' | 'stop' | 'restart' | 'pause' | 'unpause' | 'kill' | 'remove' | 'rename';
+type BulkAction = Exclude<ContainerAction, 'rename'>;
+
+interface ContainerActionOptions {
+  signal?: string; // kill, SIGKILL when unset
+  force?: boolean; // remove
+  volumes?: boolean; // remove
+  name?: string; // rename
+}
+
+// Outcome for each container of a /containers/bulk request
+interface BulkActionResponse {
+  success: string;
+  failed: number;
+  results: { containerId: string; success: boolean; status: number; error?: string }[];
+}
+
+const actionLabels: Record<ContainerAction, string> = {
+  start: 'Start',
+  stop: 'Stop',
+  restart: 'Restart',
+  pause: 'Pause',
+  unpause: 'Unpause',
+  kill: 'Kill',
+  remove: 'Remove',
+  rename: 'Rename',
+};
+
+const actionMessages: Record<ContainerAction, string> = {
+  start: 'Are you sure you want to start this container?',
+  stop: 'Are you sure you want to stop this container? Any running processes will be terminated.',
+  restart: 'Are you sure you want to restart this container? Any running processes will be restarted.',
+  pause: 'Are you sure you want to pause this container? Its processes are frozen until it is unpaused.',
+  unpause: 'Are you sure you want to unpause this container?',
+  kill: 'Are you sure you want to kill this container? Its processes get no chance to shut down cleanly.',
+  remove: 'Are you sure you want to remove this container? It is stopped first if it is running, and cannot be recovered.',
+  rename: '',
+};
+
 // Error response interface
 interface ErrorResponse {
   error: string;
@@ -95,6 +179,9 @@ const Containers: React.FC<ContainersProps> = ({
   const [error, setError] = useState('');
   const ddClient = useDockerDesktopClient();
 
+  // Port forwards of every environment, matched to containers by ID
+  const [forwards, setForwards] = useState<PortForward[]>([]);
+
   // Auto-refresh states
   const [autoRefresh, setAutoRefresh] = useState(false);
   const [refreshInterval, setRefreshInterval] = useState(30); // Default 30 seconds
@@ -105,24 +192,58 @@ const Containers: React.FC<ContainersProps> = ({
   const [selectedContainer, setSelectedContainer] = useState<DockerContainer | null>(null);
   const [selectedComposeProject, setSelectedComposeProject] = useState<string | null>(null);
 
-  // Confirmation dialog states
+  // Container whose configuration is shown
+  const [detailsContainer, setDetailsContainer] = useState<DockerContainer | null>(null);
+
+  // Confirmation dialog states; without a container the action applies to the selection
   const [confirmDialogOpen, setConfirmDialogOpen] = useState(false);
   const [confirmAction, setConfirmAction] = useState<{
-    type: 'start' | 'stop';
+    type: ContainerAction;
     container: DockerContainer | null;
   }>({ type: 'start', container: null });
 
-  // Load containers when active environment changes
+  // Filters, order and page of the list
+  const [filters, setFilters] = useState<ContainerFilters>({ status: '', name: '', image: '', composeProject: '', labels: '' });
+  const [sortKey, setSortKey] = useState('-created');
+  const [page, setPage] = useState(0); // Zero-based, as TablePagination counts
+  const [pageSize, setPageSize] = useState(50);
+  const [total, setTotal] = useState<number | null>(null); // Unknown until the first listing
+
+  // Containers selected for bulk actions, by ID
+  const [selectedIds, setSelectedIds] = useState<string[]>([]);
+
+  // Menu with the less common actions of a container
+  const [actionMenu, setActionMenu] = useState<{ anchor: HTMLElement; container: DockerContainer } | null>(null);
+
+  // Container being renamed, with the name typed so far
+  const [renaming, setRenaming] = useState<DockerContainer | null>(null);
+  const [newName, setNewName] = useState('');
+
+  // Shell in a container: chosen in a dialog, then open in a drawer
+  const [execSetup, setExecSetup] = useState<DockerContainer | null>(null);
+  const [execOptions, setExecOptions] = useState({ shell: '', user: '' });
+  const [execContainer, setExecContainer] = useState<DockerContainer | null>(null);
+
+  // Every listed container, grouped or not, for selecting them all
+  const allContainers = [...composeGroups.flatMap(group => group.containers), ...ungroupedContainers];
+
+  // Clear the selection when active environment changes
   useEffect(() => {
-    if (activeEnvironment) {
-      loadContainers();
-    } else {
+    setSelectedIds([]);
+    if (!activeEnvironment) {
       // Clear containers if no environment is selected
       setComposeGroups([]);
       setUngroupedContainers([]);
     }
   }, [activeEnvironment]);
 
+  // Load containers when the environment, the filters or the page change, once typing pauses
+  useEffect(() => {
+    if (!activeEnvironment) return;
+    const timer = setTimeout(() => loadContainers(), 300);
+    return () => clearTimeout(timer);
+  }, [activeEnvironment, filters, sortKey, page, pageSize]);
+
   // Auto-refresh interval setup
   useEffect(() => {
     let intervalId: NodeJS.Timeout | null = null;
@@ -139,7 +260,7 @@ const Containers: React.FC<ContainersProps> = ({
         clearInterval(intervalId);
       }
     };
-  }, [autoRefresh, refreshInterval, activeEnvironment]);
+  }, [autoRefresh, refreshInterval, activeEnvironment, filters, sortKey, page, pageSize]);
 
   // Reset auto-refresh when tab changes or component unmounts
   useEffect(() => {
@@ -229,8 +350,15 @@ const Containers: React.FC<ContainersProps> = ({
 
       // Make API call to fetch containers
       const response = await ddClient.extension.vm.service.post('/connect', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
+        ...connectionParams(activeEnvironment),
+        status: filters.status ? [filters.status] : undefined,
+        name: filters.name || undefined,
+        image: filters.image || undefined,
+        composeProject: filters.composeProject || undefined,
+        labels: filters.labels ? filters.labels.split(',').map(label => label.trim()).filter(Boolean) : undefined,
+        sort: sortKey,
+        page: page + 1,
+        pageSize,
       });
 
       // Check for error response
@@ -243,11 +371,14 @@ const Containers: React.FC<ContainersProps> = ({
       const data = response as ContainersResponse;
 
       // Update states
-      setComposeGroups(data.composeGroups);
-      setUngroupedContainers(data.ungrouped);
+      setComposeGroups(data.composeGroups || []);
+      setUngroupedContainers(data.ungrouped || []);
+      setTotal(data.total);
 
       setLastRefreshTime(new Date()); // Update last refresh time
       console.log('Containers loaded:', data);
+
+      await loadForwards();
     } catch (err: any) {
       console.error('Failed to load containers:', err);
       setError(`Failed to load containers: ${err.message || 'Unknown error'}`);
@@ -259,6 +390,69 @@ const Containers: React.FC<ContainersProps> = ({
     }
   };
 
+  // Load the port forwards; failing to do so only hides them
+  const loadForwards = async () => {
+    try {
+      const response = await ddClient.extension.vm?.service?.get('/forwards') as { forwards: PortForward[] };
+      setForwards(response?.forwards || []);
+    } catch (err: any) {
+      console.error('Failed to load port forwards:', err);
+    }
+  };
+
+  // Forward a local port to a port of a container; a published port is reached on the remote host
+  const forwardPort = async (container: DockerContainer, binding: PortBinding) => {
+    if (!activeEnvironment) return;
+
+    try {
+      if (!ddClient.extension?.vm?.service) {
+        throw new Error('Docker Desktop service not available');
+      }
+
+      const response = await ddClient.extension.vm.service.post('/forwards', {
+        ...connectionParams(activeEnvironment),
+        containerId: container.id,
+        remoteHost: binding.hostPort ? '127.0.0.1' : undefined,
+        remotePort: Number(binding.hostPort || binding.containerPort),
+      });
+
+      if (response && typeof response === 'object' && 'error' in response) {
+        const errorResponse = response as ErrorResponse;
+        throw new Error(errorResponse.error);
+      }
+
+      const forward = (response as { forward: PortForward }).forward;
+      ddClient.desktopUI.toast.success(`localhost:${forward.localPort} forwards to ${container.name}`);
+      await loadForwards();
+    } catch (err: any) {
+      console.error('Failed to forward port:', err);
+      setError(`Failed to forward port: ${err.message || 'Unknown error'}`);
+    }
+  };
+
+  // Stop forwarding a local port
+  const removeForward = async (forward: PortForward) => {
+    try {
+      if (!ddClient.extension?.vm?.service) {
+        throw new Error('Docker Desktop service not available');
+      }
+
+      const response = await ddClient.extension.vm.service.post('/forwards/remove', {
+        localPort: forward.localPort,
+      });
+
+      if (response && typeof response === 'object' && 'error' in response) {
+        const errorResponse = response as ErrorResponse;
+        throw new Error(errorResponse.error);
+      }
+
+      await loadForwards();
+    } catch (err: any) {
+      console.error('Failed to remove port forward:', err);
+      setError(`Failed to remove port forward: ${err.message || 'Unknown error'}`);
+    }
+  };
+
   const toggleComposeGroup = (groupName: string) => {
     setExpandedComposeGroups((prev) => ({
       ...prev,
@@ -267,8 +461,8 @@ const Containers: React.FC<ContainersProps> = ({
   };
 
 
-  // Start a container
-  const startContainer = async (containerId: string) => {
+  // Run a lifecycle action on a container
+  const runContainerAction = async (action: ContainerAction, containerId: string, options: ContainerActionOptions = {}) => {
     if (!activeEnvironment) return;
 
     setIsRefreshing(true);
@@ -277,10 +471,10 @@ const Containers: React.FC<ContainersProps> = ({
         throw new Error('Docker Desktop service not available');
       }
 
-      const response = await ddClient.extension.vm.service.post('/container/start', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
-        containerId
+      const response = await ddClient.extension.vm.service.post(`/container/${action}`, {
+        ...connectionParams(activeEnvironment),
+        containerId,
+        ...options
       });
 
       if (response && typeof response === 'object' && 'error' in response) {
@@ -288,18 +482,22 @@ const Containers: React.FC<ContainersProps> = ({
         throw new Error(errorResponse.error);
       }
 
+      if (action === 'remove') {
+        setSelectedIds(prev => prev.filter(id => id !== containerId));
+      }
+
       // Reload containers after successful operation
       await loadContainers();
     } catch (err: any) {
-      console.error('Failed to start container:', err);
-      setError(`Failed to start container: ${err.message || 'Unknown error'}`);
+      console.error(`Failed to ${action} container:`, err);
+      setError(`Failed to ${action} container: ${err.message || 'Unknown error'}`);
       setIsRefreshing(false);
     }
   };
 
-  // Stop a container
-  const stopContainer = async (containerId: string) => {
-    if (!activeEnvironment) return;
+  // Run a lifecycle action on every selected container, reporting the ones it failed for
+  const runBulkAction = async (action: BulkAction) => {
+    if (!activeEnvironment || selectedIds.length === 0) return;
 
     setIsRefreshing(true);
     try {
@@ -307,10 +505,12 @@ const Containers: React.FC<ContainersProps> = ({
         throw new Error('Docker Desktop service not available');
       }
 
-      const response = await ddClient.extension.vm.service.post('/container/stop', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
-        containerId
+      const response = await ddClient.extension.vm.service.post('/containers/bulk', {
+        ...connectionParams(activeEnvironment),
+        action,
+        containerIds: selectedIds,
+        // Selected containers may be running, removing them is confirmed first
+        force: action === 'remove'
       });
 
       if (response && typeof response === 'object' && 'error' in response) {
@@ -318,15 +518,51 @@ const Containers: React.FC<ContainersProps> = ({
         throw new Error(errorResponse.error);
       }
 
-      // Reload containers after successful operation
+      const failures = ((response as BulkActionResponse).results || []).filter(result => !result.success);
+      if (failures.length > 0) {
+        setError(`Failed to ${action} ${failures.length} container(s): ` +
+          failures.map(result => `${result.containerId.substring(0, 12)}: ${result.error}`).join('; '));
+      }
+      setSelectedIds([]);
       await loadContainers();
     } catch (err: any) {
-      console.error('Failed to stop container:', err);
-      setError(`Failed to stop container: ${err.message || 'Unknown error'}`);
+      console.error(`Failed to ${action} containers:`, err);
+      setError(`Failed to ${action} containers: ${err.message || 'Unknown error'}`);
       setIsRefreshing(false);
     }
   };
 
+  const toggleSelected = (containerId: string) => {
+    setSelectedIds(prev => prev.includes(containerId) ? prev.filter(id => id !== containerId) : [...prev, containerId]);
+  };
+
+  // Change one filter, starting over from the first page
+  const updateFilter = (key: keyof ContainerFilters, value: string) => {
+    setFilters(prev => ({ ...prev, [key]: value }));
+    setPage(0);
+  };
+
+  const hasFilters = Object.values(filters).some(value => value !== '');
+
+  // Chip color of a container's state
+  const stateColor = (container: DockerContainer): 'success' | 'warning' | 'error' | 'default' => {
+    switch (container.state) {
+      case 'running':
+        return 'success';
+      case 'paused':
+      case 'restarting':
+        return 'warning';
+      case 'dead':
+        return 'error';
+    }
+    return isRunning(container.status) ? 'success' : 'default';
+  };
+
+  // Check if a container is paused
+  const isPaused = (status: string): boolean => {
+    return status.toLowerCase().includes('paused');
+  };
+
   // Check if a container is running
   const isRunning = (status: string): boolean => {
     return status.toLowerCase().includes('up');
@@ -363,33 +599,63 @@ const Containers: React.FC<ContainersProps> = ({
 
   // Handle action confirmation
   const handleConfirmAction = () => {
-    if (!confirmAction.container) return;
-
-    if (confirmAction.type === 'start') {
-      startContainer(confirmAction.container.id);
-    } else if (confirmAction.type === 'stop') {
-      stopContainer(confirmAction.container.id);
+    if (confirmAction.container) {
+      // A running container is only removed once confirmed, which forcing it to is
+      const options = confirmAction.type === 'remove' ? { force: true } : {};
+      runContainerAction(confirmAction.type, confirmAction.container.id, options);
+    } else if (confirmAction.type !== 'rename') {
+      runBulkAction(confirmAction.type);
     }
 
     setConfirmDialogOpen(false);
   };
 
-  // Open confirmation dialog for starting a container
-  const confirmStartContainer = (container: DockerContainer) => {
-    setConfirmAction({
-      type: 'start',
-      container: container
-    });
+  // Open confirmation dialog for an action on a container, or on the selection without one
+  const confirmContainerAction = (type: ContainerAction, container: DockerContainer | null) => {
+    setActionMenu(null);
+    setConfirmAction({ type, container });
     setConfirmDialogOpen(true);
   };
 
-  // Open confirmation dialog for stopping a container
-  const confirmStopContainer = (container: DockerContainer) => {
-    setConfirmAction({
-      type: 'stop',
-      container: container
-    });
-    setConfirmDialogOpen(true);
+  const openRename = (container: DockerContainer) => {
+    setActionMenu(null);
+    setNewName(container.name);
+    setRenaming(container);
+  };
+
+  const openExecSetup = (container: DockerContainer) => {
+    setActionMenu(null);
+    setExecSetup(container);
+  };
+
+  const startExec = () => {
+    setExecContainer(execSetup);
+    setExecSetup(null);
+  };
+
+  // Ask the backend for a shell in the container, which the terminal then connects to
+  const createExecSession = async (container: DockerContainer, size: TerminalSize): Promise<TerminalSession> => {
+    if (!activeEnvironment || !ddClient.extension?.vm?.service) {
+      throw new Error('No environment selected');
+    }
+    const response = await ddClient.extension.vm.service.post('/container/exec', {
+      ...connectionParams(activeEnvironment),
+      containerId: container.id,
+      shell: execOptions.shell,
+      user: execOptions.user,
+      ...size,
+    }) as TerminalSession & { error?: string };
+    if (response && response.error) {
+      throw new Error(response.error);
+    }
+    return response;
+  };
+
+  const submitRename = () => {
+    if (renaming && newName && newName !== renaming.name) {
+      runContainerAction('rename', renaming.id, { name: newName });
+    }
+    setRenaming(null);
   };
 
   // Render port bindings for a container
@@ -402,28 +668,65 @@ const Containers: React.FC<ContainersProps> = ({
 
     return (
       <Stack direction="row" spacing={1} flexWrap="wrap">
-        {portBindings.map((binding, index) => (
-          <Chip
-            key={index}
-            size="small"
-            icon={<PortIcon />}
-            label={
-              binding.hostPort
-                ? `${binding.hostPort}:${binding.containerPort}/${binding.protocol}`
-                : `${binding.containerPort}/${binding.protocol}`
-            }
-            variant="outlined"
-            color="info"
-            sx={{ my: 0.5 }}
-          />
-        ))}
+        {portBindings.map((binding, index) => {
+          const label = binding.hostPort
+            ? `${binding.hostPort}:${binding.containerPort}/${binding.protocol}`
+            : `${binding.containerPort}/${binding.protocol}`;
+          const forward = forwards.find(f =>
+            f.containerId === container.id && f.remotePort === Number(binding.hostPort || binding.containerPort)
+          );
+
+          if (forward) {
+            return (
+              <Tooltip
+                key={index}
+                title={forward.state === 'active'
+                  ? `Forwarded to localhost:${forward.localPort}`
+                  : `Waiting for the tunnel to come back${forward.lastError ? `: ${forward.lastError}` : ''}`}
+              >
+                <Chip
+                  size="small"
+                  icon={<ForwardIcon />}
+                  label={`localhost:${forward.localPort} → ${label}`}
+                  color={forward.state === 'active' ? 'success' : 'warning'}
+                  onDelete={() => removeForward(forward)}
+                  sx={{ my: 0.5 }}
+                />
+              </Tooltip>
+            );
+          }
+
+          // Only TCP ports of running containers can be forwarded
+          const canForward = binding.protocol === 'tcp' && isRunning(container.status) && activeEnvironment?.transport !== 'tcp-tls';
+          return (
+            <Tooltip key={index} title={canForward ? 'Forward to a local port' : ''}>
+              <Chip
+                size="small"
+                icon={<PortIcon />}
+                label={label}
+                variant="outlined"
+                color="info"
+                onClick={canForward ? () => forwardPort(container, binding) : undefined}
+                sx={{ my: 0.5 }}
+              />
+            </Tooltip>
+          );
+        })}
       </Stack>
     );
   };
 
   const renderContainerRow = (container: DockerContainer) => {
     return (
-      <TableRow key={container.id}>
+      <TableRow key={container.id} selected={selectedIds.includes(container.id)}>
+        <TableCell padding="checkbox">
+          <Checkbox
+            size="small"
+            checked={selectedIds.includes(container.id)}
+            onChange={() => toggleSelected(container.id)}
+            disabled={isRefreshing || isLogsOpen}
+          />
+        </TableCell>
         <TableCell width="10%" sx={{ fontFamily: 'monospace' }}>
           {container.id.substring(0, 12)}
         </TableCell>
@@ -431,7 +734,7 @@ const Containers: React.FC<ContainersProps> = ({
         <TableCell width="15%">
           <Chip
             label={container.status}
-            color={isRunning(container.status) ? 'success' : 'default'}
+            color={stateColor(container)}
             size="small"
             variant="outlined"
           />
@@ -442,6 +745,17 @@ const Containers: React.FC<ContainersProps> = ({
         </TableCell>
         <TableCell width="10%" align="right">
           <Box sx={{ display: 'flex', justifyContent: 'flex-end' }}>
+            <Tooltip title="View Details">
+              <IconButton
+                size="small"
+                onClick={() => setDetailsContainer(container)}
+                disabled={isRefreshing || isLogsOpen}
+                sx={{ mr: 1 }}
+              >
+                <InfoIcon fontSize="small" />
+              </IconButton>
+            </Tooltip>
+
             <Tooltip title="View Logs">
               <IconButton
                 size="small"
@@ -459,7 +773,7 @@ const Containers: React.FC<ContainersProps> = ({
                 <IconButton
                   size="small"
                   color="error"
-                  onClick={() => confirmStopContainer(container)}
+                  onClick={() => confirmContainerAction('stop', container)}
                   disabled={isRefreshing || isLogsOpen}
                 >
                   <StopIcon fontSize="small" />
@@ -470,13 +784,23 @@ const Containers: React.FC<ContainersProps> = ({
                 <IconButton
                   size="small"
                   color="success"
-                  onClick={() => confirmStartContainer(container)}
+                  onClick={() => confirmContainerAction('start', container)}
                   disabled={isRefreshing || isLogsOpen}
                 >
                   <PlayArrowIcon fontSize="small" />
                 </IconButton>
               </Tooltip>
             )}
+
+            <Tooltip title="More Actions">
+              <IconButton
+                size="small"
+                onClick={(event) => setActionMenu({ anchor: event.currentTarget, container })}
+                disabled={isRefreshing || isLogsOpen}
+              >
+                <MoreVertIcon fontSize="small" />
+              </IconButton>
+            </Tooltip>
           </Box>
         </TableCell>
       </TableRow>
@@ -497,6 +821,7 @@ const Containers: React.FC<ContainersProps> = ({
     return (
       <>
         <TableRow>
+          <TableCell padding="checkbox"></TableCell>
           <TableCell width="10%"></TableCell>
           <TableCell width="15%">
             <IconButton
@@ -556,6 +881,73 @@ const Containers: React.FC<ContainersProps> = ({
         />
       </Box>
 
+      {/* Filters */}
+      {activeEnvironment && (
+        <Stack direction="row" spacing={1} sx={{ mb: 2 }}>
+          <TextField
+            select
+            size="small"
+            label="Status"
+            value={filters.status}
+            onChange={(e) => updateFilter('status', e.target.value)}
+            sx={{ minWidth: 130 }}
+          >
+            <MenuItem value="">All</MenuItem>
+            {containerStates.map(state => (
+              <MenuItem key={state} value={state}>{state.charAt(0).toUpperCase() + state.slice(1)}</MenuItem>
+            ))}
+          </TextField>
+          <TextField
+            size="small"
+            label="Name"
+            placeholder="web or web-*"
+            value={filters.name}
+            onChange={(e) => updateFilter('name', e.target.value)}
+          />
+          <TextField
+            size="small"
+            label="Image"
+            placeholder="nginx"
+            value={filters.image}
+            onChange={(e) => updateFilter('image', e.target.value)}
+          />
+          <TextField
+            size="small"
+            label="Compose Project"
+            value={filters.composeProject}
+            onChange={(e) => updateFilter('composeProject', e.target.value)}
+          />
+          <TextField
+            size="small"
+            label="Labels"
+            placeholder="tier=front, app"
+            value={filters.labels}
+            onChange={(e) => updateFilter('labels', e.target.value)}
+          />
+          <TextField
+            select
+            size="small"
+            label="Sort"
+            value={sortKey}
+            onChange={(e) => { setSortKey(e.target.value); setPage(0); }}
+            sx={{ minWidth: 150 }}
+          >
+            <MenuItem value="-created">Newest first</MenuItem>
+            <MenuItem value="created">Oldest first</MenuItem>
+            <MenuItem value="name">Name</MenuItem>
+            <MenuItem value="image">Image</MenuItem>
+            <MenuItem value="state">Status</MenuItem>
+          </TextField>
+        </Stack>
+      )}
+
+      {/* Nothing matches */}
+      {activeEnvironment && !isLoading && !error && total === 0 && (
+        <Alert severity="info" sx={{ mb: 3 }}>
+          {hasFilters ? 'No containers match the filters.' : 'No containers found in the selected environment.'}
+        </Alert>
+      )}
+
       {/* No environment */}
       {!activeEnvironment && (
         <Alert severity="info" sx={{ mb: 3 }}>
@@ -601,10 +993,42 @@ const Containers: React.FC<ContainersProps> = ({
             </Box>
           )}
 
+          {/* Bulk actions on the selected containers */}
+          {selectedIds.length > 0 && (
+            <Paper sx={{ display: 'flex', alignItems: 'center', gap: 1, px: 2, py: 1, mb: 1 }}>
+              <Typography variant="body2" sx={{ flexGrow: 1 }}>
+                {selectedIds.length} selected
+              </Typography>
+              {(['start', 'stop', 'restart', 'pause', 'unpause', 'kill', 'remove'] as BulkAction[]).map(action => (
+                <Button
+                  key={action}
+                  size="small"
+                  color={action === 'remove' || action === 'kill' ? 'error' : 'primary'}
+                  onClick={() => confirmContainerAction(action, null)}
+                  disabled={isRefreshing || isLogsOpen}
+                >
+                  {actionLabels[action]}
+                </Button>
+              ))}
+              <Button size="small" onClick={() => setSelectedIds([])}>
+                Clear
+              </Button>
+            </Paper>
+          )}
+
           <TableContainer component={Paper}>
             <Table>
               <TableHead>
                 <TableRow>
+                  <TableCell padding="checkbox">
+                    <Checkbox
+                      size="small"
+                      indeterminate={selectedIds.length > 0 && selectedIds.length < allContainers.length}
+                      checked={allContainers.length > 0 && selectedIds.length === allContainers.length}
+                      onChange={(e) => setSelectedIds(e.target.checked ? allContainers.map(c => c.id) : [])}
+                      disabled={isRefreshing || isLogsOpen}
+                    />
+                  </TableCell>
                   <TableCell width="10%">Container ID</TableCell>
                   <TableCell width="15%">Name</TableCell>
                   <TableCell width="15%">Status</TableCell>
@@ -630,12 +1054,15 @@ const Containers: React.FC<ContainersProps> = ({
             </Table>
           </TableContainer>
 
-          {/* If absolutely no containers */}
-          {composeGroups.length === 0 && ungroupedContainers.length === 0 && !isLoading && (
-            <Alert severity="info" sx={{ mt: 3 }}>
-              No containers found in the selected environment.
-            </Alert>
-          )}
+          <TablePagination
+            component="div"
+            count={total || 0}
+            page={page}
+            rowsPerPage={pageSize}
+            rowsPerPageOptions={[25, 50, 100, 200]}
+            onPageChange={(_, newPage) => setPage(newPage)}
+            onRowsPerPageChange={(e) => { setPageSize(parseInt(e.target.value, 10)); setPage(0); }}
+          />
         </Box>
       )}
 
@@ -667,17 +1094,138 @@ const Containers: React.FC<ContainersProps> = ({
         </Box>
       </Drawer>
 
+      {/* Configuration and state of a container */}
+      <Drawer
+        anchor="right"
+        open={!!detailsContainer}
+        onClose={() => setDetailsContainer(null)}
+        sx={{
+          '& .MuiDrawer-paper': {
+            width: '60%',
+            minWidth: 480,
+            boxShadow: 3,
+          },
+        }}
+      >
+        {detailsContainer && (
+          <ContainerDetails
+            activeEnvironment={activeEnvironment}
+            containerId={detailsContainer.id}
+            containerName={detailsContainer.name}
+            onClose={() => setDetailsContainer(null)}
+          />
+        )}
+      </Drawer>
+
+      {/* Less common actions of a container */}
+      <Menu
+        anchorEl={actionMenu?.anchor}
+        open={!!actionMenu}
+        onClose={() => setActionMenu(null)}
+      >
+        {actionMenu && [
+          <MenuItem key="restart" onClick={() => confirmContainerAction('restart', actionMenu.container)}>Restart</MenuItem>,
+          isPaused(actionMenu.container.status)
+            ? <MenuItem key="unpause" onClick={() => confirmContainerAction('unpause', actionMenu.container)}>Unpause</MenuItem>
+            : <MenuItem key="pause" disabled={!isRunning(actionMenu.container.status)} onClick={() => confirmContainerAction('pause', actionMenu.container)}>Pause</MenuItem>,
+          <MenuItem key="kill" disabled={!isRunning(actionMenu.container.status)} onClick={() => confirmContainerAction('kill', actionMenu.container)}>Kill</MenuItem>,
+          <MenuItem key="exec" disabled={!isRunning(actionMenu.container.status) || isPaused(actionMenu.container.status)} onClick={() => openExecSetup(actionMenu.container)}>Open Terminal</MenuItem>,
+          <MenuItem key="rename" onClick={() => openRename(actionMenu.container)}>Rename</MenuItem>,
+          <MenuItem key="remove" onClick={() => confirmContainerAction('remove', actionMenu.container)} sx={{ color: 'error.main' }}>Remove</MenuItem>
+        ]}
+      </Menu>
+
+      {/* Shell and user of a terminal */}
+      <Dialog open={!!execSetup} onClose={() => setExecSetup(null)} maxWidth="xs" fullWidth>
+        <DialogTitle>Open Terminal</DialogTitle>
+        <DialogContent>
+          <TextField
+            select
+            margin="dense"
+            label="Shell"
+            fullWidth
+            value={execOptions.shell}
+            onChange={(e) => setExecOptions({ ...execOptions, shell: e.target.value })}
+          >
+            <MenuItem value="">bash if available, else sh</MenuItem>
+            <MenuItem value="/bin/bash">/bin/bash</MenuItem>
+            <MenuItem value="/bin/sh">/bin/sh</MenuItem>
+            <MenuItem value="/bin/ash">/bin/ash</MenuItem>
+            <MenuItem value="/bin/zsh">/bin/zsh</MenuItem>
+          </TextField>
+          <TextField
+            margin="dense"
+            label="User"
+            placeholder="The user of the container"
+            helperText="A name or UID, optionally with a group as user:group"
+            fullWidth
+            value={execOptions.user}
+            onChange={(e) => setExecOptions({ ...execOptions, user: e.target.value.trim() })}
+            onKeyDown={(e) => { if (e.key === 'Enter') startExec(); }}
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={() => setExecSetup(null)}>Cancel</Button>
+          <Button onClick={startExec} variant="contained">
+            Open
+          </Button>
+        </DialogActions>
+      </Dialog>
+
+      {/* Terminal of a container */}
+      <Drawer
+        anchor="bottom"
+        open={!!execContainer}
+        onClose={() => setExecContainer(null)}
+        sx={{
+          '& .MuiDrawer-paper': {
+            height: '70%',
+            boxShadow: 3,
+            borderTopLeftRadius: 8,
+            borderTopRightRadius: 8,
+          },
+        }}
+      >
+        {execContainer && (
+          <Terminal
+            title={`${execContainer.name} (${execContainer.id.substring(0, 12)})`}
+            createSession={(size) => createExecSession(execContainer, size)}
+            onClose={() => setExecContainer(null)}
+          />
+        )}
+      </Drawer>
+
+      {/* Rename Dialog */}
+      <Dialog open={!!renaming} onClose={() => setRenaming(null)} maxWidth="xs" fullWidth>
+        <DialogTitle>Rename Container</DialogTitle>
+        <DialogContent>
+          <TextField
+            autoFocus
+            margin="dense"
+            label="New Name"
+            fullWidth
+            value={newName}
+            onChange={(e) => setNewName(e.target.value)}
+            onKeyDown={(e) => { if (e.key === 'Enter') submitRename(); }}
+          />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={() => setRenaming(null)}>Cancel</Button>
+          <Button onClick={submitRename} variant="contained" disabled={!newName}>
+            Rename
+          </Button>
+        </DialogActions>
+      </Dialog>
+
       {/* Confirmation Dialog */}
       <ConfirmationDialog
         open={confirmDialogOpen}
-        title={confirmAction.type === 'start' ? 'Start Container' : 'Stop Container'}
-        message={
-          confirmAction.type === 'start'
-            ? 'Are you sure you want to start this container?'
-            : 'Are you sure you want to stop this container? Any running processes will be terminated.'
-        }
-        confirmText={confirmAction.type === 'start' ? 'Start' : 'Stop'}
-        confirmColor={confirmAction.type === 'start' ? 'success' : 'error'}
+        title={`${actionLabels[confirmAction.type]} ${confirmAction.container ? 'Container' : `${selectedIds.length} Containers`}`}
+        message={confirmAction.container
+          ? actionMessages[confirmAction.type]
+          : actionMessages[confirmAction.type].replace('this container', 'the selected containers')}
+        confirmText={actionLabels[confirmAction.type]}
+        confirmColor={confirmAction.type === 'start' || confirmAction.type === 'unpause' ? 'success' : 'error'}
         resourceName={confirmAction.container ? confirmAction.container.name : ''}
         onConfirm={handleConfirmAction}
         onCancel={() => setConfirmDialogOpen(false)}
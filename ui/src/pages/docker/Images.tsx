@@ -17,7 +17,7 @@ import {
   Chip
 } from '@mui/material';
 import DeleteIcon from '@mui/icons-material/Delete';
-import { Environment, ExtensionSettings } from '../../App';
+import { connectionParams, Environment, ExtensionSettings } from '../../App';
 import AutoRefreshControls from '../../components/AutoRefreshControls';
 import ConfirmationDialog from '../../components/ConfirmationDialog';
 
@@ -132,8 +132,7 @@ const Images: React.FC<ImagesProps> = ({ activeEnvironment, settings }) => {
 
       // Make API call to fetch images
       const response = await ddClient.extension.vm.service.post('/images/list', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
+        ...connectionParams(activeEnvironment),
       });
 
       // Check for error response
@@ -178,8 +177,7 @@ const Images: React.FC<ImagesProps> = ({ activeEnvironment, settings }) => {
 
       // This would be the actual implementation once the API endpoint is available
       const response = await ddClient.extension.vm.service.post('/image/remove', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
+        ...connectionParams(activeEnvironment),
         imageId: imageId
       });
 
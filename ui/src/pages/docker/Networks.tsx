@@ -18,7 +18,7 @@ import {
 } from '@mui/material';
 import DeleteIcon from '@mui/icons-material/Delete';
 import InfoIcon from '@mui/icons-material/Info';
-import { Environment, ExtensionSettings } from '../../App';
+import { connectionParams, Environment, ExtensionSettings } from '../../App';
 import AutoRefreshControls from '../../components/AutoRefreshControls';
 import ConfirmationDialog from '../../components/ConfirmationDialog';
 
@@ -136,8 +136,7 @@ const Networks: React.FC<NetworksProps> = ({ activeEnvironment, settings }) => {
 
       // Make API call to fetch networks
       const response = await ddClient.extension.vm.service.post('/networks/list', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
+        ...connectionParams(activeEnvironment),
       });
 
       // Check for error response
@@ -172,8 +171,7 @@ const Networks: React.FC<NetworksProps> = ({ activeEnvironment, settings }) => {
       }
 
       const response = await ddClient.extension.vm.service.post('/networks/remove', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
+        ...connectionParams(activeEnvironment),
         networkId
       });
 
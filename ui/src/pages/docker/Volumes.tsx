@@ -17,7 +17,7 @@ import {
   Chip
 } from '@mui/material';
 import DeleteIcon from '@mui/icons-material/Delete';
-import { Environment, ExtensionSettings } from '../../App';
+import { connectionParams, Environment, ExtensionSettings } from '../../App';
 import AutoRefreshControls from '../../components/AutoRefreshControls';
 import ConfirmationDialog from '../../components/ConfirmationDialog';
 
@@ -133,8 +133,7 @@ const Volumes: React.FC<VolumesProps> = ({ activeEnvironment, settings }) => {
 
       // Make API call to fetch volumes
       const response = await ddClient.extension.vm.service.post('/volumes/list', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
+        ...connectionParams(activeEnvironment),
       });
 
       // Check for error response
@@ -169,8 +168,7 @@ const Volumes: React.FC<VolumesProps> = ({ activeEnvironment, settings }) => {
       }
 
       const response = await ddClient.extension.vm.service.post('/volumes/remove', {
-        hostname: activeEnvironment.hostname,
-        username: activeEnvironment.username,
+        ...connectionParams(activeEnvironment),
         volumeName
       });
 